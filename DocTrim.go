@@ -9,7 +9,6 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"hash/fnv"
 	"io"
 	"io/ioutil"
 	"log"
@@ -18,6 +17,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nbio/xml"
 )
@@ -29,15 +29,68 @@ const (
 
 // Slimmer 精简器
 type DocTrim struct {
-	dict     map[uint64]*Node
-	seq      uint64
-	hashDict map[uint64]uint64
+	// Mode 处理模式，缺省为无损模式
+	Mode PackMode
+	// KeepRuns 为true时语义模式下不合并相邻的run
+	KeepRuns bool
+	// StripRules 在计算哈希之前应用的清理规则，如DefaultStripProfile
+	StripRules []StripRule
+	// Defaults 只声明缺省值的元素和属性的处理方式
+	Defaults DefaultsMode
+	// MathToLatex 为true时Pack将公式替换为携带LaTeX的紧凑元素
+	MathToLatex bool
+	// Aliases 限定名缩写方式
+	Aliases AliasMode
+	// FlattenStyles 为true时删除与样式继承结果相同的直接格式
+	FlattenStyles bool
+	// Styles 文档的样式表，Process在FlattenStyles为true或Defaults为DefaultsLossy时自动读取
+	Styles *Styles
+	// PlainText 为true时Process返回纯文本
+	PlainText bool
+	// HoistStyles 大于0时Repack将出现次数不少于该值的直接格式提取为样式
+	HoistStyles int
+	// Revisions 修订的处理方式，Pack、Repack和纯文本导出时应用
+	Revisions RevisionMode
+	// RevisionFilter 只处理满足条件的修订
+	RevisionFilter RevisionFilter
+	// Sanitize 外发前清理的内容，Pack、Repack和纯文本导出时应用
+	Sanitize SanitizePolicy
+	// Redact 非空时Pack和纯文本导出将个人信息替换为占位符，需要设置Vault
+	Redact []RedactRule
+	// Vault 占位符与原文的对照表，脱敏时记录原文，Unpack时还原占位符
+	Vault *Vault
+	// Tokenizer 计量方式，用于样式提取的代价估计、分块预算和打包统计，为nil时按字节计
+	Tokenizer Tokenizer
+
+	dict       map[uint64]*Node
+	seq        uint64
+	hashDict   map[uint64]uint64
+	mathDict   map[uint64]mathSource
+	aliasSaved map[string]int
 }
 
 func (slim *DocTrim) Reset() {
 	slim.dict = make(map[uint64]*Node)
 	slim.seq = 1
 	slim.hashDict = make(map[uint64]uint64)
+	slim.mathDict = make(map[uint64]mathSource)
+	slim.aliasSaved = make(map[string]int)
+}
+
+// AliasSavings 返回上一次Pack中每个限定名缩写后节省的字节数
+func (slim *DocTrim) AliasSavings() map[string]int {
+	return slim.aliasSaved
+}
+
+// errFlattenStyles 从XML打包时无法读取样式表，需要调用方设置Styles
+var errFlattenStyles = errors.New("FlattenStyles requires Styles, load them with Package.Styles or use Process")
+
+// errLossyStyles 缺省值删除模式需要样式表判断显式的关闭值能否删除
+var errLossyStyles = errors.New("DefaultsLossy requires Styles, load them with Package.Styles or use Process")
+
+// needsStyles 判断精简步骤是否需要样式表而Styles尚未设置
+func (slim *DocTrim) needsStyles() bool {
+	return slim.Styles == nil && (slim.FlattenStyles || slim.Defaults == DefaultsLossy)
 }
 
 func (slim *DocTrim) RegHash(hash uint64, node *Node) (uint64, bool) {
@@ -84,35 +137,33 @@ func (s *DocTrim) MakeReader(url string) (*zip.ReadCloser, error) {
 }
 
 // Process 处理文档
-// 根据URL打开或下载文件，并遍历zip文件中的文件
-// 如果找到"word/document.xml"文件，则读取其内容并返回
-// 否则，返回空字符串
+// 根据URL打开或下载docx，打包其中的word/document.xml
+// 需要样式表而Styles未设置时从包中读取
 func (s DocTrim) Process(url string) ([]byte, error) {
 	// open or download file
 	if url == "" {
 		return nil, errors.New("url is empty")
 	}
 
-	r, err := s.MakeReader(url)
+	if s.PlainText {
+		text, err := s.ProcessText(url)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(text.Text), nil
+	}
+
+	pkg, err := s.OpenPackage(url)
 	if err != nil {
-		log.Fatalf("error opening zip file: %v", err)
 		return nil, err
 	}
-
-	for _, f := range r.File {
-		log.Printf("File: %s\n", f.Name)
-		if f.Name == "word/document.xml" {
-			rc, err := f.Open()
-			if err != nil {
-				log.Fatalf("error opening file: %v", err)
-				return nil, err
-			}
-			defer rc.Close()
-			return s.Pack(rc)
+	if s.needsStyles() {
+		if s.Styles, err = pkg.Styles(); err != nil {
+			return nil, err
 		}
 	}
-
-	return nil, errors.New("document.xml not found")
+	data, _ := pkg.Data(documentPart)
+	return s.Pack(bytes.NewReader(data))
 }
 
 // xmlNodeToJson 将XML节点转换为JSON对象
@@ -178,87 +229,89 @@ type Node struct {
 	hash     uint64
 	refCount int
 	isCompat bool
+	// digest Digest缓存的内容哈希，0表示未计算
+	digest uint64
 }
 
-func EqualXml(l, r []byte) bool {
-	var lNode, rNode Node
-	xml.Unmarshal(l, &lNode)
-	xml.Unmarshal(r, &rNode)
-	return NodeEquals(&lNode, &rNode)
+// attr 返回本地名为local的属性值
+func (node *Node) attr(local string) (string, bool) {
+	for _, a := range node.Attrs {
+		if a.Name.Local == local {
+			return a.Value, true
+		}
+	}
+	return "", false
 }
 
-func NodeEquals(l, r *Node) bool {
-	if l.XMLName.Local == "sectPr" &&
-		r.XMLName.Local == "sectPr" {
-		return true
-	}
-	if l.XMLName.Local != r.XMLName.Local ||
-		len(l.Content) != len(r.Content) ||
-		!bytes.Equal(l.Content, r.Content) ||
-		l.XMLName.Space != r.XMLName.Space {
-		log.Printf("l: %s, r: %s", l.XMLName.Local, r.XMLName.Local)
-		return false
+// child 返回第一个本地名为local的子节点，不存在时返回nil
+func (node *Node) child(local string) *Node {
+	for _, c := range node.Children {
+		if c.XMLName.Local == local {
+			return c
+		}
 	}
+	return nil
+}
 
-	if len(l.Attrs) != len(r.Attrs) {
-		log.Printf("l: %s, r: %s", l.XMLName.Local, r.XMLName.Local)
-		return false
+// clone 深拷贝子树，不复制哈希等计算结果
+func (node *Node) clone() *Node {
+	c := &Node{
+		XMLName:  node.XMLName,
+		Attrs:    append([]xml.Attr{}, node.Attrs...),
+		Content:  append([]byte{}, node.Content...),
+		Children: make([]*Node, len(node.Children)),
 	}
-
-	for i, attr := range l.Attrs {
-		if attr.Name.Local != r.Attrs[i].Name.Local || attr.Value != r.Attrs[i].Value || attr.Name.Space != r.Attrs[i].Name.Space {
-			log.Printf("l: %s, r: %s", l.XMLName.Local, r.XMLName.Local)
-			return false
-		}
+	for i, child := range node.Children {
+		c.Children[i] = child.clone()
 	}
+	return c
+}
 
-	if len(l.Children) != len(r.Children) {
-		log.Printf("l: %s, r: %s", l.XMLName.Local, r.XMLName.Local)
-		return false
+// newWordNode 创建w命名空间下的节点
+func newWordNode(local string, children ...*Node) *Node {
+	return &Node{
+		XMLName:  xml.Name{Space: nsWord, Local: local},
+		Attrs:    []xml.Attr{},
+		Content:  []byte{},
+		Children: children,
 	}
+}
 
-	for i, child := range l.Children {
-		if !NodeEquals(child, r.Children[i]) {
-			log.Printf("l: %s, r: %s", l.XMLName.Local, r.XMLName.Local)
-			return false
-		}
-	}
+// wordVal 创建只有w:val属性的节点
+func wordVal(local, val string) *Node {
+	node := newWordNode(local)
+	node.Attrs = append(node.Attrs, xml.Attr{Name: xml.Name{Space: nsWord, Local: "val"}, Value: val})
+	return node
+}
+
+func EqualXml(l, r []byte) bool {
+	var lNode, rNode Node
+	xml.Unmarshal(l, &lNode)
+	xml.Unmarshal(r, &rNode)
+	return NodeEquals(&lNode, &rNode)
+}
 
-	return true
+// NodeEquals 按RoundTripOptions比较两棵节点树，不相同时打印每处差异
+func NodeEquals(l, r *Node) bool {
+	diffs := RoundTripOptions.Diff(l, r)
+	for _, d := range diffs {
+		log.Print(d)
+	}
+	return len(diffs) == 0
 }
 
-// ComputeHash 计算节点的哈希值
-// 使用fnv算法计算节点的哈希值，并将结果存储在hash字段中
-// 如果哈希值已存在于字典中，则将节点的isCompat字段设置为true
+// ComputeHash 按内容登记子树，返回节点的序号
+// 内容哈希使用Digest，子树先于父节点登记；如果内容已存在于字典中，则将节点的isCompat字段设置为true
 func (node *Node) ComputeHash(slim *DocTrim) uint64 {
+	// 清除上一次计算留下的引用标记
+	node.isCompat = false
+	node.refCount = 0
 
-	hash := fnv.New64a()
-	hash.Write([]byte(strconv.Itoa(len(node.Children))))
 	for _, child := range node.Children {
-
 		child.ComputeHash(slim)
-		childHash := []byte(strconv.FormatUint(child.hash, 16)) // Convert child.hash to []byte
-		hash.Write(childHash)
 	}
 
-	if len(node.Content) > 0 {
-		hash.Write([]byte(strconv.Itoa(len(node.Content))))
-		hash.Write(node.Content)
-	}
-
-	hash.Write([]byte(strconv.Itoa(len(node.Attrs))))
-	for _, attr := range node.Attrs {
-
-		hash.Write([]byte(strconv.Itoa(len(attr.Name.Local))))
-		hash.Write([]byte(attr.Name.Local))
-		hash.Write([]byte(strconv.Itoa(len(attr.Value))))
-		hash.Write([]byte(attr.Value))
-	}
-
-	hash.Write([]byte(strconv.Itoa(len(node.XMLName.Local))))
-	hash.Write([]byte(node.XMLName.Local))
-
-	seq, _ := slim.RegHash(hash.Sum64(), node)
+	seq, _ := slim.RegHash(node.Digest(), node)
 	return seq
 }
 
@@ -267,6 +320,7 @@ func (node *Node) ComputeHash(slim *DocTrim) uint64 {
 // 否则，如果节点的refCount大于0，则将节点的哈希值作为属性添加到节点中
 // 最后，递归压缩子节点
 func (node *Node) Compact() error {
+	node.digest = 0
 	if node.isCompat {
 		refAttr := xml.Attr{
 			Name:  xml.Name{Local: refTag},
@@ -296,6 +350,7 @@ func (node *Node) Compact() error {
 }
 
 func (node *Node) UndoCompact(dict map[uint64]*Node) error {
+	node.digest = 0
 	for i := range node.Children {
 		node.Children[i].UndoCompact(dict)
 	}
@@ -346,6 +401,7 @@ func EmptyToSelfClosing(from []byte) []byte {
 const defaultHeader = `<w:document xmlns:wpc="http://schemas.microsoft.com/office/word/2010/wordprocessingCanvas" xmlns:mc="http://schemas.openxmlformats.org/markup-compatibility/2006" xmlns:o="urn:schemas-microsoft-com:office:office" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships" xmlns:m="http://schemas.openxmlformats.org/officeDocument/2006/math" xmlns:v="urn:schemas-microsoft-com:vml" xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing" xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:wpg="http://schemas.microsoft.com/office/word/2010/wordprocessingGroup" xmlns:wpi="http://schemas.microsoft.com/office/word/2010/wordprocessingInk" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:wne="http://schemas.microsoft.com/office/word/2006/wordml" xmlns:wps="http://schemas.microsoft.com/office/word/2010/wordprocessingShape" xmlns:w10="urn:schemas-microsoft-com:office:word" xmlns:wp14="http://schemas.microsoft.com/office/word/2010/wordprocessingDrawing" xmlns:w14="http://schemas.microsoft.com/office/word/2010/wordml" xmlns:w15="http://schemas.microsoft.com/office/word/2012/wordml" xmlns:w16cex="http://schemas.microsoft.com/office/word/2018/wordml/cex" xmlns:w16cid="http://schemas.microsoft.com/office/word/2016/wordml/cid" xmlns:w16="http://schemas.microsoft.com/office/word/2018/wordml" xmlns:w16sdtdh="http://schemas.microsoft.com/office/word/2020/wordml/sdtdatahash" xmlns:w16se="http://schemas.microsoft.com/office/word/2015/wordml/symex" mc:Ignorable="w14 w15 w16se w16cid w16 w16cex w16sdtdh wp14">`
 
 func (node *Node) OmitNode() {
+	node.digest = 0
 	if node.XMLName.Local == "sectPr" {
 		node.Attrs = []xml.Attr{}
 		node.Children = []*Node{}
@@ -368,21 +424,154 @@ func (slim *DocTrim) Pack(xmlData io.Reader) ([]byte, error) {
 		log.Fatalf("error decoding xml: %v", err)
 		return nil, err
 	}
+	return slim.PackNode(&root)
+}
 
-	// 将内容重复的节点使用引用标注
+// PackNode 按选项压缩已解析的节点树，root会被修改
+func (slim *DocTrim) PackNode(root *Node) ([]byte, error) {
+	return slim.packNode(root, nil)
+}
+
+// trimNode 应用哈希之前的精简步骤：修订、清理、脱敏、编辑噪声、重复格式、合并run和缺省值
+// 不含公式转换，结果仍是普通的WordprocessingML
+func (slim *DocTrim) trimNode(root *Node, report *PackReport) error {
+	// 接受或拒绝修订
+	start := time.Now()
+	if slim.Revisions != RevisionsKeep {
+		report.omit("revisions", ApplyRevisions(root, slim.Revisions, slim.RevisionFilter))
+		report.stage("revisions", start)
+	}
+
+	// 清理外发前不应保留的内容
+	if slim.Sanitize.Enabled() {
+		start = time.Now()
+		for kind, n := range sanitizeNode(root, slim.Sanitize, slim.Styles) {
+			report.omit("sanitize:"+kind, n)
+		}
+		report.stage("sanitize", start)
+	}
+
+	// 个人信息脱敏
+	if len(slim.Redact) > 0 {
+		if slim.Vault == nil {
+			return errRedactVault
+		}
+		start = time.Now()
+		counts, err := Redact(root, slim.Redact, slim.Vault)
+		if err != nil {
+			return err
+		}
+		for kind, n := range counts {
+			report.omit("redact:"+kind, n)
+		}
+		report.stage("redact", start)
+	}
+
+	// 清理编辑噪声
+	if len(slim.StripRules) > 0 {
+		start = time.Now()
+		for rule, n := range StripNoise(root, slim.StripRules) {
+			report.omit("strip:"+rule, n)
+		}
+		report.stage("strip", start)
+	}
+
+	// 删除与样式重复的直接格式
+	if slim.FlattenStyles {
+		if slim.Styles == nil {
+			return errFlattenStyles
+		}
+		start = time.Now()
+		report.omit("redundant formatting", slim.Styles.DropRedundant(root))
+		report.stage("flatten styles", start)
+	}
+
+	// 语义模式下合并格式相同的相邻run
+	if slim.Mode == ModeSemantic && !slim.KeepRuns {
+		start = time.Now()
+		report.omit("merged runs", slim.MergeRuns(root))
+		slim.Reset()
+		report.stage("merge runs", start)
+	}
+
+	// 删除缺省值
+	if slim.Defaults != DefaultsKeep {
+		start = time.Now()
+		if slim.Defaults == DefaultsLossy {
+			if slim.Styles == nil {
+				return errLossyStyles
+			}
+			report.omit("defaults", slim.Styles.OmitDefaults(root))
+		} else {
+			report.omit("defaults", root.OmitDefaults(slim.Defaults == DefaultsStrict))
+		}
+		report.stage("defaults", start)
+	}
+
+	return nil
+}
+
+// packNode 压缩节点树，report不为nil时记录各阶段的统计
+func (slim *DocTrim) packNode(root *Node, report *PackReport) ([]byte, error) {
 	slim.Reset()
+	// 调用方可能在Digest之后直接修改过节点，引用必须按当前内容计算
+	root.clearDigests()
+
+	if err := slim.trimNode(root, report); err != nil {
+		return nil, err
+	}
+
+	// 公式转换为LaTeX
+	start := time.Now()
+	if slim.MathToLatex {
+		if err := slim.packMath(root); err != nil {
+			return nil, err
+		}
+		report.omit("math", len(slim.mathDict))
+		report.stage("math", start)
+	}
+
+	// 将内容重复的节点使用引用标注
+	start = time.Now()
 	root.ComputeHash(slim)
+	report.stage("hash", start)
+	var candidates map[uint64]repeatedCandidate
+	if report != nil {
+		candidates = slim.repeatedCandidates(root)
+	}
+	start = time.Now()
 	root.Compact()
+	report.stage("compact", start)
+	if report != nil {
+		report.countReferences(root, candidates, slim.measure)
+		report.omit("sectPr", countOmittedSections(root))
+	}
 
 	// 名字空间优化
 	root.OmitNode()
 
+	start = time.Now()
 	xml, _ := root.Marshal()
 
 	xml = bytes.Replace(xml, []byte(defaultHeader), []byte("<w:document>"), 1)
 
 	xml = EmptyToSelfClosing(xml)
 	//fmt.Println(string(xml))
+	report.stage("marshal", start)
+
+	// 缩写限定名
+	start = time.Now()
+	switch slim.Aliases {
+	case AliasBuiltin:
+		xml, slim.aliasSaved = BuiltinAliases.Abbreviate(xml)
+	case AliasDocument:
+		table := DocumentAliases(xml)
+		xml, slim.aliasSaved = table.Abbreviate(xml)
+		xml = append(table.Header(), xml...)
+	}
+	if slim.Aliases != AliasNone {
+		report.stage("aliases", start)
+	}
 
 	return xml, nil
 }
@@ -396,6 +585,19 @@ func (s DocTrim) Unpack(reader io.Reader) ([]byte, error) {
 
 	// replace <w:document> with defaultHeader
 	xmldata, _ := ioutil.ReadAll(reader)
+
+	// 展开缩写的限定名
+	table, xmldata, err := ParseAliasHeader(xmldata)
+	if err != nil {
+		return nil, err
+	}
+	if table == nil && s.Aliases == AliasBuiltin {
+		table = BuiltinAliases
+	}
+	if table != nil {
+		xmldata = table.Expand(xmldata)
+	}
+
 	xmldata = bytes.ReplaceAll(xmldata, []byte("<w:document>"), []byte(defaultHeader))
 
 	decoder := xml.NewDecoder(bytes.NewReader(xmldata))
@@ -406,6 +608,15 @@ func (s DocTrim) Unpack(reader io.Reader) ([]byte, error) {
 	}
 
 	root.UndoCompact(dict)
+	if err := unpackMath(&root, s.mathDict); err != nil {
+		return nil, err
+	}
+	if err := root.RestoreDefaults(); err != nil {
+		return nil, err
+	}
+	if s.Vault != nil {
+		s.Vault.Restore(&root)
+	}
 	xml, _ := root.Marshal()
 	//fmt.Println(string(xml))
 
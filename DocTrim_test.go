@@ -7,6 +7,8 @@ import (
 	"log"
 	"os"
 	"testing"
+
+	"github.com/nbio/xml"
 )
 
 var testXml = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
@@ -784,3 +786,22 @@ func TestEmptyToSelfClosing(t *testing.T) {
 	log.Printf("%s", string(data))
 	log.Printf("%d -> %d", len(input), len(data))
 }
+
+func TestComputeHashNamespace(t *testing.T) {
+	src := `<w:body xmlns:w="` + nsWord + `" xmlns:m="` + nsMath + `"><w:r><w:t>x</w:t></w:r><m:r><m:t>x</m:t></m:r><w:r><w:t>x</w:t></w:r></w:body>`
+	var root Node
+	if err := xml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatal(err)
+	}
+	slim := &DocTrim{}
+	slim.Reset()
+	root.ComputeHash(slim)
+	// 只有本地名相同的子树不是重复内容
+	w, m, again := root.Children[0], root.Children[1], root.Children[2]
+	if m.isCompat || m.hash == w.hash {
+		t.Error("elements in different namespaces share a sequence")
+	}
+	if !again.isCompat || again.hash != w.hash {
+		t.Error("identical subtree not registered as a repeat")
+	}
+}
@@ -0,0 +1,372 @@
+// 无障碍检查
+// 屏幕阅读器依赖替代文字、标题层级、表格标题行和文档语言朗读内容，
+// 只用颜色区分的文字和用空段落排出的间距对读屏用户没有意义或造成干扰
+// CheckAccessibility检查节点树，CheckPackageAccessibility检查包中所有正文部件和文档语言
+
+package DocTrim
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 检查规则
+const (
+	// AccessibilityAltText 图片和图形没有替代文字
+	AccessibilityAltText = "alt-text"
+	// AccessibilityHeadingLevels 标题跳级
+	AccessibilityHeadingLevels = "heading-levels"
+	// AccessibilityTableHeader 表格没有标题行
+	AccessibilityTableHeader = "table-header"
+	// AccessibilityColorOnly 只用颜色区分的文字
+	AccessibilityColorOnly = "color-only"
+	// AccessibilityEmptyParagraphs 用空段落排出的间距
+	AccessibilityEmptyParagraphs = "empty-paragraphs"
+	// AccessibilityLanguage 没有设置文档语言
+	AccessibilityLanguage = "language"
+)
+
+const (
+	nsDrawing = "http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing"
+	nsVML     = "urn:schemas-microsoft-com:vml"
+	// nsDecorative 标记装饰性图形的扩展
+	nsDecorative = "http://schemas.microsoft.com/office/drawing/2017/decorative"
+	corePart     = "docProps/core.xml"
+)
+
+// AccessibilityIssue 一条无障碍问题
+type AccessibilityIssue struct {
+	Rule string `json:"rule"`
+	// Part 所在的部件，检查节点树时为空
+	Part    string `json:"part,omitempty"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (i AccessibilityIssue) String() string {
+	location := i.Part
+	if i.Path != "" {
+		if location != "" {
+			location += ":"
+		}
+		location += i.Path
+	}
+	if location == "" {
+		return i.Rule + ": " + i.Message
+	}
+	return location + ": " + i.Rule + ": " + i.Message
+}
+
+// CheckAccessibility 检查子树，styles用于识别标题样式，可以为nil
+// 文档语言属于包级设置，由CheckPackageAccessibility检查
+func CheckAccessibility(root *Node, styles *Styles) []AccessibilityIssue {
+	a := &accessibilityAudit{styles: styles, heading: -1}
+	a.walk(root, "/"+qualifiedName(root))
+	a.flushEmpty()
+	return a.issues
+}
+
+// CheckPackageAccessibility 检查包中的正文、页眉页脚和脚注尾注，以及文档语言
+func CheckPackageAccessibility(pkg *Package) ([]AccessibilityIssue, error) {
+	styles, err := pkg.Styles()
+	if err != nil {
+		return nil, err
+	}
+	issues := []AccessibilityIssue{}
+	for _, name := range pkg.ContentParts() {
+		root, err := pkg.Part(name)
+		if err != nil {
+			return nil, err
+		}
+		if root == nil {
+			continue
+		}
+		for _, issue := range CheckAccessibility(root, styles) {
+			issue.Part = name
+			issues = append(issues, issue)
+		}
+	}
+
+	lang, err := documentLanguage(pkg, styles)
+	if err != nil {
+		return nil, err
+	}
+	if lang == "" {
+		issues = append(issues, AccessibilityIssue{
+			Rule:    AccessibilityLanguage,
+			Part:    stylesPart,
+			Message: "document language is not set in the default run properties or docProps/core.xml",
+		})
+	}
+	return issues, nil
+}
+
+// CheckAccessibilityFile 打开docx并检查
+func (s DocTrim) CheckAccessibilityFile(url string) ([]AccessibilityIssue, error) {
+	pkg, err := s.OpenPackage(url)
+	if err != nil {
+		return nil, err
+	}
+	return CheckPackageAccessibility(pkg)
+}
+
+// documentLanguage 返回缺省run属性中的w:lang，没有时返回core.xml中的dc:language
+func documentLanguage(pkg *Package, styles *Styles) (string, error) {
+	if styles != nil && styles.docRPr != nil {
+		if lang := styles.docRPr.child("lang"); lang != nil {
+			for _, local := range []string{"val", "eastAsia", "bidi"} {
+				if v, _ := lang.attr(local); v != "" {
+					return v, nil
+				}
+			}
+		}
+	}
+	core, err := pkg.Part(corePart)
+	if err != nil || core == nil {
+		return "", err
+	}
+	if lang := core.child("language"); lang != nil {
+		return strings.TrimSpace(string(lang.Content)), nil
+	}
+	return "", nil
+}
+
+type accessibilityAudit struct {
+	styles *Styles
+	issues []AccessibilityIssue
+	// heading 上一个标题的级别，还没有标题时为-1
+	heading int
+	// empty 同一父节点下连续的空段落
+	empty       []string
+	emptyParent *Node
+}
+
+func (a *accessibilityAudit) add(rule, path, message string) {
+	a.issues = append(a.issues, AccessibilityIssue{Rule: rule, Path: path, Message: message})
+}
+
+// walk 按文档顺序检查节点
+func (a *accessibilityAudit) walk(node *Node, path string) {
+	switch node.XMLName.Space {
+	case nsDrawing:
+		if node.XMLName.Local == "docPr" {
+			a.docPr(node, path)
+		}
+	case nsVML:
+		if node.XMLName.Local == "shape" && node.child("imagedata") != nil {
+			if alt, _ := node.attr("alt"); strings.TrimSpace(alt) == "" {
+				a.add(AccessibilityAltText, path, "picture has no alternative text")
+			}
+		}
+	case nsWord:
+		switch node.XMLName.Local {
+		case "p":
+			a.paragraph(node, path)
+		case "tbl":
+			a.flushEmpty()
+			a.table(node, path)
+		case "tc":
+			// 单元格中至少要有一个段落，空单元格不算排版用的空段落
+			a.flushEmpty()
+		}
+	}
+	for i, childPath := range childPaths(node, path) {
+		if child := node.Children[i]; child.XMLName.Space == nsWord && child.XMLName.Local == "p" && a.emptyParent != node {
+			a.flushEmpty()
+			a.emptyParent = node
+		}
+		a.walk(node.Children[i], childPath)
+	}
+	if node.XMLName.Space == nsWord && node.XMLName.Local == "tc" {
+		a.empty = nil
+	}
+}
+
+// docPr 检查DrawingML图形的替代文字，标记为装饰性的图形不需要
+func (a *accessibilityAudit) docPr(node *Node, path string) {
+	if descr, _ := node.attr("descr"); strings.TrimSpace(descr) != "" {
+		return
+	}
+	if isDecorative(node) {
+		return
+	}
+	name, _ := node.attr("name")
+	a.add(AccessibilityAltText, path, fmt.Sprintf("drawing %q has no alternative text (wp:docPr descr)", name))
+}
+
+// isDecorative 判断wp:docPr的扩展中是否有取值为真的decorative标记
+func isDecorative(node *Node) bool {
+	found := false
+	var walk func(node *Node)
+	walk = func(node *Node) {
+		if node.XMLName.Space == nsDecorative && node.XMLName.Local == "decorative" {
+			if v, ok := node.attr("val"); !ok || v == "1" || v == "true" {
+				found = true
+			}
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(node)
+	return found
+}
+
+// paragraph 检查标题层级和只用颜色区分的文字，记录连续的空段落
+func (a *accessibilityAudit) paragraph(p *Node, path string) {
+	if level := headingLevel(p, a.styles); level >= 0 {
+		if a.heading >= 0 && level > a.heading+1 {
+			a.add(AccessibilityHeadingLevels, path, fmt.Sprintf("heading level %d follows level %d", level+1, a.heading+1))
+		}
+		a.heading = level
+	}
+
+	_, text := paragraphSegments(p, path)
+	if strings.TrimSpace(text) == "" && !hasParagraphContent(p) {
+		a.empty = append(a.empty, path)
+		return
+	}
+	a.flushEmpty()
+	a.colorOnly(p, path)
+}
+
+// paragraphContentElements 没有文字也有内容的段落元素
+var paragraphContentElements = map[string]bool{
+	"drawing": true, "pict": true, "object": true, "sectPr": true, "fldSimple": true,
+	"fldChar": true, "oMath": true, "oMathPara": true, "sym": true, "footnoteReference": true,
+	"endnoteReference": true, "separator": true, "continuationSeparator": true,
+}
+
+// hasParagraphContent 判断空段落中是否有图形、分节、分页等内容
+func hasParagraphContent(node *Node) bool {
+	for _, child := range node.Children {
+		if paragraphContentElements[child.XMLName.Local] {
+			return true
+		}
+		if child.XMLName.Local == "br" {
+			if t, _ := child.attr("type"); t == "page" || t == "column" {
+				return true
+			}
+		}
+		if hasParagraphContent(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// flushEmpty 报告记录的连续空段落
+func (a *accessibilityAudit) flushEmpty() {
+	if len(a.empty) == 0 {
+		return
+	}
+	message := "empty paragraph used for spacing, use paragraph spacing instead"
+	if len(a.empty) > 1 {
+		message = fmt.Sprintf("%d consecutive empty paragraphs used for spacing, use paragraph spacing instead", len(a.empty))
+	}
+	a.add(AccessibilityEmptyParagraphs, a.empty[0], message)
+	a.empty = nil
+}
+
+// table 检查表格的第一行是否标记为标题行，只有一行的表格不检查
+func (a *accessibilityAudit) table(tbl *Node, path string) {
+	rows := []*Node{}
+	for _, child := range tbl.Children {
+		if child.XMLName.Local == "tr" {
+			rows = append(rows, child)
+		}
+	}
+	if len(rows) < 2 {
+		return
+	}
+	if trPr := rows[0].child("trPr"); trPr != nil && trPr.child("tblHeader") != nil && propOn(trPr.child("tblHeader")) {
+		return
+	}
+	a.add(AccessibilityTableHeader, path, "table has no header row (w:tblHeader)")
+}
+
+// emphasisToggles 除颜色外能区分文字的开关属性
+var emphasisToggles = []string{"b", "i", "strike", "dstrike", "caps", "smallCaps"}
+
+// colorOnly 报告段落中直接设置了颜色、与其他文字只有颜色不同的run
+// 整段都是同一种颜色时不是用颜色区分内容，不报告
+func (a *accessibilityAudit) colorOnly(p *Node, path string) {
+	colored := []string{}
+	colors := []string{}
+	plain := false
+	var walk func(node *Node, path string)
+	walk = func(node *Node, path string) {
+		for i, childPath := range childPaths(node, path) {
+			child := node.Children[i]
+			if child.XMLName.Space != nsWord || child.XMLName.Local == "p" {
+				continue
+			}
+			if child.XMLName.Local != "r" {
+				walk(child, childPath)
+				continue
+			}
+			if !runHasText(child) {
+				continue
+			}
+			if color := runColor(child); color == "" {
+				plain = true
+			} else if !hasEmphasis(child) {
+				colored = append(colored, childPath)
+				colors = append(colors, color)
+			}
+		}
+	}
+	walk(p, path)
+	if !plain {
+		return
+	}
+	for i, runPath := range colored {
+		a.add(AccessibilityColorOnly, runPath, fmt.Sprintf("text is distinguished only by colour #%s", colors[i]))
+	}
+}
+
+// runHasText 判断run是否有非空白文字
+func runHasText(r *Node) bool {
+	for _, c := range r.Children {
+		if c.XMLName.Local == "t" && strings.TrimSpace(string(c.Content)) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// runColor 返回run直接设置的颜色，自动颜色和黑色返回空串
+func runColor(r *Node) string {
+	rPr := r.child("rPr")
+	if rPr == nil || rPr.child("color") == nil {
+		return ""
+	}
+	v, _ := rPr.child("color").attr("val")
+	if strings.EqualFold(v, "auto") || v == "000000" {
+		return ""
+	}
+	return v
+}
+
+// hasEmphasis 判断run是否直接设置了颜色之外的强调格式：加粗、倾斜、删除线、大写、下划线、突出显示、底纹或边框
+func hasEmphasis(r *Node) bool {
+	rPr := r.child("rPr")
+	for _, local := range emphasisToggles {
+		if prop := rPr.child(local); prop != nil && propOn(prop) {
+			return true
+		}
+	}
+	for _, local := range []string{"u", "highlight", "bdr"} {
+		if prop := rPr.child(local); prop != nil {
+			if v, _ := prop.attr("val"); v != "none" && v != "nil" {
+				return true
+			}
+		}
+	}
+	if shd := rPr.child("shd"); shd != nil {
+		if fill, _ := shd.attr("fill"); fill != "" && !strings.EqualFold(fill, "auto") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+package DocTrim
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+func TestCheckAccessibility(t *testing.T) {
+	heading := func(level, text string) string {
+		return `<w:p><w:pPr><w:pStyle w:val="Heading` + level + `"/></w:pPr><w:r><w:t>` + text + `</w:t></w:r></w:p>`
+	}
+	drawing := func(descr, ext string) string {
+		return `<w:p><w:r><w:drawing><wp:inline><wp:docPr id="1" name="Picture 1" descr="` + descr + `">` + ext +
+			`</wp:docPr></wp:inline></w:drawing></w:r></w:p>`
+	}
+	row := `<w:tr><w:tc><w:p><w:r><w:t>cell</w:t></w:r></w:p></w:tc></w:tr>`
+	header := `<w:tr><w:trPr><w:tblHeader/></w:trPr><w:tc><w:p><w:r><w:t>head</w:t></w:r></w:p></w:tc></w:tr>`
+	src := `<w:document xmlns:w="` + nsWord + `" xmlns:wp="` + nsDrawing + `" xmlns:adec="` + nsDecorative + `"><w:body>` +
+		heading("1", "Exam") +
+		heading("3", "Part A") +
+		drawing("", "") +
+		drawing("A right triangle", "") +
+		drawing("", `<a:extLst xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main"><a:ext><adec:decorative val="1"/></a:ext></a:extLst>`) +
+		`<w:p><w:r><w:t>Correct answers are </w:t></w:r><w:r><w:rPr><w:color w:val="FF0000"/></w:rPr><w:t>red</w:t></w:r>` +
+		`<w:r><w:t> and </w:t></w:r><w:r><w:rPr><w:b/><w:color w:val="00FF00"/></w:rPr><w:t>bold green</w:t></w:r></w:p>` +
+		`<w:p><w:r><w:rPr><w:color w:val="1F4E79"/></w:rPr><w:t>A whole paragraph in blue.</w:t></w:r></w:p>` +
+		`<w:p/><w:p><w:r><w:rPr><w:b/></w:rPr></w:r></w:p>` +
+		`<w:tbl>` + row + row + `</w:tbl>` +
+		`<w:tbl>` + header + row + `</w:tbl>` +
+		`<w:p><w:r><w:br w:type="page"/></w:r></w:p>` +
+		heading("2", "Part B") +
+		`<w:sectPr/></w:body></w:document>`
+	var root Node
+	if err := xml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatal(err)
+	}
+
+	got := []string{}
+	for _, issue := range CheckAccessibility(&root, nil) {
+		got = append(got, issue.Rule+" "+issue.Path)
+	}
+	want := []string{
+		"heading-levels /w:document/w:body[1]/w:p[2]",
+		"alt-text /w:document/w:body[1]/w:p[3]/w:r[1]/w:drawing[1]/wp:inline[1]/wp:docPr[1]",
+		"color-only /w:document/w:body[1]/w:p[6]/w:r[2]",
+		"empty-paragraphs /w:document/w:body[1]/w:p[8]",
+		"table-header /w:document/w:body[1]/w:tbl[1]",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got issues:\n%s", strings.Join(got, "\n"))
+	}
+}
+
+func TestCheckAccessibilityFile(t *testing.T) {
+	issues, err := DocTrim{}.CheckAccessibilityFile("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := map[string]int{}
+	for _, issue := range issues {
+		rules[issue.Rule]++
+		if issue.Part == "" {
+			t.Errorf("%s: no part", issue)
+		}
+	}
+	// 样例中的公式是没有替代文字的OLE对象，也没有设置文档语言
+	if rules[AccessibilityAltText] != 5 || rules[AccessibilityLanguage] != 1 {
+		t.Errorf("got %v", rules)
+	}
+
+	pkg, _ := DocTrim{}.OpenPackage("docs/test.docx")
+	styles, _ := pkg.Part(stylesPart)
+	defaults := styles.child("docDefaults").child("rPrDefault").child("rPr")
+	lang := wordVal("lang", "zh-CN")
+	defaults.Children = append(defaults.Children, lang)
+	if err := pkg.SetPart(stylesPart, styles); err != nil {
+		t.Fatal(err)
+	}
+	issues, err = CheckPackageAccessibility(pkg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range issues {
+		if issue.Rule == AccessibilityLanguage {
+			t.Error("language set in docDefaults should be accepted")
+		}
+	}
+}
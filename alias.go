@@ -0,0 +1,250 @@
+// 元素名和属性名缩写
+// 去重之后，w:rFonts、w:eastAsia等限定名仍占Pack输出的很大比例
+// 别名表把常见的限定名映射为_0、_1这样的短代码，Unpack时展开
+// 短代码以下划线加数字开头，不会与OOXML中的名字以及_r、_h等内部标记冲突
+
+package DocTrim
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AliasMode 名字缩写方式
+type AliasMode int
+
+const (
+	// AliasNone 不缩写
+	AliasNone AliasMode = iota
+	// AliasBuiltin 使用内置的OOXML别名表，Unpack时同样需要指定
+	AliasBuiltin
+	// AliasDocument 按文档统计生成别名表，以<?alias ...?>头写在输出开头
+	AliasDocument
+)
+
+const aliasHeader = "<?alias"
+
+// AliasTable 限定名与短代码的双向映射
+type AliasTable struct {
+	names []string
+	codes map[string]string
+	index map[string]string
+}
+
+// NewAliasTable 按顺序为names分配短代码_0、_1、...
+// 越靠前的名字代码越短
+func NewAliasTable(names []string) *AliasTable {
+	t := &AliasTable{codes: map[string]string{}, index: map[string]string{}}
+	for _, name := range names {
+		if _, ok := t.codes[name]; ok {
+			continue
+		}
+		code := "_" + strconv.Itoa(len(t.names))
+		t.names = append(t.names, name)
+		t.codes[name] = code
+		t.index[code] = name
+	}
+	return t
+}
+
+// BuiltinAliases 内置的OOXML别名表，按常见文档中的字节占比排序
+var BuiltinAliases = NewAliasTable([]string{
+	"w:val", "w:rFonts", "w:ascii", "w:hAnsi", "w:eastAsia", "w:rPr", "w:szCs", "xml:space", "w:hint", "w:spacing",
+	"w:color", "w:lang", "w:pPr", "w:lineRule", "w:position", "w:widowControl", "w:instrText", "w:hAnsiTheme", "w:eastAsiaTheme", "w:asciiTheme",
+	"w:cstheme", "w:themeColor", "w:line", "w:ind", "w:pBdr", "w:caps", "w:firstLine", "w:firstLineChars", "w:before", "w:after",
+	"w:beforeLines", "w:afterLines", "w:beforeAutospacing", "w:afterAutospacing", "w:hanging", "w:hangingChars", "w:left", "w:right", "w:leftChars", "w:rightChars",
+	"w:snapToGrid", "w:keepNext", "w:keepLines", "w:pageBreakBefore", "w:textAlignment", "w:adjustRightInd", "w:autoSpaceDE", "w:autoSpaceDN", "w:kinsoku", "w:overflowPunct",
+	"w:wordWrap", "w:topLinePunct", "w:vertAlign", "w:highlight", "w:bookmarkStart", "w:bookmarkEnd", "w:fldChar", "w:fldCharType", "w:pStyle", "w:rStyle",
+	"w:numPr", "w:numId", "w:ilvl", "w:tabs", "w:kern", "w:shd", "w:fill", "w:tblPr", "w:tblW", "w:tblGrid",
+	"w:gridCol", "w:tcPr", "w:tcW", "w:trPr", "w:vAlign", "w:gridSpan", "w:vMerge", "w:tcBorders", "w:tblBorders", "w:insideH",
+	"w:insideV", "w:bottom", "w:top", "w:space", "w:type", "w:sdtContent", "w:sdtPr", "w:placeholder", "w:drawing", "w:object",
+	"w:dxaOrig", "w:dyaOrig", "w:noProof", "w:rsidR", "w:rsidRPr", "w:rsidRDefault", "w:rsidP", "w:proofErr", "w:lastRenderedPageBreak", "w:framePr",
+	"mc:AlternateContent", "mc:Choice", "mc:Fallback", "mc:Requires", "wp:inline", "wp:anchor", "wp:extent", "wp:effectExtent", "wp:docPr", "wp:cNvGraphicFramePr",
+	"a:graphic", "a:graphicData", "a:graphicFrameLocks", "a:noChangeAspect", "a:prstGeom", "a:avLst", "a:noFill", "a:xfrm", "a:ext", "a:off",
+	"pic:pic", "pic:nvPicPr", "pic:cNvPr", "pic:cNvPicPr", "pic:blipFill", "pic:spPr", "a:blip", "a:stretch", "a:fillRect", "r:embed",
+	"v:shape", "v:shapetype", "v:imagedata", "v:formulas", "v:stroke", "v:path", "o:OLEObject", "o:preferrelative", "o:extrusionok", "o:connecttype",
+	"o:title", "o:spid", "o:spt", "o:lock", "v:ext", "r:id", "w14:paraId", "w14:textId", "w15:appearance", "w14:textFill",
+	"m:oMath", "m:oMathPara", "m:rPr", "m:sty", "m:sSup", "m:sSub", "m:sSubSup", "m:sup", "m:sub", "m:num",
+	"m:den", "m:fPr", "m:dPr", "m:ctrlPr", "m:rad",
+})
+
+// Names 返回按代码顺序排列的限定名
+func (t *AliasTable) Names() []string {
+	return append([]string{}, t.names...)
+}
+
+// Code 返回限定名对应的短代码
+func (t *AliasTable) Code(name string) (string, bool) {
+	code, ok := t.codes[name]
+	return code, ok
+}
+
+// Name 返回短代码对应的限定名
+func (t *AliasTable) Name(code string) (string, bool) {
+	name, ok := t.index[code]
+	return name, ok
+}
+
+// aliasable 只缩写带前缀的限定名，名字空间声明保持原样
+func aliasable(name string) bool {
+	return strings.Contains(name, ":") && !strings.HasPrefix(name, "xmlns")
+}
+
+// DocumentAliases 统计data中标签和属性的限定名，为能节省字节的名字生成别名表
+// 节省的字节数需超过该名字在头中占用的长度
+func DocumentAliases(data []byte) *AliasTable {
+	counts := map[string]int{}
+	rewriteNames(data, func(name string) string {
+		if aliasable(name) {
+			counts[name]++
+		}
+		return name
+	})
+
+	names := make([]string, 0, len(counts))
+	for name := range counts {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		li, lj := counts[names[i]]*len(names[i]), counts[names[j]]*len(names[j])
+		if li != lj {
+			return li > lj
+		}
+		return names[i] < names[j]
+	})
+
+	selected := []string{}
+	for _, name := range names {
+		code := "_" + strconv.Itoa(len(selected))
+		saved := counts[name] * (len(name) - len(code))
+		if saved > len(code)+len(name)+2 {
+			selected = append(selected, name)
+		}
+	}
+	return NewAliasTable(selected)
+}
+
+// Abbreviate 将data中的限定名替换为短代码，返回替换结果和每个名字节省的字节数
+func (t *AliasTable) Abbreviate(data []byte) ([]byte, map[string]int) {
+	saved := map[string]int{}
+	out := rewriteNames(data, func(name string) string {
+		code, ok := t.codes[name]
+		if !ok || len(code) >= len(name) {
+			return name
+		}
+		saved[name] += len(name) - len(code)
+		return code
+	})
+	return out, saved
+}
+
+// Expand 将data中的短代码还原为限定名
+func (t *AliasTable) Expand(data []byte) []byte {
+	return rewriteNames(data, func(name string) string {
+		if n, ok := t.index[name]; ok {
+			return n
+		}
+		return name
+	})
+}
+
+// Header 生成写在输出开头的别名表
+func (t *AliasTable) Header() []byte {
+	var b bytes.Buffer
+	b.WriteString(aliasHeader)
+	for _, name := range t.names {
+		b.WriteString(" " + t.codes[name] + "=" + name)
+	}
+	b.WriteString("?>")
+	return b.Bytes()
+}
+
+// ParseAliasHeader 解析data开头的别名表，返回别名表和去掉头之后的数据
+// 没有别名表时返回nil和原数据
+func ParseAliasHeader(data []byte) (*AliasTable, []byte, error) {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	if !bytes.HasPrefix(trimmed, []byte(aliasHeader)) {
+		return nil, data, nil
+	}
+	end := bytes.Index(trimmed, []byte("?>"))
+	if end < 0 {
+		return nil, data, fmt.Errorf("unterminated alias header")
+	}
+	fields := strings.Fields(string(trimmed[len(aliasHeader):end]))
+	names := make([]string, len(fields))
+	for i, field := range fields {
+		code, name, ok := strings.Cut(field, "=")
+		if !ok || code != "_"+strconv.Itoa(i) {
+			return nil, data, fmt.Errorf("invalid alias entry: %s", field)
+		}
+		names[i] = name
+	}
+	return NewAliasTable(names), trimmed[end+2:], nil
+}
+
+// rewriteNames 依次对标签名和属性名调用fn，用返回值替换
+// 文本内容、属性值、处理指令和注释保持原样
+func rewriteNames(data []byte, fn func(name string) string) []byte {
+	out := make([]byte, 0, len(data))
+	i := 0
+	for i < len(data) {
+		lt := bytes.IndexByte(data[i:], '<')
+		if lt < 0 {
+			out = append(out, data[i:]...)
+			break
+		}
+		out = append(out, data[i:i+lt+1]...)
+		i += lt + 1
+		if i < len(data) && (data[i] == '?' || data[i] == '!') {
+			gt := bytes.IndexByte(data[i:], '>')
+			if gt < 0 {
+				gt = len(data) - i - 1
+			}
+			out = append(out, data[i:i+gt+1]...)
+			i += gt + 1
+			continue
+		}
+		if i < len(data) && data[i] == '/' {
+			out = append(out, '/')
+			i++
+		}
+
+		// 标签名
+		start := i
+		for i < len(data) && isNameByte(data[i]) {
+			i++
+		}
+		out = append(out, fn(string(data[start:i]))...)
+
+		// 属性
+		for i < len(data) && data[i] != '>' {
+			switch c := data[i]; {
+			case c == '"' || c == '\'':
+				end := bytes.IndexByte(data[i+1:], c)
+				if end < 0 {
+					end = len(data) - i - 2
+				}
+				out = append(out, data[i:i+end+2]...)
+				i += end + 2
+			case isNameByte(c):
+				start := i
+				for i < len(data) && isNameByte(data[i]) {
+					i++
+				}
+				out = append(out, fn(string(data[start:i]))...)
+			default:
+				out = append(out, c)
+				i++
+			}
+		}
+	}
+	return out
+}
+
+func isNameByte(c byte) bool {
+	return c == ':' || c == '_' || c == '-' || c == '.' ||
+		('0' <= c && c <= '9') || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c >= 0x80
+}
@@ -0,0 +1,76 @@
+package DocTrim
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+)
+
+func TestAliasTable(t *testing.T) {
+	src := []byte(`<w:p><w:r><w:rPr><w:rFonts w:ascii="w:rFonts" w:hint="eastAsia"/></w:rPr>` +
+		`<w:t xml:space="preserve">w:rFonts &lt;w:rFonts&gt;</w:t></w:r></w:p>`)
+	table := NewAliasTable([]string{"w:rFonts", "w:ascii", "xml:space", "w:t"})
+
+	short, saved := table.Abbreviate(src)
+	want := `<w:p><w:r><w:rPr><_0 _1="w:rFonts" w:hint="eastAsia"/></w:rPr>` +
+		`<_3 _2="preserve">w:rFonts &lt;w:rFonts&gt;</_3></w:r></w:p>`
+	if string(short) != want {
+		t.Errorf("got %s", short)
+	}
+	if saved["w:rFonts"] != 6 || saved["w:t"] != 2 {
+		t.Errorf("unexpected savings %v", saved)
+	}
+	if back := table.Expand(short); !bytes.Equal(back, src) {
+		t.Errorf("expand got %s", back)
+	}
+
+	parsed, rest, err := ParseAliasHeader(append(table.Header(), short...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, short) || len(parsed.Names()) != 4 {
+		t.Errorf("header not parsed: %v", parsed.Names())
+	}
+	if name, _ := parsed.Name("_2"); name != "xml:space" {
+		t.Errorf("_2 -> %s", name)
+	}
+}
+
+func TestPackAliases(t *testing.T) {
+	data, err := os.ReadFile("docs/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := (&DocTrim{}).Pack(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mode := range []AliasMode{AliasBuiltin, AliasDocument} {
+		s := DocTrim{Aliases: mode}
+		short, err := s.Pack(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		total := 0
+		for _, n := range s.AliasSavings() {
+			total += n
+		}
+		log.Printf("alias mode %d: %d -> %d, w:rFonts saved %d", mode, len(plain), len(short), s.AliasSavings()["w:rFonts"])
+		if len(short) >= len(plain) || s.AliasSavings()["w:rFonts"] == 0 {
+			t.Errorf("mode %d did not shrink output: %d >= %d", mode, len(short), len(plain))
+		}
+		if mode == AliasBuiltin && len(plain)-len(short) != total {
+			t.Errorf("savings %d do not match size change %d", total, len(plain)-len(short))
+		}
+
+		to, err := s.Unpack(bytes.NewReader(short))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !EqualXml(data, to) {
+			t.Errorf("mode %d: Not equals", mode)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+// 文档分块
+// 长文档整体打包后超出上下文窗口，直接切分又会让_r引用找不到其他块中的_h定义
+// Chunk在标题、分节、段落和表格边界切分正文，每块单独打包，引用只指向块内的定义，可以用UnpackChunk独立还原；
+// 超出预算的表格按行切分，表头行在每块中重复
+// 每块记录所在的标题路径和对应的源节点范围，便于检索结果回溯到原文
+
+package DocTrim
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nbio/xml"
+)
+
+// defaultChunkBudget 缺省的分块预算
+const defaultChunkBudget = 4096
+
+// ChunkOptions 分块选项
+type ChunkOptions struct {
+	// Budget 每块打包后的最大长度，按Measure计量，缺省为4096
+	// 单个段落超出预算时独占一块，Size会大于Budget
+	Budget int
+	// Measure 计量函数，缺省按DocTrim.Tokenizer计量，按token设置预算时可以使用DefaultTokenizer().Count
+	Measure func(data []byte) int
+	// Styles 样式表，用于按样式的大纲级别识别标题，为nil时只识别直接设置的大纲级别和标题样式名
+	Styles *Styles
+}
+
+// Chunk 一个分块
+type Chunk struct {
+	Index int `json:"index"`
+	// Breadcrumbs 块开始处所在的各级标题
+	Breadcrumbs []string `json:"breadcrumbs"`
+	// First、Last 块中第一个和最后一个块级元素在w:body中的下标
+	First int `json:"first"`
+	Last  int `json:"last"`
+	// Start、End 块中第一个和最后一个源节点的路径，表格按行切分时为行的路径
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Size 打包后的长度，按Measure计量
+	Size int    `json:"size"`
+	Data []byte `json:"-"`
+
+	// math MathToLatex时本块公式的原始子树，序号只在块内有效
+	math map[uint64]mathSource
+}
+
+// chunkUnit 分块的最小单位：一个块级元素，或按行切分的表格中的一组行
+type chunkUnit struct {
+	block  *Node
+	index  int
+	path   string
+	table  *Node
+	header []*Node
+	size   int
+	// heading 标题级别，从0开始，不是标题时为-1
+	heading    int
+	sectionEnd bool
+	crumbs     []string
+}
+
+// headingStyleRe 内置标题样式的名字
+var headingStyleRe = regexp.MustCompile(`(?i)^(heading|标题)\s*([1-9])$`)
+
+// headingLevel 返回段落的标题级别，从0开始，不是标题时返回-1
+func headingLevel(p *Node, styles *Styles) int {
+	if p.XMLName.Local != "p" || p.XMLName.Space != nsWord {
+		return -1
+	}
+	pPr := p.child("pPr")
+	props := pPr
+	if styles != nil {
+		props = styles.ParagraphProps(p)
+	}
+	if props != nil {
+		if lvl := props.child("outlineLvl"); lvl != nil {
+			v, _ := lvl.attr("val")
+			// 9表示正文级别
+			if n, err := strconv.Atoi(v); err == nil && n < 9 {
+				return n
+			}
+		}
+	}
+	if pPr != nil {
+		if style := pPr.child("pStyle"); style != nil {
+			v, _ := style.attr("val")
+			if m := headingStyleRe.FindStringSubmatch(v); m != nil {
+				n, _ := strconv.Atoi(m[2])
+				return n - 1
+			}
+		}
+	}
+	return -1
+}
+
+// Chunk 将文档切分为预算内可以独立还原的块，root不会被修改
+func (slim *DocTrim) Chunk(root *Node, opts ChunkOptions) ([]Chunk, error) {
+	if opts.Budget <= 0 {
+		opts.Budget = defaultChunkBudget
+	}
+	if opts.Measure == nil {
+		opts.Measure = slim.measure
+	}
+	body := root.child("body")
+	if body == nil {
+		return nil, nil
+	}
+	c := &chunker{slim: slim, opts: opts, root: root, body: body}
+	units := c.units()
+
+	chunks := []Chunk{}
+	for _, group := range c.group(units) {
+		packed, err := c.pack(group)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, packed...)
+	}
+	for i := range chunks {
+		chunks[i].Index = i
+	}
+	return chunks, nil
+}
+
+// ChunkFile 打开docx并切分主文档，opts.Styles为nil时使用文档的样式表，打包需要样式表时也使用它
+func (s DocTrim) ChunkFile(url string, opts ChunkOptions) ([]Chunk, error) {
+	pkg, err := s.OpenPackage(url)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := pkg.Part(documentPart)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Styles == nil {
+		if opts.Styles, err = pkg.Styles(); err != nil {
+			return nil, err
+		}
+	}
+	if s.needsStyles() {
+		s.Styles = opts.Styles
+	}
+	return s.Chunk(doc, opts)
+}
+
+type chunker struct {
+	slim *DocTrim
+	opts ChunkOptions
+	root *Node
+	body *Node
+}
+
+// measure 返回节点序列化后的长度，独立序列化会带上命名空间声明，估计值偏大
+func (c *chunker) measure(node *Node) int {
+	data, _ := node.Marshal()
+	return c.opts.Measure(data)
+}
+
+// units 将正文拆分为分块单位并计算标题路径
+func (c *chunker) units() []chunkUnit {
+	rootPath := "/" + qualifiedName(c.root)
+	bodyPath := rootPath
+	for i, path := range childPaths(c.root, rootPath) {
+		if c.root.Children[i] == c.body {
+			bodyPath = path
+		}
+	}
+
+	units := []chunkUnit{}
+	crumbs := []string{}
+	paths := childPaths(c.body, bodyPath)
+	for i, block := range c.body.Children {
+		if block.XMLName.Local == "sectPr" {
+			continue
+		}
+		u := chunkUnit{block: block, index: i, path: paths[i], heading: headingLevel(block, c.opts.Styles)}
+		if u.heading >= 0 {
+			_, text := paragraphSegments(block, "")
+			crumbs = append(crumbs[:min(u.heading, len(crumbs))], strings.TrimSpace(text))
+		}
+		if pPr := block.child("pPr"); block.XMLName.Local == "p" && pPr != nil && pPr.child("sectPr") != nil {
+			u.sectionEnd = true
+		}
+		u.crumbs = append([]string{}, crumbs...)
+		u.size = c.measure(block)
+
+		if block.XMLName.Local == "tbl" && u.size > c.opts.Budget {
+			units = append(units, c.tableUnits(u)...)
+			continue
+		}
+		units = append(units, u)
+	}
+	return units
+}
+
+// tableUnits 将超出预算的表格按行拆分，开头标记为tblHeader的行作为表头
+func (c *chunker) tableUnits(u chunkUnit) []chunkUnit {
+	units := []chunkUnit{}
+	header := []*Node{}
+	paths := childPaths(u.block, u.path)
+	for i, row := range u.block.Children {
+		if row.XMLName.Local != "tr" {
+			continue
+		}
+		if trPr := row.child("trPr"); len(units) == 0 && trPr != nil && trPr.child("tblHeader") != nil && propOn(trPr.child("tblHeader")) {
+			header = append(header, row)
+			continue
+		}
+		units = append(units, chunkUnit{block: row, index: u.index, path: paths[i], table: u.block, size: c.measure(row), heading: -1, crumbs: u.crumbs})
+	}
+	for i := range units {
+		units[i].header = header
+	}
+	return units
+}
+
+// cost 返回将u追加到prev之后增加的长度，表格片段的第一行还要计入表格属性和表头
+func (c *chunker) cost(prev *chunkUnit, u chunkUnit) int {
+	if u.table == nil || (prev != nil && prev.table == u.table) {
+		return u.size
+	}
+	size := u.size
+	for _, child := range u.table.Children {
+		if child.XMLName.Local != "tr" {
+			size += c.measure(child)
+		}
+	}
+	for _, row := range u.header {
+		size += c.measure(row)
+	}
+	return size
+}
+
+// group 按预算将单位分组，超出预算时优先在后半部分最后一个标题之前或分节之后切分
+func (c *chunker) group(units []chunkUnit) [][]chunkUnit {
+	overhead := c.opts.Measure([]byte("<w:document><w:body></w:body></w:document>"))
+	groups := [][]chunkUnit{}
+	cur := []chunkUnit{}
+	size := overhead
+	total := func(units []chunkUnit) int {
+		size := overhead
+		for i, u := range units {
+			var prev *chunkUnit
+			if i > 0 {
+				prev = &units[i-1]
+			}
+			size += c.cost(prev, u)
+		}
+		return size
+	}
+
+	for _, u := range units {
+		var prev *chunkUnit
+		if len(cur) > 0 {
+			prev = &cur[len(cur)-1]
+		}
+		if len(cur) > 0 && size+c.cost(prev, u) > c.opts.Budget {
+			cut := len(cur)
+			for k := len(cur) - 1; k >= len(cur)/2 && k > 0; k-- {
+				if cur[k].heading >= 0 || cur[k-1].sectionEnd {
+					cut = k
+					break
+				}
+			}
+			groups = append(groups, cur[:cut])
+			cur = append([]chunkUnit{}, cur[cut:]...)
+			size = total(cur)
+			prev = nil
+			if len(cur) > 0 {
+				prev = &cur[len(cur)-1]
+			}
+		}
+		size += c.cost(prev, u)
+		cur = append(cur, u)
+	}
+	if len(cur) > 0 {
+		groups = append(groups, cur)
+	}
+	return groups
+}
+
+// pack 打包一组单位，估计偏小导致超出预算时对半拆分
+func (c *chunker) pack(units []chunkUnit) ([]Chunk, error) {
+	doc := c.document(units)
+	data, err := c.slim.PackNode(doc)
+	if err != nil {
+		return nil, err
+	}
+	size := c.opts.Measure(data)
+	if size > c.opts.Budget && len(units) > 1 {
+		left, err := c.pack(units[:len(units)/2])
+		if err != nil {
+			return nil, err
+		}
+		right, err := c.pack(units[len(units)/2:])
+		return append(left, right...), err
+	}
+
+	first, last := units[0], units[len(units)-1]
+	return []Chunk{{
+		Breadcrumbs: first.crumbs,
+		First:       first.index,
+		Last:        last.index,
+		Start:       first.path,
+		End:         last.path,
+		Size:        size,
+		Data:        data,
+		// PackNode每次重建mathDict，这里保存的是本块的公式
+		math: c.slim.mathDict,
+	}}, nil
+}
+
+// UnpackChunk 还原一个分块，公式按本块的原始子树还原
+// 块的公式序号相互重叠，不能用Chunk之后的DocTrim直接Unpack
+func (s DocTrim) UnpackChunk(c Chunk) ([]byte, error) {
+	s.mathDict = c.math
+	return s.Unpack(bytes.NewReader(c.Data))
+}
+
+// document 用单位的副本组成独立的文档，同一表格的连续行合并为一个表格
+func (c *chunker) document(units []chunkUnit) *Node {
+	body := &Node{XMLName: c.body.XMLName, Attrs: append([]xml.Attr{}, c.body.Attrs...)}
+	var table, tbl *Node
+	for _, u := range units {
+		if u.table == nil {
+			table = nil
+			body.Children = append(body.Children, u.block.clone())
+			continue
+		}
+		if u.table != table {
+			table = u.table
+			tbl = &Node{XMLName: table.XMLName, Attrs: append([]xml.Attr{}, table.Attrs...)}
+			for _, child := range table.Children {
+				if child.XMLName.Local != "tr" {
+					tbl.Children = append(tbl.Children, child.clone())
+				}
+			}
+			for _, row := range u.header {
+				tbl.Children = append(tbl.Children, row.clone())
+			}
+			body.Children = append(body.Children, tbl)
+		}
+		tbl.Children = append(tbl.Children, u.block.clone())
+	}
+	return &Node{XMLName: c.root.XMLName, Attrs: append([]xml.Attr{}, c.root.Attrs...), Children: []*Node{body}}
+}
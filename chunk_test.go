@@ -0,0 +1,161 @@
+package DocTrim
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+func TestChunk(t *testing.T) {
+	data, _ := os.ReadFile("docs/document.xml")
+	var root Node
+	if err := xml.Unmarshal(data, &root); err != nil {
+		t.Fatal(err)
+	}
+	const budget = 100000
+	slim := DocTrim{}
+	chunks, err := slim.Chunk(&root, ChunkOptions{Budget: budget})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks", len(chunks))
+	}
+
+	body := root.child("body")
+	next := 0
+	for _, c := range chunks {
+		if c.Size > budget && c.First != c.Last {
+			t.Errorf("chunk %d: size %d exceeds budget", c.Index, c.Size)
+		}
+		if c.First != next {
+			t.Errorf("chunk %d starts at %d, want %d", c.Index, c.First, next)
+		}
+		next = c.Last + 1
+
+		// 每块单独还原，内容与源节点相同
+		unpacked, err := slim.UnpackChunk(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc Node
+		if err := xml.Unmarshal(unpacked, &doc); err != nil {
+			t.Fatal(err)
+		}
+		blocks := doc.child("body").Children
+		if len(blocks) != c.Last-c.First+1 {
+			t.Fatalf("chunk %d: got %d blocks", c.Index, len(blocks))
+		}
+		for i, b := range blocks {
+			if !NodeEquals(b, body.Children[c.First+i]) {
+				t.Errorf("chunk %d: block %d differs", c.Index, c.First+i)
+			}
+		}
+	}
+	if next != len(body.Children)-1 {
+		t.Errorf("chunks cover %d blocks, want %d", next, len(body.Children)-1)
+	}
+}
+
+func TestChunkHeadingsAndTables(t *testing.T) {
+	n := 0
+	filler := func() string {
+		n++
+		return strings.Repeat("clause "+strconv.Itoa(n)+" ", 25)
+	}
+	para := func(text string) string {
+		return `<w:p><w:r><w:t>` + text + `</w:t></w:r></w:p>`
+	}
+	heading := func(level, text string) string {
+		return `<w:p><w:pPr><w:pStyle w:val="Heading` + level + `"/></w:pPr><w:r><w:t>` + text + `</w:t></w:r></w:p>`
+	}
+	row := func(text string) string {
+		return `<w:tr><w:tc><w:p><w:r><w:t>` + text + `</w:t></w:r></w:p></w:tc></w:tr>`
+	}
+	rows := `<w:tr><w:trPr><w:tblHeader/></w:trPr><w:tc><w:p><w:r><w:t>Header</w:t></w:r></w:p></w:tc></w:tr>`
+	for i := 0; i < 12; i++ {
+		rows += row(filler())
+	}
+	src := `<w:document xmlns:w="` + nsWord + `"><w:body>` +
+		heading("1", "Contract") + para(filler()) +
+		heading("2", "Payment") + para(filler()) + para(filler()) +
+		heading("2", "Schedule") + `<w:tbl><w:tblPr/><w:tblGrid/>` + rows + `</w:tbl>` +
+		`<w:sectPr/></w:body></w:document>`
+	var root Node
+	if err := xml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatal(err)
+	}
+
+	chunks, err := (&DocTrim{}).Chunk(&root, ChunkOptions{Budget: 1500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := chunks[len(chunks)-1]
+	if got := strings.Join(last.Breadcrumbs, " > "); got != "Contract > Schedule" {
+		t.Errorf("got breadcrumbs %q", got)
+	}
+	if !strings.HasPrefix(last.Start, "/w:document/w:body[1]/w:tbl[1]/w:tr[") {
+		t.Errorf("table should be split by rows, got %s", last.Start)
+	}
+	// 标题之前切分，第二级标题开始新的块
+	found := false
+	for _, c := range chunks {
+		if c.First == 2 && strings.Join(c.Breadcrumbs, " > ") == "Contract > Payment" {
+			found = true
+		}
+		if c.Size > 1500 {
+			t.Errorf("chunk %d: size %d", c.Index, c.Size)
+		}
+	}
+	if !found {
+		t.Error("no chunk starts at the Payment heading")
+	}
+	// 按行切分的表格在每块中重复表头
+	if !bytes.Contains(last.Data, []byte("Header")) {
+		t.Error("header row should be repeated")
+	}
+}
+
+func TestChunkMath(t *testing.T) {
+	// 公式中的字体在LaTeX中没有对应，只有按原始子树还原才能保留
+	var src strings.Builder
+	src.WriteString(`<w:document xmlns:w="` + nsWord + `" xmlns:m="` + nsMath + `"><w:body>`)
+	for _, v := range []string{"a", "b", "c", "d"} {
+		src.WriteString(`<w:p><w:r><w:t>` + strings.Repeat("formula "+v+" ", 30) + `</w:t></w:r>` +
+			`<m:oMath><m:r><w:rPr><w:rFonts w:ascii="Cambria Math"/></w:rPr><m:t>` + v + `</m:t></m:r></m:oMath></w:p>`)
+	}
+	src.WriteString(`<w:sectPr/></w:body></w:document>`)
+	var root Node
+	if err := xml.Unmarshal([]byte(src.String()), &root); err != nil {
+		t.Fatal(err)
+	}
+
+	slim := DocTrim{MathToLatex: true}
+	chunks, err := slim.Chunk(&root, ChunkOptions{Budget: 400})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("got %d chunks", len(chunks))
+	}
+	body := root.child("body")
+	for _, c := range chunks {
+		unpacked, err := slim.UnpackChunk(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var doc Node
+		if err := xml.Unmarshal(unpacked, &doc); err != nil {
+			t.Fatal(err)
+		}
+		for i, b := range doc.child("body").Children {
+			if !NodeEquals(b, body.Children[c.First+i]) {
+				t.Errorf("chunk %d: block %d differs", c.Index, c.First+i)
+			}
+		}
+	}
+}
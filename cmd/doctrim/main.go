@@ -0,0 +1,679 @@
+// doctrim 命令行工具
+//
+//	doctrim [pack] [-text] [-revisions accept|reject|mark] file.docx|file.xml   精简主文档，或导出纯文本
+//	doctrim replace [-regex] [-o out.docx] file.docx pattern replacement
+//	doctrim fill [-images dir] -o out.docx template.docx data.json   用JSON数据填充模板
+//	doctrim redline [-author name] -o out.docx old.docx new.docx   以修订标记两个版本的差异
+//	doctrim diff [-json] [-ignore-order] [-ignore-space] [-ignore sectPr,...] a b   比较两个文档的XML结构
+//	doctrim cluster [-threshold 0.8] [-json] dir   将目录中内容相近的docx分组
+//	doctrim lint [-json] [-max-sizes 2] file.docx|file.xml   检查格式一致性，有问题时退出码为1
+//	doctrim a11y [-json] file.docx|file.xml   无障碍检查，有问题时退出码为1
+//	doctrim stats [-tokens] [-json] file.docx|file.xml   打包统计：长度、引用、重复子树、各元素长度和各阶段耗时
+//	doctrim sanitize [-keep comments,...] [-json] -o out.docx|out.xml file.docx   外发前清理，输出docx或打包后的XML
+//	doctrim redact [-names names.txt] [-text] -vault vault.json file.docx|file.xml   将个人信息替换为占位符，原文记入对照表
+//	doctrim restore [-text] -vault vault.json file.xml|file.txt   按对照表还原占位符
+//
+// 对照表的口令从环境变量DOCTRIM_VAULT_KEY读取，未设置时对照表以明文JSON保存
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	iofs "io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nbio/xml"
+	"github.com/nicedoc/DocTrim"
+)
+
+const usage = `usage:
+  doctrim [pack] [-text] [-revisions accept|reject|mark] file.docx|file.xml
+  doctrim replace [-regex] [-o out.docx] file.docx pattern replacement
+  doctrim fill [-images dir] -o out.docx template.docx data.json
+  doctrim redline [-author name] -o out.docx old.docx new.docx
+  doctrim diff [-json] [-ignore-order] [-ignore-space] [-ignore sectPr,...] a.docx|a.xml b.docx|b.xml
+  doctrim cluster [-threshold 0.8] [-json] dir
+  doctrim lint [-json] [-max-sizes 2] file.docx|file.xml
+  doctrim a11y [-json] file.docx|file.xml
+  doctrim stats [-tokens] [-json] file.docx|file.xml
+  doctrim sanitize [-keep comments,...] [-json] -o out.docx|out.xml file.docx
+  doctrim redact [-names names.txt] [-text] -vault vault.json file.docx|file.xml
+  doctrim restore [-text] -vault vault.json file.xml|file.txt
+`
+
+// commands 子命令，第一个参数不是子命令时按pack处理
+var commands = map[string]func(args []string) error{
+	"pack":     pack,
+	"replace":  replace,
+	"fill":     fill,
+	"redline":  redline,
+	"diff":     diff,
+	"cluster":  cluster,
+	"lint":     lint,
+	"a11y":     a11y,
+	"stats":    stats,
+	"sanitize": sanitize,
+	"redact":   redact,
+	"restore":  restore,
+}
+
+func main() {
+	log.SetFlags(0)
+	args := os.Args[1:]
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cmd, ok := commands[args[0]]
+	if ok {
+		args = args[1:]
+	} else {
+		cmd = pack
+	}
+	if err := cmd(args); err != nil {
+		log.Fatalf("doctrim: %v", err)
+	}
+}
+
+// revisionModes -revisions参数的取值
+var revisionModes = map[string]DocTrim.RevisionMode{
+	"":       DocTrim.RevisionsKeep,
+	"accept": DocTrim.RevisionsAccept,
+	"reject": DocTrim.RevisionsReject,
+	"mark":   DocTrim.RevisionsMark,
+}
+
+// newFlagSet 创建子命令的参数解析器
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	return fs
+}
+
+func pack(args []string) error {
+	fs := newFlagSet("pack")
+	text := fs.Bool("text", false, "导出纯文本")
+	revisions := fs.String("revisions", "", "接受(accept)、拒绝(reject)修订，或在文本中标记(mark)修订")
+	fs.Parse(args)
+	mode, ok := revisionModes[*revisions]
+	if fs.NArg() != 1 || !ok {
+		fs.Usage()
+		os.Exit(2)
+	}
+	f := fs.Arg(0)
+	s := DocTrim.DocTrim{PlainText: *text, Revisions: mode}
+
+	var data []byte
+	var err error
+	switch {
+	case strings.HasSuffix(f, ".docx"):
+		data, err = s.Process(f)
+	case strings.HasSuffix(f, ".xml"):
+		var file *os.File
+		if file, err = os.Open(f); err != nil {
+			return err
+		}
+		defer file.Close()
+		data, err = s.Pack(file)
+	default:
+		return fmt.Errorf("unsupported file type: %s", f)
+	}
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(data)
+	return nil
+}
+
+func replace(args []string) error {
+	fs := newFlagSet("replace")
+	regex := fs.Bool("regex", false, "pattern为正则表达式，replacement中可以使用$1引用分组")
+	out := fs.String("o", "", "输出文件，缺省覆盖输入文件")
+	fs.Parse(args)
+	if fs.NArg() != 3 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	in, pattern, replacement := fs.Arg(0), fs.Arg(1), fs.Arg(2)
+	if *out == "" {
+		*out = in
+	}
+
+	pkg, err := DocTrim.DocTrim{}.OpenPackage(in)
+	if err != nil {
+		return err
+	}
+	n, err := DocTrim.ReplacePackage(pkg, pattern, replacement, *regex)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := pkg.Write(&buf); err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	log.Printf("replaced %d", n)
+	return nil
+}
+
+func fill(args []string) error {
+	fs := newFlagSet("fill")
+	out := fs.String("o", "", "输出文件")
+	images := fs.String("images", "", "图片文件所在目录，数据中的图片路径相对该目录，不设置时图片只能是data URI")
+	fs.Parse(args)
+	if fs.NArg() != 2 || *out == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	tpl, err := DocTrim.DocTrim{}.OpenTemplate(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	tpl.ImageDir = *images
+	data, err := os.Open(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer data.Close()
+
+	var buf bytes.Buffer
+	if err := tpl.ExecuteJson(data, &buf); err != nil {
+		return err
+	}
+	return os.WriteFile(*out, buf.Bytes(), 0644)
+}
+
+func redline(args []string) error {
+	fs := newFlagSet("redline")
+	out := fs.String("o", "", "输出文件")
+	author := fs.String("author", "", "修订作者")
+	fs.Parse(args)
+	if fs.NArg() != 2 || *out == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	old, err := DocTrim.DocTrim{}.OpenPackage(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	new, err := DocTrim.DocTrim{}.OpenPackage(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	pkg, err := DocTrim.RedlinePackage(old, new, DocTrim.RedlineOptions{Author: *author})
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := pkg.Write(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(*out, buf.Bytes(), 0644)
+}
+
+func diff(args []string) error {
+	fs := newFlagSet("diff")
+	asJson := fs.Bool("json", false, "以JSON输出差异")
+	ignoreOrder := fs.Bool("ignore-order", false, "忽略属性顺序")
+	ignoreSpace := fs.Bool("ignore-space", false, "忽略文本中的空白差异")
+	ignore := fs.String("ignore", "", "不比较的元素，以逗号分隔的本地名")
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	l, err := readDocument(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	r, err := readDocument(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	opts := DocTrim.DiffOptions{IgnoreAttrOrder: *ignoreOrder, IgnoreWhitespace: *ignoreSpace}
+	if *ignore != "" {
+		opts.IgnoreElements = strings.Split(*ignore, ",")
+	}
+	diffs := opts.Diff(l, r)
+	if *asJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(diffs); err != nil {
+			return err
+		}
+	} else {
+		for _, d := range diffs {
+			fmt.Println(d)
+		}
+	}
+	// 与diff命令一致，有差异时退出码为1
+	if len(diffs) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// readDocument 读取docx的主文档或XML文件
+func readDocument(f string) (*DocTrim.Node, error) {
+	if strings.HasSuffix(f, ".docx") {
+		pkg, err := DocTrim.DocTrim{}.OpenPackage(f)
+		if err != nil {
+			return nil, err
+		}
+		return pkg.Part("word/document.xml")
+	}
+	data, err := os.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	var root DocTrim.Node
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+func cluster(args []string) error {
+	fs := newFlagSet("cluster")
+	threshold := fs.Float64("threshold", 0.8, "相似度阈值，0到1之间")
+	asJson := fs.Bool("json", false, "以JSON输出分组")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	idx := DocTrim.NewSimilarityIndex()
+	err := filepath.WalkDir(fs.Arg(0), func(p string, d iofs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(p, ".docx") {
+			return err
+		}
+		fp, err := DocTrim.DocTrim{}.FingerprintFile(p)
+		if err != nil {
+			log.Printf("skip %s: %v", p, err)
+			return nil
+		}
+		idx.Add(p, fp)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	clusters, err := idx.Cluster(*threshold)
+	if err != nil {
+		return err
+	}
+
+	if *asJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(clusters)
+	}
+	for _, c := range clusters {
+		fmt.Println(strings.Join(c, "\t"))
+	}
+	return nil
+}
+
+func stats(args []string) error {
+	fs := newFlagSet("stats")
+	tokens := fs.Bool("tokens", false, "按内置分词器估计的token计量，缺省按字节计")
+	asJson := fs.Bool("json", false, "以JSON输出")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	input, err := readXml(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	s := DocTrim.DocTrim{}
+	if *tokens {
+		s.Tokenizer = DocTrim.DefaultTokenizer()
+	}
+	_, report, err := s.PackWithReport(bytes.NewReader(input))
+	if err != nil {
+		return err
+	}
+
+	if *asJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	fmt.Printf("input\t%d %s\noutput\t%d %s\n", report.InputSize, report.Unit, report.OutputSize, report.Unit)
+	fmt.Printf("_h\t%d\n_r\t%d\n", report.Definitions, report.References)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "\nrepeated\treferences\tsize\tsaved\t")
+	for _, r := range report.Repeated {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t\n", r.Path, r.References, r.Size, r.Saved)
+	}
+	fmt.Fprintln(w, "\nelement\tcount\tbefore\tafter\t")
+	for _, e := range report.Elements {
+		name := e.Name
+		if name == "" {
+			name = "(other)"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t\n", name, e.Count, e.Before, e.After)
+	}
+	if len(report.Omitted) > 0 {
+		fmt.Fprintln(w, "\nomitted\tcount\t")
+		omitted := make([]string, 0, len(report.Omitted))
+		for what := range report.Omitted {
+			omitted = append(omitted, what)
+		}
+		sort.Strings(omitted)
+		for _, what := range omitted {
+			fmt.Fprintf(w, "%s\t%d\t\n", what, report.Omitted[what])
+		}
+	}
+	fmt.Fprintln(w, "\nstage\ttime\t")
+	for _, st := range report.Stages {
+		fmt.Fprintf(w, "%s\t%v\t\n", st.Name, st.Duration)
+	}
+	return w.Flush()
+}
+
+func lint(args []string) error {
+	fs := newFlagSet("lint")
+	asJson := fs.Bool("json", false, "以JSON输出检查结果")
+	maxSizes := fs.Int("max-sizes", 2, "正文允许的字号数")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	f := fs.Arg(0)
+	opts := DocTrim.LintOptions{MaxFontSizes: *maxSizes}
+	var findings []DocTrim.LintFinding
+	if strings.HasSuffix(f, ".docx") {
+		var err error
+		if findings, err = (DocTrim.DocTrim{}).LintFile(f, opts); err != nil {
+			return err
+		}
+	} else {
+		root, err := readDocument(f)
+		if err != nil {
+			return err
+		}
+		findings = (&DocTrim.DocTrim{}).Lint(root, opts)
+	}
+
+	if *asJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(findings); err != nil {
+			return err
+		}
+	} else {
+		for _, finding := range findings {
+			fmt.Println(finding)
+			for _, p := range finding.Paths {
+				fmt.Println("\t" + p)
+			}
+		}
+	}
+	if len(findings) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func a11y(args []string) error {
+	fs := newFlagSet("a11y")
+	asJson := fs.Bool("json", false, "以JSON输出检查结果")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	f := fs.Arg(0)
+	var issues []DocTrim.AccessibilityIssue
+	if strings.HasSuffix(f, ".docx") {
+		var err error
+		if issues, err = (DocTrim.DocTrim{}).CheckAccessibilityFile(f); err != nil {
+			return err
+		}
+	} else {
+		root, err := readDocument(f)
+		if err != nil {
+			return err
+		}
+		issues = DocTrim.CheckAccessibility(root, nil)
+	}
+
+	if *asJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(issues); err != nil {
+			return err
+		}
+	} else {
+		for _, issue := range issues {
+			fmt.Println(issue)
+		}
+	}
+	if len(issues) > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// sanitizeKinds -keep参数中的类别及对应的策略项
+var sanitizeKinds = map[string]func(p *DocTrim.SanitizePolicy) *bool{
+	DocTrim.SanitizeMetadata:         func(p *DocTrim.SanitizePolicy) *bool { return &p.Metadata },
+	DocTrim.SanitizeComments:         func(p *DocTrim.SanitizePolicy) *bool { return &p.Comments },
+	DocTrim.SanitizeRevisionAuthors:  func(p *DocTrim.SanitizePolicy) *bool { return &p.RevisionAuthors },
+	DocTrim.SanitizeHiddenText:       func(p *DocTrim.SanitizePolicy) *bool { return &p.HiddenText },
+	DocTrim.SanitizeCustomXML:        func(p *DocTrim.SanitizePolicy) *bool { return &p.CustomXML },
+	DocTrim.SanitizeMacros:           func(p *DocTrim.SanitizePolicy) *bool { return &p.Macros },
+	DocTrim.SanitizeExternalLinks:    func(p *DocTrim.SanitizePolicy) *bool { return &p.ExternalLinks },
+	DocTrim.SanitizeAttachedTemplate: func(p *DocTrim.SanitizePolicy) *bool { return &p.AttachedTemplate },
+	DocTrim.SanitizeEmbeddedObjects:  func(p *DocTrim.SanitizePolicy) *bool { return &p.EmbeddedObjects },
+}
+
+func sanitize(args []string) error {
+	fs := newFlagSet("sanitize")
+	keep := fs.String("keep", "", "保留的类别，逗号分隔：metadata,comments,revision-authors,hidden-text,custom-xml,macros,external-links,attached-template,embedded-objects")
+	out := fs.String("o", "", "输出文件，.docx写出清理后的包，.xml写出打包后的主文档")
+	asJson := fs.Bool("json", false, "以JSON输出清理结果")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *out == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	policy := DocTrim.DefaultSanitizePolicy
+	if *keep != "" {
+		for _, kind := range strings.Split(*keep, ",") {
+			field, ok := sanitizeKinds[strings.TrimSpace(kind)]
+			if !ok {
+				return fmt.Errorf("unknown sanitize kind: %s", kind)
+			}
+			*field(&policy) = false
+		}
+	}
+
+	pkg, err := DocTrim.DocTrim{}.OpenPackage(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	report, err := DocTrim.SanitizePackage(pkg, policy)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	switch {
+	case strings.HasSuffix(*out, ".docx"):
+		err = pkg.Write(&buf)
+	case strings.HasSuffix(*out, ".xml"):
+		data, _ := pkg.Data("word/document.xml")
+		var packed []byte
+		if packed, err = (&DocTrim.DocTrim{}).Pack(bytes.NewReader(data)); err == nil {
+			buf.Write(packed)
+		}
+	default:
+		return fmt.Errorf("unsupported output type: %s", *out)
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	if *asJson {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	kinds := make([]string, 0, len(report.Removed))
+	for kind := range report.Removed {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Printf("%-18s %d\n", kind, report.Removed[kind])
+	}
+	for _, part := range report.Parts {
+		fmt.Println("removed", part)
+	}
+	return nil
+}
+
+// vaultKeyEnv 对照表口令所在的环境变量
+const vaultKeyEnv = "DOCTRIM_VAULT_KEY"
+
+// openVault 读取对照表，文件不存在时返回空表
+func openVault(f string) (*DocTrim.Vault, error) {
+	file, err := os.Open(f)
+	if os.IsNotExist(err) {
+		return DocTrim.NewVault(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return DocTrim.LoadVault(file, os.Getenv(vaultKeyEnv))
+}
+
+func redact(args []string) error {
+	fs := newFlagSet("redact")
+	names := fs.String("names", "", "姓名名单文件，每行一个")
+	vaultFile := fs.String("vault", "", "对照表文件，已存在时沿用其中的占位符")
+	text := fs.Bool("text", false, "导出纯文本")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *vaultFile == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	rules := append([]DocTrim.RedactRule{}, DocTrim.DefaultRedactRules...)
+	if *names != "" {
+		data, err := os.ReadFile(*names)
+		if err != nil {
+			return err
+		}
+		rules = append([]DocTrim.RedactRule{DocTrim.NameRule(strings.Split(string(data), "\n"))}, rules...)
+	}
+	vault, err := openVault(*vaultFile)
+	if err != nil {
+		return err
+	}
+	s := DocTrim.DocTrim{PlainText: *text, Redact: rules, Vault: vault}
+
+	f := fs.Arg(0)
+	var data []byte
+	switch {
+	case strings.HasSuffix(f, ".docx"):
+		data, err = s.Process(f)
+	case strings.HasSuffix(f, ".xml"):
+		var file *os.File
+		if file, err = os.Open(f); err != nil {
+			return err
+		}
+		defer file.Close()
+		data, err = s.Pack(file)
+	default:
+		return fmt.Errorf("unsupported file type: %s", f)
+	}
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := vault.Save(&buf, os.Getenv(vaultKeyEnv)); err != nil {
+		return err
+	}
+	if err := os.WriteFile(*vaultFile, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	os.Stdout.Write(data)
+	return nil
+}
+
+func restore(args []string) error {
+	fs := newFlagSet("restore")
+	vaultFile := fs.String("vault", "", "对照表文件")
+	text := fs.Bool("text", false, "输入为纯文本")
+	fs.Parse(args)
+	if fs.NArg() != 1 || *vaultFile == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	file, err := os.Open(*vaultFile)
+	if err != nil {
+		return err
+	}
+	vault, err := DocTrim.LoadVault(file, os.Getenv(vaultKeyEnv))
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *text {
+		fmt.Print(vault.RestoreText(string(data)))
+		return nil
+	}
+	if data, err = (DocTrim.DocTrim{Vault: vault}).Unpack(bytes.NewReader(data)); err != nil {
+		return err
+	}
+	os.Stdout.Write(data)
+	return nil
+}
+
+// readXml 读取主文档的XML，docx取word/document.xml
+func readXml(f string) ([]byte, error) {
+	if !strings.HasSuffix(f, ".docx") {
+		return os.ReadFile(f)
+	}
+	pkg, err := DocTrim.DocTrim{}.OpenPackage(f)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := pkg.Data("word/document.xml")
+	if !ok {
+		return nil, fmt.Errorf("%s: word/document.xml not found", f)
+	}
+	return data, nil
+}
@@ -0,0 +1,342 @@
+// 删除只声明了缺省值的元素和属性
+// 如<w:keepNext w:val="false"/>、空的<w:pBdr/>、<w:spacing w:lineRule="auto"/>中的lineRule
+// 严格模式下以可逆标记记录被删除的内容，Unpack时还原；宽松模式直接删除
+
+package DocTrim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nbio/xml"
+)
+
+// DefaultsMode 缺省值的处理方式
+type DefaultsMode int
+
+const (
+	// DefaultsKeep 保留缺省值
+	DefaultsKeep DefaultsMode = iota
+	// DefaultsStrict 删除缺省值并在父元素上留下可逆标记
+	DefaultsStrict
+	// DefaultsLossy 直接删除缺省值
+	// 显式的关闭值(如<w:b w:val="0"/>)会覆盖样式中的设置，只在DocTrim.Styles中的样式和docDefaults
+	// 都没有打开该属性时删除，因此必须设置Styles，否则Pack返回错误
+	DefaultsLossy
+)
+
+const (
+	defaultElemTag = "_d"
+	defaultAttrTag = "_da"
+)
+
+// onOffDefaults 开关类属性元素在省略时的取值，w:val等于该值时元素冗余
+var onOffDefaults = map[string]bool{
+	// 段落属性
+	"keepNext": false, "keepLines": false, "pageBreakBefore": false,
+	"widowControl": false, "suppressLineNumbers": false, "suppressAutoHyphens": false,
+	"contextualSpacing": false, "mirrorIndents": false, "bidi": false,
+	"topLinePunct": false, "suppressOverlap": false,
+	"snapToGrid": true, "kinsoku": true, "wordWrap": true, "overflowPunct": true,
+	"autoSpaceDE": true, "autoSpaceDN": true, "adjustRightInd": true,
+	// 字符属性
+	"b": false, "bCs": false, "i": false, "iCs": false, "caps": false,
+	"smallCaps": false, "strike": false, "dstrike": false, "outline": false,
+	"shadow": false, "emboss": false, "imprint": false, "vanish": false,
+	"webHidden": false, "specVanish": false, "rtl": false, "cs": false,
+	"noProof": false,
+}
+
+// valDefaults 只有w:val且取缺省值时冗余的元素
+var valDefaults = map[string]string{
+	"vertAlign":     "baseline",
+	"position":      "0",
+	"kern":          "0",
+	"w":             "100",
+	"u":             "none",
+	"highlight":     "none",
+	"effect":        "none",
+	"em":            "none",
+	"textAlignment": "auto",
+}
+
+// attrDefaults 元素上取缺省值时可省略的属性
+var attrDefaults = map[string]map[string]string{
+	"spacing": {"lineRule": "auto", "beforeAutospacing": "0", "afterAutospacing": "0"},
+	"pgSz":    {"orient": "portrait"},
+	"cols":    {"num": "1", "sep": "0", "equalWidth": "1"},
+	"docGrid": {"type": "default", "charSpace": "0"},
+	"tblW":    {"type": "auto"},
+}
+
+// emptyDefaults 没有属性和子元素时不起作用的容器元素
+// 以Pr结尾的属性容器同样适用，w:tblPr是w:tbl的必需元素，不删除
+var emptyDefaults = map[string]bool{
+	"pBdr": true, "ind": true, "spacing": true, "tabs": true, "rFonts": true,
+	"tcBorders": true, "tblBorders": true, "numPr": true, "lang": true,
+}
+
+// onOffValue 解析开关属性值
+func onOffValue(val string) (bool, bool) {
+	switch val {
+	case "1", "true", "on":
+		return true, true
+	case "0", "false", "off":
+		return false, true
+	}
+	return false, false
+}
+
+// sameValue 比较属性值，开关值的不同写法视为相同
+func sameValue(l, r string) bool {
+	if l == r {
+		return true
+	}
+	lv, lok := onOffValue(l)
+	rv, rok := onOffValue(r)
+	return lok && rok && lv == rv
+}
+
+// isDefaultElement 判断元素是否只声明了缺省值
+func isDefaultElement(parent, node *Node, strict bool) bool {
+	if len(node.Children) > 0 || (strict && len(node.Content) > 0) || strings.TrimSpace(string(node.Content)) != "" {
+		return false
+	}
+	// 修订记录中的空属性表示修订前没有格式，不能删除
+	if strings.HasSuffix(parent.XMLName.Local, "Change") {
+		return false
+	}
+
+	local := node.XMLName.Local
+	if len(node.Attrs) == 0 {
+		if local == "tblPr" || local == "sectPr" {
+			return false
+		}
+		if _, ok := onOffDefaults[local]; ok {
+			// 省略w:val表示打开
+			return onOffDefaults[local]
+		}
+		return emptyDefaults[local] || strings.HasSuffix(local, "Pr")
+	}
+	if len(node.Attrs) != 1 || node.Attrs[0].Name.Local != "val" {
+		return false
+	}
+	val := node.Attrs[0].Value
+	if def, ok := onOffDefaults[local]; ok {
+		v, ok := onOffValue(val)
+		return ok && v == def
+	}
+	if def, ok := valDefaults[local]; ok {
+		return val == def
+	}
+	return false
+}
+
+// explicitDefault 判断元素是否显式地取了开关或枚举属性的缺省值，这类元素可能覆盖样式中的设置
+func explicitDefault(node *Node) bool {
+	_, onOff := onOffDefaults[node.XMLName.Local]
+	_, val := valDefaults[node.XMLName.Local]
+	return onOff || val
+}
+
+// OmitDefaults 删除子树中只声明了缺省值的元素和属性，返回删除的数量
+// strict为true时在父元素的_d、元素的_da属性中记录删除的内容，可由RestoreDefaults还原；
+// strict为false时不知道样式，显式的关闭值都保留，需要删除时使用Styles.OmitDefaults
+func (node *Node) OmitDefaults(strict bool) int {
+	d := &defaultsPass{strict: strict}
+	return d.omit(node, nil, nil, nil)
+}
+
+// OmitDefaults 宽松地删除子树中的缺省值，显式的关闭值只在样式和docDefaults都没有打开该属性时删除
+func (st *Styles) OmitDefaults(root *Node) int {
+	d := &defaultsPass{styles: st}
+	return d.omit(root, nil, nil, nil)
+}
+
+// defaultsPass 一次删除缺省值的遍历
+type defaultsPass struct {
+	strict bool
+	// styles 宽松模式下用于判断显式的关闭值是否覆盖样式，为nil时保留这些值
+	styles *Styles
+}
+
+// inherited 返回属性容器node从样式继承的属性，parent为node的父元素，p、r为所在的段落和run
+// 不是段落或run的属性时返回nil
+func (d *defaultsPass) inherited(node, parent, p, r *Node) *Node {
+	if d.styles == nil || node.XMLName.Space != nsWord {
+		return nil
+	}
+	switch {
+	case node.XMLName.Local == "pPr" && parent != nil && parent == p:
+		return d.styles.inheritedPPr(p)
+	case node.XMLName.Local == "rPr" && parent != nil && parent == r:
+		return d.styles.inheritedRPr(p, r)
+	case node.XMLName.Local == "rPr" && parent != nil && p != nil && parent == p.child("pPr"):
+		// 段落标记的格式，字符样式写在w:pPr/w:rPr/w:rStyle中
+		return d.styles.inheritedRPr(p, parent)
+	}
+	return nil
+}
+
+// overrides 判断宽松模式下显式的缺省值是否可能覆盖样式，inherited为nil表示无法确定继承的属性
+func (d *defaultsPass) overrides(node, inherited *Node) bool {
+	if d.strict || !explicitDefault(node) {
+		return false
+	}
+	if inherited == nil {
+		return true
+	}
+	base := inherited.child(node.XMLName.Local)
+	return base != nil && !isDefaultElement(inherited, base, false)
+}
+
+func (d *defaultsPass) omit(node, parent, p, r *Node) int {
+	node.digest = 0
+	if node.XMLName.Space == nsWord {
+		switch node.XMLName.Local {
+		case "p":
+			p, r = node, nil
+		case "r":
+			r = node
+		}
+	}
+	strict := d.strict
+	removed := 0
+	for _, child := range node.Children {
+		removed += d.omit(child, node, p, r)
+	}
+
+	// 缺省属性
+	if defs, ok := attrDefaults[node.XMLName.Local]; ok {
+		attrs := make([]xml.Attr, 0, len(node.Attrs))
+		marks := []string{}
+		for i, a := range node.Attrs {
+			def, ok := defs[a.Name.Local]
+			if !ok || !sameValue(a.Value, def) || (strict && a.Name.Space != node.XMLName.Space) {
+				attrs = append(attrs, a)
+				continue
+			}
+			marks = append(marks, fmt.Sprintf("%d:%s=%s", i, a.Name.Local, a.Value))
+		}
+		removed += len(marks)
+		if strict && len(marks) > 0 {
+			attrs = append(attrs, xml.Attr{Name: xml.Name{Local: defaultAttrTag}, Value: strings.Join(marks, " ")})
+		}
+		node.Attrs = attrs
+	}
+
+	// 缺省元素
+	children := make([]*Node, 0, len(node.Children))
+	marks := []string{}
+	var inherited *Node
+	inheritedDone := false
+	for i, child := range node.Children {
+		if !isDefaultElement(node, child, strict) || (strict && !markable(node, child)) {
+			children = append(children, child)
+			continue
+		}
+		if !strict && explicitDefault(child) && !inheritedDone {
+			inherited, inheritedDone = d.inherited(node, parent, p, r), true
+		}
+		if d.overrides(child, inherited) {
+			children = append(children, child)
+			continue
+		}
+		mark := strconv.Itoa(i) + ":" + child.XMLName.Local
+		for _, a := range child.Attrs {
+			mark += "@" + a.Name.Local + "=" + a.Value
+		}
+		marks = append(marks, mark)
+	}
+	removed += len(marks)
+	if strict && len(marks) > 0 {
+		node.Attrs = append(node.Attrs, xml.Attr{Name: xml.Name{Local: defaultElemTag}, Value: strings.Join(marks, " ")})
+	}
+	node.Children = children
+	return removed
+}
+
+// markable 判断元素能否用标记还原：与父元素同一命名空间，属性也在该命名空间
+func markable(parent, child *Node) bool {
+	if child.XMLName.Space != parent.XMLName.Space {
+		return false
+	}
+	for _, a := range child.Attrs {
+		if a.Name.Space != child.XMLName.Space {
+			return false
+		}
+	}
+	return true
+}
+
+// RestoreDefaults 还原OmitDefaults在严格模式下删除的元素和属性
+func (node *Node) RestoreDefaults() error {
+	node.digest = 0
+	for _, child := range node.Children {
+		if err := child.RestoreDefaults(); err != nil {
+			return err
+		}
+	}
+
+	attrs := make([]xml.Attr, 0, len(node.Attrs))
+	var elemMarks, attrMarks string
+	for _, a := range node.Attrs {
+		switch a.Name.Local {
+		case defaultElemTag:
+			elemMarks = a.Value
+		case defaultAttrTag:
+			attrMarks = a.Value
+		default:
+			attrs = append(attrs, a)
+		}
+	}
+	if elemMarks == "" && attrMarks == "" {
+		return nil
+	}
+
+	space := node.XMLName.Space
+	for _, mark := range strings.Fields(attrMarks) {
+		index, rest, err := splitMark(mark)
+		if err != nil {
+			return err
+		}
+		if index > len(attrs) {
+			return fmt.Errorf("default mark out of range: %s", mark)
+		}
+		name, value, _ := strings.Cut(rest, "=")
+		attr := xml.Attr{Name: xml.Name{Space: space, Local: name}, Value: value}
+		attrs = append(attrs[:index], append([]xml.Attr{attr}, attrs[index:]...)...)
+	}
+	node.Attrs = attrs
+
+	children := append([]*Node{}, node.Children...)
+	for _, mark := range strings.Fields(elemMarks) {
+		index, rest, err := splitMark(mark)
+		if err != nil {
+			return err
+		}
+		if index > len(children) {
+			return fmt.Errorf("default mark out of range: %s", mark)
+		}
+		parts := strings.Split(rest, "@")
+		child := &Node{XMLName: xml.Name{Space: space, Local: parts[0]}, Attrs: []xml.Attr{}, Content: []byte{}, Children: []*Node{}}
+		for _, part := range parts[1:] {
+			name, value, _ := strings.Cut(part, "=")
+			child.Attrs = append(child.Attrs, xml.Attr{Name: xml.Name{Space: space, Local: name}, Value: value})
+		}
+		children = append(children[:index], append([]*Node{child}, children[index:]...)...)
+	}
+	node.Children = children
+	return nil
+}
+
+// splitMark 拆分“序号:内容”形式的标记
+func splitMark(mark string) (int, string, error) {
+	head, rest, ok := strings.Cut(mark, ":")
+	index, err := strconv.Atoi(head)
+	if !ok || err != nil || index < 0 {
+		return 0, "", fmt.Errorf("invalid default mark: %s", mark)
+	}
+	return index, rest, nil
+}
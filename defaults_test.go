@@ -0,0 +1,117 @@
+package DocTrim
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+func TestOmitDefaults(t *testing.T) {
+	src := `<w:pPr xmlns:w="` + nsWord + `">` +
+		`<w:keepNext w:val="false"/><w:keepLines w:val="0"/><w:snapToGrid w:val="true"/>` +
+		`<w:pBdr></w:pBdr><w:spacing w:line="240" w:lineRule="auto"/><w:ind/>` +
+		`<w:jc w:val="center"/><w:widowControl/>` +
+		`<w:rPr><w:b w:val="off"/><w:vertAlign w:val="baseline"/><w:u w:val="single"/></w:rPr>` +
+		`</w:pPr>`
+	var lossy Node
+	if err := xml.Unmarshal([]byte(src), &lossy); err != nil {
+		t.Fatal(err)
+	}
+	// 不知道样式时显式的关闭值可能覆盖样式，只删除空容器和缺省属性
+	if removed := lossy.OmitDefaults(false); removed != 3 {
+		t.Errorf("removed %d, want 3", removed)
+	}
+	data, _ := lossy.Marshal()
+	want := `<w:pPr xmlns:w="` + nsWord + `"><w:keepNext w:val="false"></w:keepNext><w:keepLines w:val="0"></w:keepLines><w:snapToGrid w:val="true"></w:snapToGrid>` +
+		`<w:spacing w:line="240"></w:spacing><w:jc w:val="center"></w:jc><w:widowControl></w:widowControl>` +
+		`<w:rPr><w:b w:val="off"></w:b><w:vertAlign w:val="baseline"></w:vertAlign><w:u w:val="single"></w:u></w:rPr></w:pPr>`
+	if string(data) != want {
+		t.Errorf("got %s", data)
+	}
+
+	var strict Node
+	xml.Unmarshal([]byte(src), &strict)
+	strict.OmitDefaults(true)
+	if err := strict.RestoreDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	restored, _ := strict.Marshal()
+	if !EqualXml([]byte(src), restored) {
+		t.Errorf("strict mode not reversible: %s", restored)
+	}
+}
+
+func TestOmitDefaultsStyles(t *testing.T) {
+	styles, err := ParseStyles(bytes.NewReader([]byte(`<w:styles xmlns:w="` + nsWord + `">` +
+		`<w:docDefaults><w:rPrDefault><w:rPr><w:kern w:val="2"/></w:rPr></w:rPrDefault></w:docDefaults>` +
+		`<w:style w:type="paragraph" w:default="1" w:styleId="Normal"/>` +
+		`<w:style w:type="paragraph" w:styleId="Heading1"><w:basedOn w:val="Normal"/><w:pPr><w:keepNext/></w:pPr><w:rPr><w:b/></w:rPr></w:style>` +
+		`<w:style w:type="character" w:styleId="Hyperlink"><w:rPr><w:u w:val="single"/></w:rPr></w:style>` +
+		`</w:styles>`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := `<w:body xmlns:w="` + nsWord + `">` +
+		`<w:p><w:pPr><w:pStyle w:val="Heading1"/><w:keepNext w:val="false"/><w:keepLines w:val="0"/></w:pPr>` +
+		`<w:r><w:rPr><w:b w:val="0"/><w:i w:val="0"/><w:kern w:val="0"/></w:rPr><w:t>Title</w:t></w:r></w:p>` +
+		`<w:p><w:r><w:rPr><w:rStyle w:val="Hyperlink"/><w:u w:val="none"/><w:vertAlign w:val="baseline"/></w:rPr><w:t>link</w:t></w:r></w:p>` +
+		`</w:body>`
+	var root Node
+	if err := xml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatal(err)
+	}
+	// 样式或docDefaults打开的属性保留显式的关闭值，其余的删除
+	if removed := styles.OmitDefaults(&root); removed != 3 {
+		t.Errorf("removed %d, want 3", removed)
+	}
+	data, _ := root.Marshal()
+	for _, kept := range []string{`<w:keepNext w:val="false">`, `<w:b w:val="0">`, `<w:kern w:val="0">`, `<w:u w:val="none">`} {
+		if !bytes.Contains(data, []byte(kept)) {
+			t.Errorf("%s removed from %s", kept, data)
+		}
+	}
+	for _, gone := range []string{"keepLines", "<w:i ", "vertAlign"} {
+		if bytes.Contains(data, []byte(gone)) {
+			t.Errorf("%s left in %s", gone, data)
+		}
+	}
+}
+
+func TestPackDefaults(t *testing.T) {
+	exact, err := (&DocTrim{}).Pack(bytes.NewReader([]byte(testXml)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strict := DocTrim{Defaults: DefaultsStrict}
+	data, err := strict.Pack(bytes.NewReader([]byte(testXml)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := strict.Unpack(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !EqualXml([]byte(testXml), to) {
+		t.Fatal("Not equals")
+	}
+
+	styles, err := ParseStyles(bytes.NewReader([]byte(`<w:styles xmlns:w="` + nsWord + `"/>`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (&DocTrim{Defaults: DefaultsLossy}).Pack(bytes.NewReader([]byte(testXml))); err != errLossyStyles {
+		t.Errorf("lossy mode without styles: got %v", err)
+	}
+	lossy := DocTrim{Defaults: DefaultsLossy, Styles: styles}
+	dropped, err := lossy.Pack(bytes.NewReader([]byte(testXml)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Printf("exact %d, strict %d, lossy %d", len(exact), len(data), len(dropped))
+	if bytes.Contains(dropped, []byte("keepNext")) || len(dropped) >= len(exact) {
+		t.Errorf("lossy mode kept defaults: %d >= %d", len(dropped), len(exact))
+	}
+}
@@ -0,0 +1,182 @@
+// 结构化比较
+// 比较两棵节点树，返回每处差异的路径、类型和两边的值，代替NodeEquals逐层打印元素名的日志
+// 属性顺序、空白和指定元素是否参与比较由DiffOptions配置
+
+package DocTrim
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/nbio/xml"
+)
+
+// DiffKind 差异类型
+type DiffKind string
+
+const (
+	// DiffName 元素名不同，或一侧缺少该元素
+	DiffName DiffKind = "name"
+	// DiffAttr 属性值不同，或一侧缺少该属性
+	DiffAttr DiffKind = "attr"
+	// DiffAttrOrder 属性相同但顺序不同
+	DiffAttrOrder DiffKind = "attr-order"
+	// DiffText 文本内容不同
+	DiffText DiffKind = "text"
+	// DiffChildren 子节点数量不同
+	DiffChildren DiffKind = "children"
+)
+
+// Difference 一处差异，属性差异的Path以/@name结尾
+type Difference struct {
+	Path  string   `json:"path"`
+	Kind  DiffKind `json:"kind"`
+	Left  string   `json:"left"`
+	Right string   `json:"right"`
+}
+
+// String 返回便于阅读的差异描述
+func (d Difference) String() string {
+	return d.Path + " " + string(d.Kind) + ": " + strconv.Quote(d.Left) + " != " + strconv.Quote(d.Right)
+}
+
+// DiffOptions 比较时的等价规则
+type DiffOptions struct {
+	// IgnoreAttrOrder 为true时属性顺序不同视为相同
+	IgnoreAttrOrder bool
+	// IgnoreWhitespace 为true时文本首尾空白忽略，中间的连续空白视为一个空格
+	IgnoreWhitespace bool
+	// IgnoreElements 两侧都是这些元素时不比较其属性和内容，按本地名匹配
+	IgnoreElements []string
+}
+
+// RoundTripOptions NodeEquals使用的规则，节属性在往返时可能重写，不参与比较
+var RoundTripOptions = DiffOptions{IgnoreElements: []string{"sectPr"}}
+
+// Diff 按严格规则比较两棵节点树
+func Diff(l, r *Node) []Difference {
+	return DiffOptions{}.Diff(l, r)
+}
+
+// Diff 按规则比较两棵节点树，返回所有差异
+func (o DiffOptions) Diff(l, r *Node) []Difference {
+	d := &differ{opts: o, ignore: map[string]bool{}}
+	for _, local := range o.IgnoreElements {
+		d.ignore[local] = true
+	}
+	if l.XMLName != r.XMLName {
+		d.add("/", DiffName, qualifiedName(l), qualifiedName(r))
+		return d.diffs
+	}
+	d.node(l, r, "/"+qualifiedName(l))
+	return d.diffs
+}
+
+type differ struct {
+	opts   DiffOptions
+	ignore map[string]bool
+	diffs  []Difference
+}
+
+func (d *differ) add(path string, kind DiffKind, left, right string) {
+	d.diffs = append(d.diffs, Difference{Path: path, Kind: kind, Left: left, Right: right})
+}
+
+// node 比较名字相同的两个节点
+func (d *differ) node(l, r *Node, path string) {
+	if d.ignore[l.XMLName.Local] {
+		return
+	}
+	d.attrs(l, r, path)
+	if lt, rt := d.text(l.Content), d.text(r.Content); lt != rt {
+		d.add(path, DiffText, lt, rt)
+	}
+
+	lPaths, rPaths := childPaths(l, path), childPaths(r, path)
+	if len(l.Children) == len(r.Children) {
+		for i, lc := range l.Children {
+			rc := r.Children[i]
+			if lc.XMLName != rc.XMLName {
+				d.add(lPaths[i], DiffName, qualifiedName(lc), qualifiedName(rc))
+				continue
+			}
+			d.node(lc, rc, lPaths[i])
+		}
+		return
+	}
+
+	// 数量不同时按元素名对齐，只有一侧存在的子节点单独报告
+	d.add(path, DiffChildren, strconv.Itoa(len(l.Children)), strconv.Itoa(len(r.Children)))
+	i, j := 0, 0
+	for _, m := range lcs(len(l.Children), len(r.Children), func(i, j int) bool {
+		return l.Children[i].XMLName == r.Children[j].XMLName
+	}) {
+		d.unmatched(l.Children[i:m[0]], lPaths[i:m[0]], true)
+		d.unmatched(r.Children[j:m[1]], rPaths[j:m[1]], false)
+		d.node(l.Children[m[0]], r.Children[m[1]], lPaths[m[0]])
+		i, j = m[0]+1, m[1]+1
+	}
+	d.unmatched(l.Children[i:], lPaths[i:], true)
+	d.unmatched(r.Children[j:], rPaths[j:], false)
+}
+
+// unmatched 报告只在一侧存在的子节点
+func (d *differ) unmatched(nodes []*Node, paths []string, left bool) {
+	for i, n := range nodes {
+		if left {
+			d.add(paths[i], DiffName, qualifiedName(n), "")
+		} else {
+			d.add(paths[i], DiffName, "", qualifiedName(n))
+		}
+	}
+}
+
+// attrs 比较属性，IgnoreAttrOrder为false时属性相同但顺序不同也报告
+func (d *differ) attrs(l, r *Node, path string) {
+	rValues := map[xml.Name]string{}
+	for _, a := range r.Attrs {
+		rValues[a.Name] = a.Value
+	}
+	lValues := map[xml.Name]bool{}
+	for _, a := range l.Attrs {
+		lValues[a.Name] = true
+		value, ok := rValues[a.Name]
+		lv, rv := d.text([]byte(a.Value)), d.text([]byte(value))
+		if !ok || lv != rv {
+			d.add(path+"/@"+prefixedName(a.Name), DiffAttr, lv, rv)
+		}
+	}
+	same := len(l.Attrs) == len(r.Attrs)
+	for _, a := range r.Attrs {
+		if !lValues[a.Name] {
+			d.add(path+"/@"+prefixedName(a.Name), DiffAttr, "", d.text([]byte(a.Value)))
+			same = false
+		}
+	}
+	if !same || d.opts.IgnoreAttrOrder {
+		return
+	}
+	for i, a := range l.Attrs {
+		if a.Name != r.Attrs[i].Name {
+			d.add(path, DiffAttrOrder, attrNames(l.Attrs), attrNames(r.Attrs))
+			return
+		}
+	}
+}
+
+// attrNames 按顺序列出属性名
+func attrNames(attrs []xml.Attr) string {
+	names := make([]string, len(attrs))
+	for i, a := range attrs {
+		names[i] = prefixedName(a.Name)
+	}
+	return strings.Join(names, " ")
+}
+
+// text 返回用于比较的文本，IgnoreWhitespace为true时规范化空白
+func (d *differ) text(data []byte) string {
+	if d.opts.IgnoreWhitespace {
+		return strings.Join(strings.Fields(string(data)), " ")
+	}
+	return string(data)
+}
@@ -0,0 +1,66 @@
+package DocTrim
+
+import (
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+func parseDiffNode(t *testing.T, src string) *Node {
+	var root Node
+	if err := xml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatal(err)
+	}
+	return &root
+}
+
+func TestDiff(t *testing.T) {
+	l := parseDiffNode(t, `<w:body xmlns:w="`+nsWord+`">`+
+		`<w:p><w:pPr><w:jc w:val="left"/></w:pPr><w:r><w:t>one</w:t></w:r></w:p>`+
+		`<w:p><w:r><w:t>two</w:t></w:r></w:p>`+
+		`<w:sectPr><w:pgSz w:w="11906"/></w:sectPr></w:body>`)
+	r := parseDiffNode(t, `<w:body xmlns:w="`+nsWord+`">`+
+		`<w:p><w:pPr><w:jc w:val="center"/></w:pPr><w:r><w:t>one</w:t></w:r></w:p>`+
+		`<w:tbl/>`+
+		`<w:p><w:r><w:t>2</w:t></w:r></w:p>`+
+		`<w:sectPr><w:pgSz w:w="12240"/></w:sectPr></w:body>`)
+
+	want := []Difference{
+		{Path: "/w:body", Kind: DiffChildren, Left: "3", Right: "4"},
+		{Path: "/w:body/w:p[1]/w:pPr[1]/w:jc[1]/@w:val", Kind: DiffAttr, Left: "left", Right: "center"},
+		{Path: "/w:body/w:tbl[1]", Kind: DiffName, Left: "", Right: "w:tbl"},
+		{Path: "/w:body/w:p[2]/w:r[1]/w:t[1]", Kind: DiffText, Left: "two", Right: "2"},
+		{Path: "/w:body/w:sectPr[1]/w:pgSz[1]/@w:w", Kind: DiffAttr, Left: "11906", Right: "12240"},
+	}
+	diffs := Diff(l, r)
+	if len(diffs) != len(want) {
+		t.Fatalf("got %v", diffs)
+	}
+	for i, d := range diffs {
+		if d != want[i] {
+			t.Errorf("diff %d: got %s, want %s", i, d, want[i])
+		}
+	}
+
+	// 忽略节属性后只剩正文的差异
+	diffs = DiffOptions{IgnoreElements: []string{"sectPr"}}.Diff(l, r)
+	if len(diffs) != 4 {
+		t.Errorf("got %v", diffs)
+	}
+}
+
+func TestDiffOptions(t *testing.T) {
+	l := parseDiffNode(t, `<a x="1" y="2"><b>  some   text </b></a>`)
+	r := parseDiffNode(t, `<a y="2" x="1"><b>some text</b></a>`)
+
+	diffs := Diff(l, r)
+	if len(diffs) != 2 || diffs[0].Kind != DiffAttrOrder || diffs[0].Left != "x y" || diffs[1].Kind != DiffText {
+		t.Errorf("got %v", diffs)
+	}
+	if diffs := (DiffOptions{IgnoreAttrOrder: true, IgnoreWhitespace: true}).Diff(l, r); len(diffs) != 0 {
+		t.Errorf("got %v", diffs)
+	}
+	if NodeEquals(l, r) {
+		t.Error("NodeEquals should detect attribute order and text")
+	}
+}
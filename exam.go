@@ -0,0 +1,462 @@
+// 试题切分
+// 遍历Node树，将试卷拆分为大题、小题、子题、选项、填空和分值说明
+// 每一部分保留公式、图片以及指向原始段落节点的链接
+
+package DocTrim
+
+import (
+	"encoding/json"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/nbio/xml"
+)
+
+// ExamContent 试卷各部分共有的内容
+type ExamContent struct {
+	Text       string   `json:"text"`
+	Math       []string `json:"math,omitempty"`
+	Images     []string `json:"images,omitempty"`
+	Blanks     int      `json:"blanks,omitempty"`
+	Paragraphs []int    `json:"paragraphs"`
+
+	// Nodes 对应的原始段落节点
+	Nodes []*Node `json:"-"`
+}
+
+// ExamOption 选择题选项
+type ExamOption struct {
+	Label string `json:"label"`
+	ExamContent
+}
+
+// Question 小题或子题
+type Question struct {
+	Number    string `json:"number"`
+	Score     int    `json:"score,omitempty"`
+	ScoreNote string `json:"scoreNote,omitempty"`
+	ExamContent
+	Options      []*ExamOption `json:"options,omitempty"`
+	SubQuestions []*Question   `json:"subQuestions,omitempty"`
+}
+
+// ExamSection 大题，如“一、选择题”
+type ExamSection struct {
+	Number     string `json:"number,omitempty"`
+	ScoreEach  int    `json:"scoreEach,omitempty"`
+	ScoreTotal int    `json:"scoreTotal,omitempty"`
+	ScoreNote  string `json:"scoreNote,omitempty"`
+	ExamContent
+	Questions []*Question `json:"questions"`
+}
+
+// Exam 切分后的试卷
+type Exam struct {
+	Header   ExamContent    `json:"header"`
+	Sections []*ExamSection `json:"sections"`
+}
+
+var (
+	examSectionRe  = regexp.MustCompile(`^\s*([一二三四五六七八九十]+)\s*[、.．]`)
+	examTitleRe    = regexp.MustCompile(`^\s*[^\s：:，,]{1,6}题\s*[：:]`)
+	examQuestionRe = regexp.MustCompile(`^\s*(\d{1,3})\s*[.．、]`)
+	examSubRe      = regexp.MustCompile(`^\s*[(（]\s*(\d{1,2})\s*[)）]`)
+	examScoreRe    = regexp.MustCompile(`[(（]\s*(\d+)\s*分\s*[)）]`)
+	examEachRe     = regexp.MustCompile(`每(?:小)?题\s*(\d+)\s*分`)
+	examTotalRe    = regexp.MustCompile(`共\s*(\d+)\s*分`)
+	examBlankRe    = regexp.MustCompile(`_{2,}|＿{2,}|[(（][\s\x{3000}]*[)）]`)
+)
+
+// examItem 行内公式或图片及其在行文本中的位置
+type examItem struct {
+	offset int
+	value  string
+}
+
+// examLine 一个段落或表格行的逻辑文本
+type examLine struct {
+	text   []rune
+	norm   []rune
+	math   []examItem
+	images []examItem
+	paras  []int
+	nodes  []*Node
+	boxes  []*Node
+}
+
+// ExtractExam 将文档切分为结构化的试题
+func ExtractExam(root *Node) *Exam {
+	lines := examLines(root)
+	exam := &Exam{Header: ExamContent{Paragraphs: []int{}}}
+
+	var section *ExamSection
+	var question, sub *Question
+	last := 0
+	for _, line := range lines {
+		norm := string(line.norm)
+
+		// 大题以“一、”开头，或是带分值说明的“填空题：”
+		m := examSectionRe.FindStringSubmatch(norm)
+		if m == nil && examTitleRe.MatchString(norm) && (examEachRe.MatchString(norm) || examTotalRe.MatchString(norm)) {
+			m = []string{"", ""}
+		}
+		if m != nil {
+			section = &ExamSection{Number: m[1], Questions: []*Question{}}
+			section.ExamContent = line.content(0, len(line.text))
+			if m := examEachRe.FindStringSubmatch(norm); m != nil {
+				section.ScoreEach, _ = strconv.Atoi(m[1])
+				section.ScoreNote = m[0]
+			}
+			if m := examTotalRe.FindStringSubmatch(norm); m != nil {
+				section.ScoreTotal, _ = strconv.Atoi(m[1])
+				section.ScoreNote = strings.TrimPrefix(section.ScoreNote+"，"+m[0], "，")
+			}
+			exam.Sections = append(exam.Sections, section)
+			question, sub, last = nil, nil, 0
+			continue
+		}
+
+		if m := examQuestionRe.FindStringSubmatchIndex(norm); m != nil && !followedByDigit(norm, m[1]) {
+			if num, _ := strconv.Atoi(norm[m[2]:m[3]]); num > last {
+				if section == nil {
+					section = &ExamSection{Questions: []*Question{}, ExamContent: ExamContent{Paragraphs: []int{}}}
+					exam.Sections = append(exam.Sections, section)
+				}
+				question = &Question{Number: strconv.Itoa(num)}
+				question.ExamContent = line.content(runeIndex(norm, m[1]), len(line.text))
+				question.Score = section.ScoreEach
+				question.scoreNote()
+				section.Questions = append(section.Questions, question)
+				sub, last = nil, num
+				continue
+			}
+		}
+
+		if m := examSubRe.FindStringSubmatchIndex(norm); m != nil && question != nil {
+			sub = &Question{Number: norm[m[2]:m[3]]}
+			sub.ExamContent = line.content(runeIndex(norm, m[1]), len(line.text))
+			sub.scoreNote()
+			question.SubQuestions = append(question.SubQuestions, sub)
+			continue
+		}
+
+		target := question
+		if sub != nil {
+			target = sub
+		}
+		if target != nil {
+			// 选项可能分多行排列，续行从下一个标号开始
+			first := 'A'
+			if n := len(target.Options); n > 0 {
+				first = rune(target.Options[n-1].Label[0]) + 1
+			}
+			if options := line.options(first); len(options) > 0 {
+				target.Options = append(target.Options, options...)
+				continue
+			}
+			target.append(line.content(0, len(line.text)))
+			continue
+		}
+		if section != nil {
+			section.append(line.content(0, len(line.text)))
+			continue
+		}
+		exam.Header.append(line.content(0, len(line.text)))
+	}
+	return exam
+}
+
+// ExamJson 解码主文档xml并返回切分结果的JSON
+func (s DocTrim) ExamJson(xmlData io.Reader) ([]byte, error) {
+	var root Node
+	if err := xml.NewDecoder(xmlData).Decode(&root); err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(ExtractExam(&root), "", "  ")
+}
+
+// scoreNote 提取题目中的分值说明，如“(16分)”
+func (q *Question) scoreNote() {
+	if m := examScoreRe.FindStringSubmatch(q.Text); m != nil {
+		q.Score, _ = strconv.Atoi(m[1])
+		q.ScoreNote = m[0]
+	}
+}
+
+// append 将续行追加到已有内容之后
+func (c *ExamContent) append(more ExamContent) {
+	if more.Text != "" {
+		if c.Text != "" {
+			c.Text += "\n"
+		}
+		c.Text += more.Text
+	}
+	c.Math = append(c.Math, more.Math...)
+	c.Images = append(c.Images, more.Images...)
+	c.Blanks += more.Blanks
+	c.Paragraphs = append(c.Paragraphs, more.Paragraphs...)
+	c.Nodes = append(c.Nodes, more.Nodes...)
+}
+
+// content 截取行中[from, to)范围的内容
+func (line *examLine) content(from, to int) ExamContent {
+	text := strings.TrimFunc(string(line.text[from:to]), unicode.IsSpace)
+	c := ExamContent{
+		Text:       text,
+		Blanks:     len(examBlankRe.FindAllString(text, -1)),
+		Paragraphs: append([]int{}, line.paras...),
+		Nodes:      append([]*Node{}, line.nodes...),
+	}
+	for _, m := range line.math {
+		if m.offset >= from && m.offset < to {
+			c.Math = append(c.Math, m.value)
+		}
+	}
+	for _, img := range line.images {
+		if img.offset >= from && img.offset < to {
+			c.Images = append(c.Images, img.value)
+		}
+	}
+	return c
+}
+
+// options 从标号first开始按字母顺序在行中查找选项标号并切分
+func (line *examLine) options(first rune) []*ExamOption {
+	starts := []int{}
+	labels := []string{}
+	pos := 0
+	for label := first; label <= 'H'; label++ {
+		found := -1
+		for i := pos; i+1 < len(line.norm); i++ {
+			if line.norm[i] != label || !strings.ContainsRune(".．、", line.norm[i+1]) {
+				continue
+			}
+			if i > 0 && isASCIILetter(line.norm[i-1]) {
+				continue
+			}
+			found = i
+			break
+		}
+		if found < 0 || (label == first && strings.TrimSpace(string(line.norm[:found])) != "") {
+			break
+		}
+		starts = append(starts, found)
+		labels = append(labels, string(label))
+		pos = found + 2
+	}
+	if len(starts) == 0 {
+		return nil
+	}
+
+	options := []*ExamOption{}
+	for i, start := range starts {
+		end := len(line.text)
+		if i+1 < len(starts) {
+			end = starts[i+1]
+		}
+		options = append(options, &ExamOption{Label: labels[i], ExamContent: line.content(start+2, end)})
+	}
+	return options
+}
+
+// examLines 按文档顺序收集段落和表格行
+func examLines(root *Node) []examLine {
+	lines := []examLine{}
+	para := 0
+
+	var walk func(node *Node)
+	walk = func(node *Node) {
+		for _, child := range node.Children {
+			switch child.XMLName.Local {
+			case "p":
+				line := examLine{paras: []int{para}, nodes: []*Node{child}}
+				para++
+				line.addParagraph(child)
+				lines = append(lines, line)
+				// 文本框中的段落紧随其所在段落
+				for _, box := range line.boxes {
+					walk(box)
+				}
+			case "tbl":
+				for _, tr := range child.Children {
+					if tr.XMLName.Local != "tr" {
+						continue
+					}
+					if !isOptionRow(tr) {
+						walk(tr)
+						continue
+					}
+					// 每格一段的多列表格行视为一行，选项可能按表格排列
+					line := examLine{}
+					for _, tc := range tr.Children {
+						if tc.XMLName.Local != "tc" {
+							continue
+						}
+						if len(line.text) > 0 {
+							line.text = append(line.text, '\t')
+						}
+						for _, p := range paragraphs(tc, nil) {
+							line.paras = append(line.paras, para)
+							line.nodes = append(line.nodes, p)
+							para++
+							line.addParagraph(p)
+						}
+					}
+					lines = append(lines, line)
+				}
+			case "sectPr":
+			default:
+				walk(child)
+			}
+		}
+	}
+	walk(root)
+
+	for i := range lines {
+		lines[i].normalize()
+	}
+	return lines
+}
+
+// paragraphs 收集子树中的段落，不进入段落内部
+func paragraphs(node *Node, found []*Node) []*Node {
+	for _, child := range node.Children {
+		if child.XMLName.Local == "p" {
+			found = append(found, child)
+			continue
+		}
+		found = paragraphs(child, found)
+	}
+	return found
+}
+
+// isOptionRow 判断表格行是否有多个单元格且每格至多一段
+func isOptionRow(tr *Node) bool {
+	cells := 0
+	for _, tc := range tr.Children {
+		if tc.XMLName.Local != "tc" {
+			continue
+		}
+		cells++
+		if len(paragraphs(tc, nil)) > 1 {
+			return false
+		}
+	}
+	return cells > 1
+}
+
+// addParagraph 追加段落中的文本、公式和图片
+func (line *examLine) addParagraph(p *Node) {
+	var walk func(node *Node)
+	walk = func(node *Node) {
+		for _, child := range node.Children {
+			switch child.XMLName.Local {
+			case "r":
+				if child.XMLName.Space == nsMath {
+					continue
+				}
+				line.addRun(child)
+			case "oMath", "oMathPara":
+				tex, err := OMMLToLatex(child)
+				if err != nil {
+					continue
+				}
+				line.math = append(line.math, examItem{offset: len(line.text), value: tex})
+				line.text = append(line.text, []rune("$"+tex+"$")...)
+			case "del", "pPr", "moveFrom":
+			default:
+				walk(child)
+			}
+		}
+	}
+	walk(p)
+}
+
+// addRun 追加w:r的内容，带下划线的空白视为填空
+func (line *examLine) addRun(r *Node) {
+	underline := false
+	if rPr := r.child("rPr"); rPr != nil {
+		if u := rPr.child("u"); u != nil {
+			val, _ := u.attr("val")
+			underline = val != "none"
+		}
+	}
+
+	for _, child := range r.Children {
+		switch child.XMLName.Local {
+		case "t":
+			text := string(child.Content)
+			if underline && strings.TrimSpace(strings.ReplaceAll(text, "　", "")) == "" {
+				text = "____"
+			}
+			line.text = append(line.text, []rune(text)...)
+		case "tab":
+			line.text = append(line.text, '\t')
+		case "br", "cr":
+			line.text = append(line.text, '\n')
+		case "drawing", "object", "pict", "AlternateContent":
+			for _, id := range imageRefs(child, nil) {
+				line.images = append(line.images, examItem{offset: len(line.text), value: id})
+			}
+			line.boxes = textBoxes(child, line.boxes)
+		}
+	}
+}
+
+// imageRefs 收集图片引用的关系ID，如a:blip的r:embed和v:imagedata的r:id
+// mc:Fallback与mc:Choice内容重复，不再收集
+func imageRefs(node *Node, refs []string) []string {
+	switch node.XMLName.Local {
+	case "Fallback":
+		return refs
+	case "blip", "imagedata":
+		for _, a := range node.Attrs {
+			if a.Name.Local == "embed" || a.Name.Local == "id" {
+				refs = append(refs, a.Value)
+			}
+		}
+	}
+	for _, child := range node.Children {
+		refs = imageRefs(child, refs)
+	}
+	return refs
+}
+
+// textBoxes 收集图形中的文本框内容w:txbxContent
+func textBoxes(node *Node, boxes []*Node) []*Node {
+	switch node.XMLName.Local {
+	case "txbxContent":
+		return append(boxes, node)
+	case "Fallback":
+		return boxes
+	}
+	for _, child := range node.Children {
+		boxes = textBoxes(child, boxes)
+	}
+	return boxes
+}
+
+// normalize 将全角数字和字母转换为半角，用于匹配题号和选项
+func (line *examLine) normalize() {
+	line.norm = make([]rune, len(line.text))
+	for i, r := range line.text {
+		// 全角与半角字符的码位相差0xFEE0
+		if (r >= '０' && r <= '９') || (r >= 'Ａ' && r <= 'Ｚ') {
+			r -= 0xFEE0
+		}
+		line.norm[i] = r
+	}
+}
+
+// followedByDigit 判断字节偏移pos之后是否紧跟数字，用于排除小数
+func followedByDigit(s string, pos int) bool {
+	return pos < len(s) && s[pos] >= '0' && s[pos] <= '9'
+}
+
+// runeIndex 将字节偏移转换为字符偏移
+func runeIndex(s string, pos int) int {
+	return len([]rune(s[:pos]))
+}
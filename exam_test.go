@@ -0,0 +1,92 @@
+package DocTrim
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+func TestExtractExam(t *testing.T) {
+	file, err := os.Open("docs/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	data, err := DocTrim{}.ExamJson(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var exam Exam
+	if err := json.Unmarshal(data, &exam); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(exam.Sections) != 3 {
+		t.Fatalf("got %d sections, want 3", len(exam.Sections))
+	}
+	choice := exam.Sections[0]
+	if choice.Number != "一" || choice.ScoreEach != 4 || choice.ScoreTotal != 40 {
+		t.Errorf("unexpected section: %+v", choice)
+	}
+
+	questions := map[string]*Question{}
+	for _, section := range exam.Sections {
+		for _, q := range section.Questions {
+			questions[q.Number] = q
+		}
+	}
+
+	q1 := questions["1"]
+	if q1 == nil || len(q1.Options) != 4 || q1.Options[3].Text != "－3" {
+		t.Fatalf("unexpected question 1: %+v", q1)
+	}
+	if q2 := questions["2"]; q2 == nil || len(q2.Options[0].Images) == 0 {
+		t.Errorf("option image not kept: %+v", q2)
+	}
+	if q15 := questions["15"]; q15 == nil || len(q15.Math) != 1 || q15.Math[0] != `x^{2}=3x` || q15.Blanks != 1 {
+		t.Errorf("unexpected question 15: %+v", q15)
+	}
+	if q18 := questions["18"]; q18 == nil || q18.Score != 16 {
+		t.Errorf("unexpected question 18: %+v", q18)
+	}
+	if q25 := questions["25"]; q25 == nil || len(q25.SubQuestions) != 2 {
+		t.Errorf("unexpected question 25: %+v", q25)
+	}
+}
+
+func TestExtractExamOptions(t *testing.T) {
+	src := `<w:document xmlns:w="` + nsWord + `"><w:body>
+<w:p><w:r><w:t>一、选择题：每小题3分</w:t></w:r></w:p>
+<w:p><w:r><w:t>1．下列各数中最小的是（　　）</w:t></w:r></w:p>
+<w:p><w:r><w:t>A．-2</w:t></w:r><w:r><w:tab/><w:t>B．0</w:t></w:r></w:p>
+<w:p><w:r><w:t>C．1</w:t></w:r><w:r><w:tab/><w:t>D．2</w:t></w:r></w:p>
+<w:p><w:r><w:t>2．比较大小</w:t></w:r></w:p>
+<w:tbl><w:tr>
+<w:tc><w:p><w:r><w:t>A．3</w:t></w:r></w:p></w:tc>
+<w:tc><w:p><w:r><w:t>B．4</w:t></w:r></w:p></w:tc>
+</w:tr></w:tbl>
+</w:body></w:document>`
+	var root Node
+	if err := xml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatal(err)
+	}
+
+	exam := ExtractExam(&root)
+	questions := exam.Sections[0].Questions
+	if len(questions) != 2 {
+		t.Fatalf("got %d questions", len(questions))
+	}
+	if q := questions[0]; len(q.Options) != 4 || q.Options[2].Text != "1" || q.Blanks != 1 || q.Score != 3 {
+		t.Errorf("unexpected question: %+v", q)
+	}
+	q := questions[1]
+	if len(q.Options) != 2 || q.Options[1].Text != "4" {
+		t.Fatalf("unexpected table options: %+v", q.Options)
+	}
+	if len(q.Options[1].Nodes) != 2 || q.Options[1].Paragraphs[1] != 6 {
+		t.Errorf("paragraph links lost: %+v", q.Options[1].ExamContent)
+	}
+}
@@ -0,0 +1,273 @@
+// 跨run查找替换
+// Word常把“{{customer_name}}”拆到多个rsid不同的w:r中，逐个节点替换无法命中
+// 查找在段落的逻辑文本上进行，命中结果映射回w:t节点；
+// 替换时把新文本写入第一个run，沿用其格式，其余被覆盖的文本从各自的run中删除
+
+package DocTrim
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// TextMatch 段落中的一处匹配，偏移量以字符计
+type TextMatch struct {
+	Paragraph *Node      `json:"-"`
+	Path      string     `json:"path"`
+	Text      string     `json:"text"`
+	Start     int        `json:"start"`
+	End       int        `json:"end"`
+	Spans     []NodeSpan `json:"spans"`
+}
+
+// NodeSpan 匹配覆盖的节点及节点文本中的字符范围
+type NodeSpan struct {
+	Node  *Node  `json:"-"`
+	Run   *Node  `json:"-"`
+	Path  string `json:"path"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// textSegment 段落逻辑文本中来自同一节点的一段，start为字节偏移
+type textSegment struct {
+	node  *Node
+	run   *Node
+	path  string
+	text  string
+	start int
+}
+
+// segmentText 返回run中制表符、换行等元素对应的文本
+var segmentText = map[string]string{"tab": "\t", "br": "\n", "cr": "\n", "noBreakHyphen": "-"}
+
+// compileQuery 将查找条件编译为正则表达式，regex为false时按普通文本匹配
+func compileQuery(pattern string, regex bool) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, errors.New("pattern is empty")
+	}
+	if !regex {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	return regexp.Compile(pattern)
+}
+
+// Find 在每个段落的逻辑文本中查找pattern，匹配可以跨越run
+func Find(root *Node, pattern string, regex bool) ([]TextMatch, error) {
+	re, err := compileQuery(pattern, regex)
+	if err != nil {
+		return nil, err
+	}
+	matches := []TextMatch{}
+	walkParagraphs(root, "/"+qualifiedName(root), func(p *Node, path string) {
+		segs, text := paragraphSegments(p, path)
+		for _, loc := range re.FindAllStringIndex(text, -1) {
+			if loc[0] == loc[1] {
+				continue
+			}
+			matches = append(matches, newTextMatch(p, path, text, segs, loc[0], loc[1]))
+		}
+	})
+	return matches, nil
+}
+
+// Replace 将匹配替换为replacement，返回替换的数量
+// regex为true时replacement中可以使用$1、${name}引用分组
+func Replace(root *Node, pattern, replacement string, regex bool) (int, error) {
+	re, err := compileQuery(pattern, regex)
+	if err != nil {
+		return 0, err
+	}
+	if !regex {
+		replacement = strings.ReplaceAll(replacement, "$", "$$")
+	}
+	replaced := 0
+	walkParagraphs(root, "/"+qualifiedName(root), func(p *Node, path string) {
+		segs, text := paragraphSegments(p, path)
+		locs := re.FindAllStringSubmatchIndex(text, -1)
+		// 从后向前替换，前面匹配的偏移量不受影响
+		for i := len(locs) - 1; i >= 0; i-- {
+			loc := locs[i]
+			if loc[0] == loc[1] {
+				continue
+			}
+			repl := string(re.ExpandString(nil, replacement, text, loc))
+			replaceSegments(segs, loc[0], loc[1], repl)
+			replaced++
+		}
+	})
+	if replaced > 0 {
+		root.clearDigests()
+	}
+	return replaced, nil
+}
+
+// ReplacePackage 在docx的正文、页眉页脚和脚注尾注中替换文本，返回替换的数量
+func ReplacePackage(pkg *Package, pattern, replacement string, regex bool) (int, error) {
+	total := 0
+	for _, name := range pkg.ContentParts() {
+		root, err := pkg.Part(name)
+		if err != nil {
+			return total, err
+		}
+		n, err := Replace(root, pattern, replacement, regex)
+		if err != nil {
+			return total, err
+		}
+		if n == 0 {
+			continue
+		}
+		if err := pkg.SetPart(name, root); err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// walkParagraphs 按文档顺序访问所有段落，包括文本框中的段落
+func walkParagraphs(node *Node, path string, visit func(p *Node, path string)) {
+	if node.XMLName.Space == nsWord && node.XMLName.Local == "p" {
+		visit(node, path)
+	}
+	paths := childPaths(node, path)
+	for i, child := range node.Children {
+		walkParagraphs(child, paths[i], visit)
+	}
+}
+
+// paragraphSegments 返回段落的逻辑文本及其分段，文本框中的段落、删除的文本和公式不计入
+func paragraphSegments(p *Node, path string) ([]textSegment, string) {
+	segs := []textSegment{}
+	var b strings.Builder
+	var walk func(node, run *Node, path string)
+	walk = func(node, run *Node, path string) {
+		paths := childPaths(node, path)
+		for i, child := range node.Children {
+			if child.XMLName.Space != nsWord {
+				if child.XMLName.Space != nsMath && child.XMLName.Local != "Fallback" {
+					walk(child, run, paths[i])
+				}
+				continue
+			}
+			local := child.XMLName.Local
+			switch {
+			case local == "r":
+				walk(child, child, paths[i])
+			case local == "t" && run != nil:
+				segs = append(segs, textSegment{node: child, run: run, path: paths[i], text: string(child.Content), start: b.Len()})
+				b.Write(child.Content)
+			case segmentText[local] != "" && node == run:
+				segs = append(segs, textSegment{node: child, run: run, path: paths[i], text: segmentText[local], start: b.Len()})
+				b.WriteString(segmentText[local])
+			case local == "pPr" || local == "rPr" || local == "txbxContent" || local == "p":
+			default:
+				walk(child, run, paths[i])
+			}
+		}
+	}
+	walk(p, nil, path)
+	return segs, b.String()
+}
+
+// newTextMatch 将逻辑文本中[start, end)字节范围映射为匹配结果
+func newTextMatch(p *Node, path, text string, segs []textSegment, start, end int) TextMatch {
+	m := TextMatch{
+		Paragraph: p,
+		Path:      path,
+		Text:      text[start:end],
+		Start:     utf8.RuneCountInString(text[:start]),
+		End:       utf8.RuneCountInString(text[:end]),
+	}
+	for _, seg := range segs {
+		a, b, ok := seg.cover(start, end)
+		if !ok {
+			continue
+		}
+		m.Spans = append(m.Spans, NodeSpan{
+			Node:  seg.node,
+			Run:   seg.run,
+			Path:  seg.path,
+			Start: utf8.RuneCountInString(seg.text[:a]),
+			End:   utf8.RuneCountInString(seg.text[:b]),
+		})
+	}
+	return m
+}
+
+// cover 返回[start, end)与本段重叠部分在段内的字节范围
+func (seg textSegment) cover(start, end int) (int, int, bool) {
+	a, b := start-seg.start, end-seg.start
+	if b <= 0 || a >= len(seg.text) {
+		return 0, 0, false
+	}
+	if a < 0 {
+		a = 0
+	}
+	if b > len(seg.text) {
+		b = len(seg.text)
+	}
+	return a, b, true
+}
+
+// replaceSegments 用repl替换[start, end)覆盖的内容
+// 新文本写入第一个被覆盖的节点，其余节点删除被覆盖的部分，完全覆盖的节点从run中删除
+func replaceSegments(segs []textSegment, start, end int, repl string) {
+	first := true
+	for _, seg := range segs {
+		a, b, ok := seg.cover(start, end)
+		if !ok {
+			continue
+		}
+		if segmentText[seg.node.XMLName.Local] != "" {
+			// 制表符、换行等整体被覆盖
+			if first && repl != "" {
+				t := newWordNode("t")
+				setText(t, repl)
+				replaceChild(seg.run, seg.node, t)
+			} else {
+				replaceChild(seg.run, seg.node, nil)
+			}
+			first = false
+			continue
+		}
+
+		// 之前从后向前的替换只会修改本节点b之后的内容
+		content := string(seg.node.Content)
+		suffix := content[b:]
+		text := suffix
+		if first {
+			text = content[:a] + repl + suffix
+		} else if a > 0 {
+			text = content[:a] + suffix
+		}
+		first = false
+		if text == "" {
+			replaceChild(seg.run, seg.node, nil)
+			continue
+		}
+		setText(seg.node, text)
+	}
+}
+
+// replaceChild 将parent中的old替换为node，node为nil时删除
+func replaceChild(parent, old, node *Node) {
+	children := make([]*Node, 0, len(parent.Children))
+	for _, c := range parent.Children {
+		switch {
+		case c != old:
+			children = append(children, c)
+		case node != nil:
+			children = append(children, node)
+		}
+	}
+	parent.Children = children
+}
+
+// setText 设置w:t的文本，首尾有空白时声明保留空白
+func setText(t *Node, text string) {
+	t.Content = []byte(text)
+	t.Attrs = textAttrs(t, t, t.Content)
+}
@@ -0,0 +1,104 @@
+package DocTrim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+const splitRuns = `<w:p xmlns:w="` + nsWord + `">` +
+	`<w:r w:rsidR="001"><w:rPr><w:b/></w:rPr><w:t>Dear {{cust</w:t></w:r>` +
+	`<w:r w:rsidR="002"><w:t>omer_</w:t></w:r>` +
+	`<w:r w:rsidR="003"><w:rPr><w:i/></w:rPr><w:t xml:space="preserve">name}}, {{x}} and {{y}}</w:t><w:tab/><w:t>end</w:t></w:r>` +
+	`</w:p>`
+
+func TestFind(t *testing.T) {
+	var p Node
+	if err := xml.Unmarshal([]byte(splitRuns), &p); err != nil {
+		t.Fatal(err)
+	}
+	matches, err := Find(&p, "{{customer_name}}", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 1 {
+		t.Fatalf("got %d matches, want 1", len(matches))
+	}
+	m := matches[0]
+	if m.Start != 5 || m.End != 22 || len(m.Spans) != 3 {
+		t.Fatalf("unexpected match %+v", m)
+	}
+	want := []NodeSpan{
+		{Path: "/w:p/w:r[1]/w:t[1]", Start: 5, End: 11},
+		{Path: "/w:p/w:r[2]/w:t[1]", Start: 0, End: 5},
+		{Path: "/w:p/w:r[3]/w:t[1]", Start: 0, End: 6},
+	}
+	for i, span := range m.Spans {
+		if span.Path != want[i].Path || span.Start != want[i].Start || span.End != want[i].End {
+			t.Errorf("span %d: got %s [%d,%d)", i, span.Path, span.Start, span.End)
+		}
+	}
+
+	tabbed, _ := Find(&p, `\}\}\tend`, true)
+	if len(tabbed) != 1 || len(tabbed[0].Spans) != 3 {
+		t.Errorf("tab match: %+v", tabbed)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	var p Node
+	xml.Unmarshal([]byte(splitRuns), &p)
+
+	n, err := Replace(&p, "{{customer_name}}", "张三 $1", false)
+	if err != nil || n != 1 {
+		t.Fatalf("replaced %d, %v", n, err)
+	}
+	n, _ = Replace(&p, `\{\{(\w)\}\}`, "<$1>", true)
+	if n != 2 {
+		t.Errorf("regex replaced %d, want 2", n)
+	}
+	if text := allText(&p); text != "Dear 张三 $1, <x> and <y>end" {
+		t.Errorf("got %q", text)
+	}
+
+	// 新文本沿用第一个run的格式，被完全覆盖的w:t删除
+	first := p.Children[0]
+	if first.child("rPr").child("b") == nil || string(first.child("t").Content) != "Dear 张三 $1" {
+		t.Error("replacement not in first run")
+	}
+	if p.Children[1].child("t") != nil {
+		t.Error("covered text left in second run")
+	}
+	if space, _ := p.Children[2].child("t").attr("space"); space != "preserve" {
+		t.Error("xml:space lost")
+	}
+
+	// 替换跨越制表符
+	n, _ = Replace(&p, "y>\tend", "Y", false)
+	if n != 1 || allText(&p) != "Dear 张三 $1, <x> and <Y" || p.Children[2].child("tab") != nil {
+		t.Errorf("got %q", allText(&p))
+	}
+}
+
+func TestReplacePackage(t *testing.T) {
+	pkg, err := DocTrim{}.OpenPackage("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := ReplacePackage(pkg, "配方法", "公式法", false)
+	if err != nil || n == 0 {
+		t.Fatalf("replaced %d, %v", n, err)
+	}
+	var buf bytes.Buffer
+	if err := pkg.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	back, _ := ReadPackage(buf.Bytes())
+	doc, _ := back.Part(documentPart)
+	text := ExtractText(doc, nil).Text
+	if strings.Contains(text, "配方法") || !strings.Contains(text, "用公式法解方程") {
+		t.Error("text not replaced")
+	}
+}
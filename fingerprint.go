@@ -0,0 +1,260 @@
+// 相似文档检测
+// 以去除编辑噪声后的段落子树哈希(Digest)和文本的三词片段为特征，计算MinHash和SimHash指纹
+// ComputeHash的序号只在一次Pack中有意义，跨文档比较使用与位置无关的Digest
+// SimilarityIndex用LSH分段索引指纹，查询时只比较至少有一段相同的候选文档
+
+package DocTrim
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+	"sort"
+	"strings"
+)
+
+const (
+	// minHashSize MinHash的哈希函数个数
+	minHashSize = 64
+	// lshBands LSH的分段数，每段minHashSize/lshBands个值
+	lshBands = 16
+	// shingleSize 文本片段的词数
+	shingleSize = 3
+)
+
+// Fingerprint 文档指纹
+type Fingerprint struct {
+	SimHash uint64              `json:"simhash"`
+	MinHash [minHashSize]uint64 `json:"minhash"`
+}
+
+// NewFingerprint 计算子树的指纹
+func NewFingerprint(root *Node) *Fingerprint {
+	fp := &Fingerprint{}
+	for i := range fp.MinHash {
+		fp.MinHash[i] = math.MaxUint64
+	}
+	votes := [64]int{}
+	for _, f := range fingerprintFeatures(root) {
+		for i := range fp.MinHash {
+			if h := mix64(f ^ minHashSeed(i)); h < fp.MinHash[i] {
+				fp.MinHash[i] = h
+			}
+		}
+		h := mix64(f)
+		for b := range votes {
+			if h&(1<<b) != 0 {
+				votes[b]++
+			} else {
+				votes[b]--
+			}
+		}
+	}
+	for b, v := range votes {
+		if v > 0 {
+			fp.SimHash |= 1 << b
+		}
+	}
+	return fp
+}
+
+// FingerprintFile 打开docx并计算主文档的指纹
+func (s DocTrim) FingerprintFile(url string) (*Fingerprint, error) {
+	pkg, err := s.OpenPackage(url)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := pkg.Part(documentPart)
+	if err != nil {
+		return nil, err
+	}
+	return NewFingerprint(doc), nil
+}
+
+// fingerprintFeatures 返回去重后的特征：每个段落的子树哈希和文本片段哈希
+func fingerprintFeatures(root *Node) []uint64 {
+	c := root.clone()
+	StripNoise(c, DefaultStripProfile)
+	seen := map[uint64]bool{}
+	features := []uint64{}
+	add := func(f uint64) {
+		if !seen[f] {
+			seen[f] = true
+			features = append(features, f)
+		}
+	}
+	walkParagraphs(c, "", func(p *Node, path string) {
+		add(p.Digest())
+		_, text := paragraphSegments(p, path)
+		words := []string{}
+		for _, w := range splitWords(text) {
+			if strings.TrimSpace(w) != "" {
+				words = append(words, w)
+			}
+		}
+		// 不足shingleSize个词的段落整体作为一个片段
+		for i := 0; i < len(words) && (i == 0 || i+shingleSize <= len(words)); i++ {
+			h := fnv.New64a()
+			for _, w := range words[i:min(i+shingleSize, len(words))] {
+				h.Write([]byte(w))
+				h.Write([]byte{0})
+			}
+			add(h.Sum64())
+		}
+	})
+	return features
+}
+
+// mix64 splitmix64的混合函数，使特征哈希的各位分布均匀
+func mix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// minHashSeed 第i个哈希函数的种子
+func minHashSeed(i int) uint64 {
+	return mix64(uint64(i) + 1)
+}
+
+// Similarity 返回两个指纹估计的Jaccard相似度，取值0到1
+func (fp *Fingerprint) Similarity(o *Fingerprint) float64 {
+	same := 0
+	for i := range fp.MinHash {
+		if fp.MinHash[i] == o.MinHash[i] {
+			same++
+		}
+	}
+	return float64(same) / minHashSize
+}
+
+// Distance 返回两个SimHash之间不同的位数
+func (fp *Fingerprint) Distance(o *Fingerprint) int {
+	return bits.OnesCount64(fp.SimHash ^ o.SimHash)
+}
+
+// band 返回第i段的哈希
+func (fp *Fingerprint) band(i int) uint64 {
+	rows := minHashSize / lshBands
+	h := uint64(i)
+	for _, v := range fp.MinHash[i*rows : (i+1)*rows] {
+		h = mix64(h ^ v)
+	}
+	return h
+}
+
+// SimilarMatch 查询结果
+type SimilarMatch struct {
+	Name  string  `json:"name"`
+	Score float64 `json:"score"`
+}
+
+// SimilarityIndex 指纹索引
+type SimilarityIndex struct {
+	names  []string
+	prints []*Fingerprint
+	bands  [lshBands]map[uint64][]int
+}
+
+// NewSimilarityIndex 创建空索引
+func NewSimilarityIndex() *SimilarityIndex {
+	idx := &SimilarityIndex{}
+	for i := range idx.bands {
+		idx.bands[i] = map[uint64][]int{}
+	}
+	return idx
+}
+
+// Add 加入一个文档的指纹
+func (idx *SimilarityIndex) Add(name string, fp *Fingerprint) {
+	id := len(idx.names)
+	idx.names = append(idx.names, name)
+	idx.prints = append(idx.prints, fp)
+	for i := range idx.bands {
+		b := fp.band(i)
+		idx.bands[i][b] = append(idx.bands[i][b], id)
+	}
+}
+
+// Len 返回索引中的文档数
+func (idx *SimilarityIndex) Len() int {
+	return len(idx.names)
+}
+
+// Query 返回相似度不低于threshold的文档，按相似度从高到低排序
+// threshold低于0.5时LSH会漏掉较多候选，改为逐个比较
+func (idx *SimilarityIndex) Query(fp *Fingerprint, threshold float64) []SimilarMatch {
+	matches := []SimilarMatch{}
+	for _, id := range idx.candidates(fp, threshold) {
+		if score := fp.Similarity(idx.prints[id]); score >= threshold {
+			matches = append(matches, SimilarMatch{Name: idx.names[id], Score: score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Score > matches[j].Score })
+	return matches
+}
+
+// candidates 返回至少有一段MinHash相同的文档，按加入顺序排列
+func (idx *SimilarityIndex) candidates(fp *Fingerprint, threshold float64) []int {
+	ids := []int{}
+	if threshold < 0.5 {
+		for id := range idx.names {
+			ids = append(ids, id)
+		}
+		return ids
+	}
+	seen := map[int]bool{}
+	for i := range idx.bands {
+		for _, id := range idx.bands[i][fp.band(i)] {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Cluster 将相似度不低于threshold的文档归为一组(传递闭包)，每组按加入顺序排列，单独的文档自成一组
+func (idx *SimilarityIndex) Cluster(threshold float64) ([][]string, error) {
+	if threshold <= 0 || threshold > 1 {
+		return nil, errors.New("threshold must be in (0, 1]")
+	}
+	parent := make([]int, len(idx.names))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for id, fp := range idx.prints {
+		for _, other := range idx.candidates(fp, threshold) {
+			if other > id && fp.Similarity(idx.prints[other]) >= threshold {
+				if a, b := find(id), find(other); a != b {
+					parent[max(a, b)] = min(a, b)
+				}
+			}
+		}
+	}
+
+	groups := map[int]int{}
+	clusters := [][]string{}
+	for id, name := range idx.names {
+		root := find(id)
+		g, ok := groups[root]
+		if !ok {
+			g = len(clusters)
+			groups[root] = g
+			clusters = append(clusters, nil)
+		}
+		clusters[g] = append(clusters[g], name)
+	}
+	return clusters, nil
+}
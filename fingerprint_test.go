@@ -0,0 +1,59 @@
+package DocTrim
+
+import (
+	"os"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+func TestFingerprint(t *testing.T) {
+	data, _ := os.ReadFile("docs/test.xml")
+	var paper Node
+	if err := xml.Unmarshal(data, &paper); err != nil {
+		t.Fatal(err)
+	}
+	edited := paper.clone()
+	if _, err := Replace(edited, "配方法", "公式法", false); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile("docs/document.xml")
+	var other Node
+	if err := xml.Unmarshal(data, &other); err != nil {
+		t.Fatal(err)
+	}
+
+	fp, fpEdited, fpOther := NewFingerprint(&paper), NewFingerprint(edited), NewFingerprint(&other)
+	if s := fp.Similarity(NewFingerprint(paper.clone())); s != 1 {
+		t.Errorf("identical documents: similarity %v", s)
+	}
+	if s := fp.Similarity(fpEdited); s < 0.7 || s == 1 {
+		t.Errorf("edited document: similarity %v", s)
+	}
+	if s := fp.Similarity(fpOther); s > 0.2 {
+		t.Errorf("different documents: similarity %v", s)
+	}
+	if fp.Distance(fpEdited) >= fp.Distance(fpOther) {
+		t.Errorf("simhash distance: edited %d, other %d", fp.Distance(fpEdited), fp.Distance(fpOther))
+	}
+
+	idx := NewSimilarityIndex()
+	idx.Add("paper", fp)
+	idx.Add("other", fpOther)
+	idx.Add("edited", fpEdited)
+	matches := idx.Query(fpEdited, 0.7)
+	if len(matches) != 2 || matches[0].Name != "edited" || matches[1].Name != "paper" {
+		t.Errorf("got %v", matches)
+	}
+
+	clusters, err := idx.Cluster(0.7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clusters) != 2 || len(clusters[0]) != 2 || clusters[0][1] != "edited" || clusters[1][0] != "other" {
+		t.Errorf("got %v", clusters)
+	}
+	if _, err := idx.Cluster(0); err == nil {
+		t.Error("threshold 0 should be rejected")
+	}
+}
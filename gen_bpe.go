@@ -0,0 +1,49 @@
+//go:build ignore
+
+// gen_bpe 在docs中的样例文档上训练内置的BPE合并表
+// 语料包括原始XML和Pack的输出，两种形式的计量都比较接近
+//
+//	go generate
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/nicedoc/DocTrim"
+)
+
+// mergeCount 合并规则的条数
+const mergeCount = 4000
+
+func main() {
+	files, err := filepath.Glob("docs/*.xml")
+	if err != nil {
+		log.Fatal(err)
+	}
+	corpus := [][]byte{}
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			log.Fatal(err)
+		}
+		corpus = append(corpus, data)
+		slim := DocTrim.DocTrim{}
+		packed, err := slim.Pack(bytes.NewReader(data))
+		if err != nil {
+			log.Fatal(err)
+		}
+		corpus = append(corpus, packed)
+	}
+
+	out, err := os.Create("bpe_merges.txt")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer out.Close()
+	if _, err := DocTrim.TrainBPE(corpus, mergeCount).WriteTo(out); err != nil {
+		log.Fatal(err)
+	}
+}
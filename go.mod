@@ -3,3 +3,5 @@ module github.com/nicedoc/DocTrim
 go 1.22.1
 
 require github.com/nbio/xml v0.0.0-20240506174850-2966041e20f2
+
+require golang.org/x/crypto v0.33.0
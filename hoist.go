@@ -0,0 +1,169 @@
+// 将重复的直接格式提取为样式
+// 同一个w:rPr/w:pPr在大量run或段落中重复出现时，在styles.xml中建立样式，
+// 内联的格式替换为w:rStyle/w:pStyle引用，显示效果不变
+// 出现次数沿用RegHash统计的refCount
+
+package DocTrim
+
+import (
+	"strconv"
+
+	"github.com/nbio/xml"
+)
+
+const (
+	hoistStylePrefix = "DocTrim"
+	// hoistStyleCost 一个样式定义除格式本身之外占用的字节数
+	hoistStyleCost = 160
+)
+
+// measure 按slim.Tokenizer计量数据的长度
+func (slim *DocTrim) measure(data []byte) int {
+	if slim.Tokenizer == nil {
+		return len(data)
+	}
+	return slim.Tokenizer.Count(data)
+}
+
+// hoistGroup 内容相同的一组格式
+type hoistGroup struct {
+	kind  string
+	props []*Node
+}
+
+// HoistFormatting 将出现次数不少于minCount的直接格式提取为styles中的样式，返回新建的样式数
+// 新样式以原来生效的缺省样式为基础，含有开关属性且段落样式也设置了该属性的run不提取，
+// 因为样式之间的开关属性取异或，而直接格式是绝对值
+func (slim *DocTrim) HoistFormatting(doc, styles *Node, minCount int) int {
+	st := newStyles(styles)
+	slim.Reset()
+	doc.ComputeHash(slim)
+
+	groups := map[uint64]*hoistGroup{}
+	order := []uint64{}
+	add := func(kind string, props *Node) {
+		if slim.dict[props.hash].refCount+1 < minCount {
+			return
+		}
+		g, ok := groups[props.hash]
+		if !ok {
+			g = &hoistGroup{kind: kind}
+			groups[props.hash] = g
+			order = append(order, props.hash)
+		}
+		g.props = append(g.props, props)
+	}
+	walkRuns(doc, nil, func(p, r *Node) {
+		if r == nil {
+			if pPr := p.child("pPr"); pPr != nil && hoistablePPr(pPr) {
+				add("paragraph", pPr)
+			}
+			return
+		}
+		if rPr := r.child("rPr"); rPr != nil && p != nil && hoistableRPr(rPr, st.styleProps(st.paragraphStyle(p.child("pPr")), true)) {
+			add("character", rPr)
+		}
+	})
+
+	created := 0
+	for _, hash := range order {
+		g := groups[hash]
+		if len(g.props) < minCount {
+			continue
+		}
+		own := hoistedProps(g.props[0])
+		size := 0
+		for _, c := range own {
+			data, _ := c.Marshal()
+			size += slim.measure(data)
+		}
+
+		id := ""
+		for n := created + 1; id == "" || st.styles[id] != nil; n++ {
+			id = hoistStylePrefix + string(g.kind[0]-'a'+'A') + strconv.Itoa(n)
+		}
+		refLocal := "rStyle"
+		if g.kind == "paragraph" {
+			refLocal = "pStyle"
+		}
+		ref := wordVal(refLocal, id)
+		data, _ := ref.Marshal()
+		// 按token计量时用不含格式的样式定义估计固定开销
+		cost := hoistStyleCost
+		if slim.Tokenizer != nil {
+			skeleton, _ := newStyle(g.kind, id, st.defaults[g.kind], nil).Marshal()
+			cost = slim.measure(skeleton)
+		}
+		if (size-slim.measure(data))*len(g.props) <= size+cost {
+			continue
+		}
+
+		styles.Children = append(styles.Children, newStyle(g.kind, id, st.defaults[g.kind], own))
+		st.styles[id] = &style{kind: g.kind}
+		for _, props := range g.props {
+			children := []*Node{wordVal(refLocal, id)}
+			if rPr := props.child("rPr"); rPr != nil && g.kind == "paragraph" {
+				children = append(children, rPr)
+			}
+			props.Children = children
+		}
+		created++
+	}
+	if created > 0 {
+		doc.clearDigests()
+		styles.clearDigests()
+	}
+	return created
+}
+
+// hoistablePPr 没有引用样式、不含分节和修订的段落属性才能提取
+func hoistablePPr(pPr *Node) bool {
+	if pPr.child("pStyle") != nil || pPr.child("sectPr") != nil || pPr.child("pPrChange") != nil {
+		return false
+	}
+	return len(hoistedProps(pPr)) > 0
+}
+
+// hoistableRPr 没有引用样式、不含修订，且开关属性不与段落样式冲突的run属性才能提取
+func hoistableRPr(rPr, paraRPr *Node) bool {
+	if rPr.child("rStyle") != nil || rPr.child("rPrChange") != nil || len(rPr.Children) == 0 {
+		return false
+	}
+	for _, c := range rPr.Children {
+		if toggleProps[c.XMLName.Local] && paraRPr != nil && paraRPr.child(c.XMLName.Local) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// hoistedProps 返回提取到样式中的子元素，段落标记的w:rPr留在段落中
+func hoistedProps(props *Node) []*Node {
+	own := []*Node{}
+	for _, c := range props.Children {
+		if c.XMLName.Local != "rPr" {
+			own = append(own, c)
+		}
+	}
+	return own
+}
+
+// newStyle 创建自定义样式
+func newStyle(kind, id, basedOn string, props []*Node) *Node {
+	node := newWordNode("style")
+	node.Attrs = append(node.Attrs,
+		xml.Attr{Name: xml.Name{Space: nsWord, Local: "type"}, Value: kind},
+		xml.Attr{Name: xml.Name{Space: nsWord, Local: "customStyle"}, Value: "1"},
+		xml.Attr{Name: xml.Name{Space: nsWord, Local: "styleId"}, Value: id},
+	)
+	node.Children = append(node.Children, wordVal("name", id))
+	if basedOn != "" {
+		node.Children = append(node.Children, wordVal("basedOn", basedOn))
+	}
+	local := "rPr"
+	if kind == "paragraph" {
+		local = "pPr"
+	}
+	node.Children = append(node.Children, newWordNode(local, props...))
+	return node
+}
@@ -0,0 +1,100 @@
+package DocTrim
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+func TestHoistFormatting(t *testing.T) {
+	run := `<w:r><w:rPr><w:rFonts w:ascii="Arial" w:hAnsi="Arial" w:eastAsia="黑体"/><w:color w:val="1F4E79"/><w:sz w:val="24"/><w:szCs w:val="24"/></w:rPr><w:t>x</w:t></w:r>`
+	bold := `<w:r><w:rPr><w:b/><w:rFonts w:ascii="Arial" w:hAnsi="Arial" w:eastAsia="黑体"/><w:color w:val="1F4E79"/><w:sz w:val="24"/></w:rPr><w:t>b</w:t></w:r>`
+	src := `<w:body xmlns:w="` + nsWord + `">` +
+		`<w:p>` + strings.Repeat(run, 4) + `</w:p>` +
+		`<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr>` + run + strings.Repeat(bold, 4) + `</w:p>` +
+		`</w:body>`
+	var doc, styles Node
+	if err := xml.Unmarshal([]byte(src), &doc); err != nil {
+		t.Fatal(err)
+	}
+	xml.Unmarshal([]byte(testStyles), &styles)
+	before := newStyles(&styles).Resolve(&doc)
+
+	s := DocTrim{}
+	if created := s.HoistFormatting(&doc, &styles, 3); created != 1 {
+		t.Errorf("created %d styles, want 1", created)
+	}
+	last := styles.Children[len(styles.Children)-1]
+	if id, _ := last.attr("styleId"); id != "DocTrimC1" {
+		t.Errorf("unexpected style %s", id)
+	}
+
+	// Heading1设置了w:b，带w:b的run不能提取
+	for i, r := range doc.Children[1].Children[1:] {
+		if hoisted := r.child("rPr").child("rStyle") != nil; hoisted != (i == 0) {
+			t.Errorf("run %d hoisted: %v", i, hoisted)
+		}
+	}
+
+	after := newStyles(&styles).Resolve(&doc)
+	for node, props := range before {
+		if node.XMLName.Local == "r" && !sameRunProps(props, after[node]) {
+			t.Errorf("run props changed: %s -> %s", propsString(props), propsString(after[node]))
+		}
+	}
+}
+
+// sameRunProps 比较两组有效属性，忽略顺序
+func sameRunProps(l, r *Node) bool {
+	if len(l.Children) != len(r.Children) {
+		return false
+	}
+	for _, c := range l.Children {
+		o := r.child(c.XMLName.Local)
+		if o == nil || !NodeEquals(c, o) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRepackHoist(t *testing.T) {
+	var plain, hoisted bytes.Buffer
+	if err := (DocTrim{}).Repack("docs/test.docx", &plain); err != nil {
+		t.Fatal(err)
+	}
+	if err := (DocTrim{HoistStyles: 3}).Repack("docs/test.docx", &hoisted); err != nil {
+		t.Fatal(err)
+	}
+	from, _ := ReadPackage(plain.Bytes())
+	to, err := ReadPackage(hoisted.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromDoc, _ := from.Data(documentPart)
+	toDoc, _ := to.Data(documentPart)
+	toStyles, _ := to.Data(stylesPart)
+	log.Printf("document.xml %d -> %d (hoist styles)", len(fromDoc), len(toDoc))
+	if len(toDoc) >= len(fromDoc) || !bytes.Contains(toStyles, []byte(`w:styleId="DocTrim`)) {
+		t.Error("no formatting hoisted")
+	}
+}
+
+func TestHoistFormattingTokens(t *testing.T) {
+	run := `<w:r><w:rPr><w:rFonts w:ascii="Arial" w:hAnsi="Arial" w:eastAsia="黑体"/><w:color w:val="1F4E79"/></w:rPr><w:t>x</w:t></w:r>`
+	for _, c := range []struct {
+		count, created int
+	}{{2, 0}, {6, 1}} {
+		var doc, styles Node
+		xml.Unmarshal([]byte(`<w:body xmlns:w="`+nsWord+`"><w:p>`+strings.Repeat(run, c.count)+`</w:p></w:body>`), &doc)
+		xml.Unmarshal([]byte(testStyles), &styles)
+		// 按token计量时样式定义的开销也按token估计
+		s := DocTrim{Tokenizer: DefaultTokenizer()}
+		if created := s.HoistFormatting(&doc, &styles, 2); created != c.created {
+			t.Errorf("%d runs: created %d styles, want %d", c.count, created, c.created)
+		}
+	}
+}
@@ -0,0 +1,767 @@
+// 将LaTeX公式转换为OMML
+// 生成与Word一致的m:oMath节点树，用于把LLM改写后的公式写回文档
+
+package DocTrim
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nbio/xml"
+)
+
+// texSymbols LaTeX命令到公式字符的映射，由symbolLatex反转并补充常用别名
+var texSymbols = func() map[string]string {
+	symbols := map[string]string{}
+	for r, cmd := range symbolLatex {
+		if strings.HasPrefix(cmd, `\`) {
+			symbols[cmd] = string(r)
+		}
+	}
+	aliases := map[string]string{
+		`\cdot`: "·", `\le`: "≤", `\ge`: "≥", `\ne`: "≠", `\to`: "→",
+		`\gets`: "←", `\dots`: "…", `\prime`: "′", `\lbrace`: "{", `\rbrace`: "}",
+		`\langle`: "⟨", `\rangle`: "⟩", `\lfloor`: "⌊", `\rfloor`: "⌋",
+		`\lceil`: "⌈", `\rceil`: "⌉", `\|`: "‖", `\vert`: "|", `\Vert`: "‖",
+		`\lvert`: "|", `\rvert`: "|", `\neq`: "≠",
+	}
+	for cmd, s := range aliases {
+		symbols[cmd] = s
+	}
+	return symbols
+}()
+
+// texTextEscapes \text中的转义命令到字符的映射，由textLatex反转
+var texTextEscapes = func() map[string]string {
+	escapes := map[string]string{}
+	for r, cmd := range textLatex {
+		escapes[strings.TrimSuffix(cmd, "{}")] = string(r)
+	}
+	return escapes
+}()
+
+// texNary LaTeX命令到n元运算符字符的映射
+var texNary = func() map[string]string {
+	nary := map[string]string{}
+	for chr, cmd := range naryLatex {
+		nary[cmd] = chr
+	}
+	return nary
+}()
+
+// texAccents LaTeX重音命令到组合字符的映射
+var texAccents = map[string]string{
+	`\hat`: "̂", `\widehat`: "̂", `\tilde`: "̃", `\widetilde`: "̃",
+	`\dot`: "̇", `\ddot`: "̈", `\bar`: "̅", `\vec`: "⃗",
+	`\overrightarrow`: "⃗", `\acute`: "́", `\grave`: "̀", `\breve`: "̆",
+	`\check`: "̌",
+}
+
+// texMatrixDelims 矩阵环境外层的定界符
+var texMatrixDelims = map[string][2]string{
+	"pmatrix": {"(", ")"},
+	"bmatrix": {"[", "]"},
+	"Bmatrix": {"{", "}"},
+	"vmatrix": {"|", "|"},
+	"Vmatrix": {"‖", "‖"},
+}
+
+// texSpaces 公式中忽略的间距命令
+var texSpaces = map[string]bool{
+	`\,`: true, `\;`: true, `\:`: true, `\!`: true, `\ `: true,
+	`\quad`: true, `\qquad`: true, `\limits`: true, `\nolimits`: true,
+	`\displaystyle`: true, `\textstyle`: true,
+}
+
+// texAtom 解析过程中的原子：单个字符、OMML结构或花括号分组
+type texAtom struct {
+	text    string
+	upright bool
+	node    *Node
+	group   []texAtom
+	isGroup bool
+}
+
+type texParser struct {
+	toks []string
+	pos  int
+}
+
+// LatexToOMML 将LaTeX公式转换为m:oMath节点
+func LatexToOMML(tex string) (*Node, error) {
+	p := &texParser{toks: tokenizeLatex(tex)}
+	atoms, _, err := p.parseSeq("")
+	if err != nil {
+		return nil, err
+	}
+	return newMathNode("oMath", atomsToNodes(atoms)...), nil
+}
+
+// tokenizeLatex 将LaTeX拆分为命令、字符和空格
+func tokenizeLatex(tex string) []string {
+	toks := []string{}
+	for i := 0; i < len(tex); {
+		r, size := utf8.DecodeRuneInString(tex[i:])
+		switch {
+		case unicode.IsSpace(r):
+			for i < len(tex) {
+				r, size = utf8.DecodeRuneInString(tex[i:])
+				if !unicode.IsSpace(r) {
+					break
+				}
+				i += size
+			}
+			toks = append(toks, " ")
+			continue
+		case r == '\\' && i+1 < len(tex):
+			j := i + 1
+			for j < len(tex) && isASCIILetter(rune(tex[j])) {
+				j++
+			}
+			if j == i+1 {
+				_, size = utf8.DecodeRuneInString(tex[j:])
+				j += size
+			}
+			toks = append(toks, tex[i:j])
+			i = j
+			continue
+		}
+		toks = append(toks, tex[i:i+size])
+		i += size
+	}
+	return toks
+}
+
+// peek 返回下一个非空格记号，到达末尾时返回空字符串
+func (p *texParser) peek() string {
+	for p.pos < len(p.toks) && p.toks[p.pos] == " " {
+		p.pos++
+	}
+	if p.pos >= len(p.toks) {
+		return ""
+	}
+	return p.toks[p.pos]
+}
+
+func (p *texParser) next() string {
+	tok := p.peek()
+	if tok != "" {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *texParser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		return fmt.Errorf("latex: expected %q, got %q", tok, got)
+	}
+	return nil
+}
+
+// rawGroup 读取花括号内的原始文本，保留空格
+func (p *texParser) rawGroup() (string, error) {
+	if err := p.expect("{"); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for depth := 1; p.pos < len(p.toks); p.pos++ {
+		tok := p.toks[p.pos]
+		switch tok {
+		case "{":
+			depth++
+		case "}":
+			depth--
+			if depth == 0 {
+				p.pos++
+				return b.String(), nil
+			}
+		}
+		if s, ok := texTextEscapes[tok]; ok {
+			// \textbackslash等命令后的空分组或空格只用于结束命令
+			if len(tok) > 2 && p.pos+2 < len(p.toks) && p.toks[p.pos+1] == "{" && p.toks[p.pos+2] == "}" {
+				p.pos += 2
+			} else if len(tok) > 2 && p.pos+1 < len(p.toks) && p.toks[p.pos+1] == " " {
+				p.pos++
+			}
+			tok = s
+		} else if s, ok := texSymbols[tok]; ok && len(tok) == 2 {
+			tok = s
+		}
+		b.WriteString(tok)
+	}
+	return "", errors.New("latex: unterminated group")
+}
+
+// parseSeq 解析原子序列直到遇到stops中的记号，空字符串表示输入结束
+// 返回解析到的原子以及结束记号，结束记号已被消费
+func (p *texParser) parseSeq(stops ...string) ([]texAtom, string, error) {
+	atoms := []texAtom{}
+	for {
+		tok := p.peek()
+		for _, stop := range stops {
+			if tok == stop {
+				p.next()
+				return atoms, tok, nil
+			}
+		}
+		if tok == "" {
+			return nil, "", fmt.Errorf("latex: unexpected end, expected %q", stops)
+		}
+
+		if tok == "^" || tok == "_" {
+			var base texAtom
+			if len(atoms) > 0 {
+				base = atoms[len(atoms)-1]
+				atoms = atoms[:len(atoms)-1]
+			} else {
+				base = texAtom{isGroup: true}
+			}
+			atom, err := p.parseScripts(base)
+			if err != nil {
+				return nil, "", err
+			}
+			atoms = append(atoms, atom)
+			continue
+		}
+
+		atom, err := p.parseAtom()
+		if err != nil {
+			return nil, "", err
+		}
+		if atom != nil {
+			atoms = append(atoms, *atom)
+		}
+	}
+}
+
+// parseArg 解析命令参数：花括号分组或单个原子
+func (p *texParser) parseArg() ([]texAtom, error) {
+	if p.peek() == "{" {
+		p.next()
+		atoms, _, err := p.parseSeq("}")
+		return atoms, err
+	}
+	atom, err := p.parseAtom()
+	if err != nil || atom == nil {
+		return nil, err
+	}
+	return []texAtom{*atom}, nil
+}
+
+// parseOperand 解析n元运算符或函数的作用对象，未加括号的原子连同其上下标一起解析
+func (p *texParser) parseOperand() ([]texAtom, error) {
+	if tok := p.peek(); tok == "" || tok == "}" || tok == "&" || tok == `\\` || tok == `\right` || tok == `\middle` || tok == `\end` {
+		return nil, nil
+	}
+	braced := p.peek() == "{"
+	e, err := p.parseArg()
+	if err != nil || braced || len(e) != 1 {
+		return e, err
+	}
+	if tok := p.peek(); tok == "^" || tok == "_" {
+		atom, err := p.parseScripts(e[0])
+		if err != nil {
+			return nil, err
+		}
+		return []texAtom{atom}, nil
+	}
+	return e, nil
+}
+
+// parseLimits 解析紧随其后的上下标，未出现的返回nil
+func (p *texParser) parseLimits() (sub, sup []texAtom, err error) {
+	for {
+		switch p.peek() {
+		case "_":
+			p.next()
+			if sub, err = p.parseArg(); err != nil {
+				return nil, nil, err
+			}
+			if sub == nil {
+				sub = []texAtom{}
+			}
+		case "^":
+			p.next()
+			if sup, err = p.parseArg(); err != nil {
+				return nil, nil, err
+			}
+			if sup == nil {
+				sup = []texAtom{}
+			}
+		default:
+			return sub, sup, nil
+		}
+	}
+}
+
+// parseScripts 将底数与上下标组合为m:sSup、m:sSub、m:sSubSup或m:sPre
+func (p *texParser) parseScripts(base texAtom) (texAtom, error) {
+	sub, sup, err := p.parseLimits()
+	if err != nil {
+		return texAtom{}, err
+	}
+
+	// {}_{a}^{b}X 表示左上下标
+	if base.isGroup && len(base.group) == 0 {
+		e, err := p.parseArg()
+		if err != nil {
+			return texAtom{}, err
+		}
+		return nodeAtom(newMathNode("sPre",
+			mathContainer("sub", sub), mathContainer("sup", sup), mathContainer("e", e))), nil
+	}
+
+	e := mathContainer("e", []texAtom{base})
+	switch {
+	case sub != nil && sup != nil:
+		return nodeAtom(newMathNode("sSubSup", e, mathContainer("sub", sub), mathContainer("sup", sup))), nil
+	case sub != nil:
+		return nodeAtom(newMathNode("sSub", e, mathContainer("sub", sub))), nil
+	}
+	return nodeAtom(newMathNode("sSup", e, mathContainer("sup", sup))), nil
+}
+
+// parseAtom 解析单个原子，间距命令返回nil
+func (p *texParser) parseAtom() (*texAtom, error) {
+	tok := p.next()
+	switch tok {
+	case "":
+		return nil, errors.New("latex: unexpected end")
+	case "{":
+		atoms, _, err := p.parseSeq("}")
+		if err != nil {
+			return nil, err
+		}
+		return &texAtom{group: atoms, isGroup: true}, nil
+	case "}", "&", `\\`, `\right`, `\end`, `\middle`:
+		return nil, fmt.Errorf("latex: unexpected %q", tok)
+	case "'":
+		return &texAtom{text: "′"}, nil
+	}
+
+	if !strings.HasPrefix(tok, `\`) {
+		return &texAtom{text: tok}, nil
+	}
+	if texSpaces[tok] {
+		return nil, nil
+	}
+	if s, ok := texSymbols[tok]; ok {
+		return &texAtom{text: s}, nil
+	}
+	if len(tok) == 2 && !isASCIILetter(rune(tok[1])) {
+		return &texAtom{text: tok[1:]}, nil
+	}
+	if chr, ok := texNary[tok]; ok {
+		return p.parseNary(chr)
+	}
+	if chr, ok := texAccents[tok]; ok {
+		e, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		acc := newMathNode("acc", mathContainer("e", e))
+		if chr != "̂" {
+			acc.Children = append([]*Node{newMathNode("accPr", mathVal("chr", chr))}, acc.Children...)
+		}
+		return &texAtom{node: acc}, nil
+	}
+	if name := tok[1:]; mathFuncs[name] {
+		return p.parseFunc(name)
+	}
+	return p.parseCommand(tok)
+}
+
+// parseCommand 解析带参数的结构命令
+func (p *texParser) parseCommand(cmd string) (*texAtom, error) {
+	switch cmd {
+	case `\frac`, `\dfrac`, `\tfrac`, `\binom`:
+		num, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		den, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		if cmd == `\binom` {
+			f := newMathNode("f", newMathNode("fPr", mathVal("type", "noBar")),
+				mathContainer("num", num), mathContainer("den", den))
+			return &texAtom{node: newMathNode("d", newMathNode("e", f))}, nil
+		}
+		return &texAtom{node: newMathNode("f", mathContainer("num", num), mathContainer("den", den))}, nil
+	case `\genfrac`:
+		args := make([]string, 4)
+		for i := range args {
+			raw, err := p.rawGroup()
+			if err != nil {
+				return nil, err
+			}
+			args[i] = strings.TrimSpace(raw)
+		}
+		num, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		den, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		f := newMathNode("f", mathContainer("num", num), mathContainer("den", den))
+		if args[2] == "0pt" || args[2] == "0" {
+			f.Children = append([]*Node{newMathNode("fPr", mathVal("type", "noBar"))}, f.Children...)
+		}
+		return &texAtom{node: f}, nil
+	case `\sqrt`:
+		var deg []texAtom
+		if p.peek() == "[" {
+			p.next()
+			var err error
+			if deg, _, err = p.parseSeq("]"); err != nil {
+				return nil, err
+			}
+		}
+		e, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		rad := newMathNode("rad", mathContainer("deg", deg), mathContainer("e", e))
+		if len(deg) == 0 {
+			rad.Children = append([]*Node{newMathNode("radPr", mathVal("degHide", "1"))}, rad.Children...)
+		}
+		return &texAtom{node: rad}, nil
+	case `\left`:
+		return p.parseDelim()
+	case `\begin`:
+		return p.parseEnv()
+	case `\overline`, `\underline`:
+		e, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		bar := newMathNode("bar", mathContainer("e", e))
+		if cmd == `\overline` {
+			bar.Children = append([]*Node{newMathNode("barPr", mathVal("pos", "top"))}, bar.Children...)
+		}
+		return &texAtom{node: bar}, nil
+	case `\overbrace`, `\underbrace`:
+		e, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		pr := newMathNode("groupChrPr")
+		if cmd == `\overbrace` {
+			pr.Children = append(pr.Children, mathVal("chr", "⏞"), mathVal("pos", "top"), mathVal("vertJc", "bot"))
+		}
+		return &texAtom{node: newMathNode("groupChr", pr, mathContainer("e", e))}, nil
+	case `\boxed`:
+		e, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		return &texAtom{node: newMathNode("borderBox", mathContainer("e", e))}, nil
+	case `\underset`, `\overset`:
+		lim, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		e, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		local := "limLow"
+		if cmd == `\overset` {
+			local = "limUpp"
+		}
+		return &texAtom{node: newMathNode(local, mathContainer("e", e), mathContainer("lim", lim))}, nil
+	case `\mathrm`, `\operatorname`, `\mathit`, `\mathbf`:
+		text, err := p.rawGroup()
+		if err != nil {
+			return nil, err
+		}
+		atoms := []texAtom{}
+		for _, r := range strings.ReplaceAll(text, " ", "") {
+			atoms = append(atoms, texAtom{text: string(r), upright: cmd != `\mathit`})
+		}
+		return &texAtom{group: atoms, isGroup: true}, nil
+	case `\text`, `\mbox`:
+		text, err := p.rawGroup()
+		if err != nil {
+			return nil, err
+		}
+		return &texAtom{node: newTextRun(text)}, nil
+	}
+	return nil, fmt.Errorf("latex: unsupported command %s", cmd)
+}
+
+// parseNary 解析n元运算符及其上下限和被积式
+func (p *texParser) parseNary(chr string) (*texAtom, error) {
+	sub, sup, err := p.parseLimits()
+	if err != nil {
+		return nil, err
+	}
+	e, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	pr := newMathNode("naryPr")
+	if chr != "∫" {
+		pr.Children = append(pr.Children, mathVal("chr", chr), mathVal("limLoc", "undOvr"))
+	}
+	if len(sub) == 0 {
+		pr.Children = append(pr.Children, mathVal("subHide", "1"))
+	}
+	if len(sup) == 0 {
+		pr.Children = append(pr.Children, mathVal("supHide", "1"))
+	}
+	return &texAtom{node: newMathNode("nary", pr,
+		mathContainer("sub", sub), mathContainer("sup", sup), mathContainer("e", e))}, nil
+}
+
+// parseFunc 解析函数名及其参数，函数名可带上下标，如\lim_{x\to 0}、\sin^{2}
+func (p *texParser) parseFunc(name string) (*texAtom, error) {
+	fName := []*Node{newMathRun(name, true)}
+	sub, sup, err := p.parseLimits()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case sub != nil && (name == "lim" || name == "max" || name == "min" || name == "sup" || name == "inf"):
+		fName = []*Node{newMathNode("limLow", newMathNode("e", fName...), mathContainer("lim", sub))}
+	case sub != nil && sup != nil:
+		fName = []*Node{newMathNode("sSubSup", newMathNode("e", fName...), mathContainer("sub", sub), mathContainer("sup", sup))}
+	case sub != nil:
+		fName = []*Node{newMathNode("sSub", newMathNode("e", fName...), mathContainer("sub", sub))}
+	case sup != nil:
+		fName = []*Node{newMathNode("sSup", newMathNode("e", fName...), mathContainer("sup", sup))}
+	}
+
+	e, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return &texAtom{node: newMathNode("func", newMathNode("fName", fName...), mathContainer("e", e))}, nil
+}
+
+// parseDelimChr 读取\left、\middle、\right之后的定界符
+func (p *texParser) parseDelimChr() (string, error) {
+	tok := p.next()
+	switch tok {
+	case "":
+		return "", errors.New("latex: missing delimiter")
+	case ".":
+		return "", nil
+	}
+	if s, ok := texSymbols[tok]; ok {
+		return s, nil
+	}
+	if strings.HasPrefix(tok, `\`) && len(tok) == 2 {
+		return tok[1:], nil
+	}
+	return tok, nil
+}
+
+// parseDelim 解析\left ... \middle ... \right为m:d
+func (p *texParser) parseDelim() (*texAtom, error) {
+	beg, err := p.parseDelimChr()
+	if err != nil {
+		return nil, err
+	}
+	d := newMathNode("d")
+	sep := ""
+	for {
+		items, stop, err := p.parseSeq(`\middle`, `\right`)
+		if err != nil {
+			return nil, err
+		}
+		d.Children = append(d.Children, mathContainer("e", items))
+		chr, err := p.parseDelimChr()
+		if err != nil {
+			return nil, err
+		}
+		if stop == `\right` {
+			pr := delimPr(beg, chr)
+			if sep != "" && sep != "|" {
+				pr.Children = append(pr.Children, mathVal("sepChr", sep))
+			}
+			if len(pr.Children) > 0 {
+				d.Children = append([]*Node{pr}, d.Children...)
+			}
+			return &texAtom{node: d}, nil
+		}
+		sep = chr
+	}
+}
+
+// delimPr 生成m:dPr，缺省的圆括号不写出
+func delimPr(beg, end string) *Node {
+	pr := newMathNode("dPr")
+	if beg != "(" {
+		pr.Children = append(pr.Children, mathVal("begChr", beg))
+	}
+	if end != ")" {
+		pr.Children = append(pr.Children, mathVal("endChr", end))
+	}
+	return pr
+}
+
+// parseEnv 解析matrix、cases、aligned等环境
+func (p *texParser) parseEnv() (*texAtom, error) {
+	name, err := p.rawGroup()
+	if err != nil {
+		return nil, err
+	}
+
+	rows := [][][]texAtom{{}}
+	for {
+		cell, stop, err := p.parseSeq("&", `\\`, `\end`)
+		if err != nil {
+			return nil, err
+		}
+		row := &rows[len(rows)-1]
+		*row = append(*row, cell)
+		if stop == `\\` {
+			rows = append(rows, [][]texAtom{})
+		}
+		if stop == `\end` {
+			break
+		}
+	}
+	if end, err := p.rawGroup(); err != nil || end != name {
+		return nil, fmt.Errorf("latex: \\begin{%s} closed by \\end{%s}", name, end)
+	}
+	// 忽略末尾的\\产生的空行
+	if last := rows[len(rows)-1]; len(rows) > 1 && len(last) == 1 && len(last[0]) == 0 {
+		rows = rows[:len(rows)-1]
+	}
+
+	switch name {
+	case "matrix", "pmatrix", "bmatrix", "Bmatrix", "vmatrix", "Vmatrix":
+		m := newMathNode("m")
+		for _, row := range rows {
+			mr := newMathNode("mr")
+			for _, cell := range row {
+				mr.Children = append(mr.Children, mathContainer("e", cell))
+			}
+			m.Children = append(m.Children, mr)
+		}
+		delims, ok := texMatrixDelims[name]
+		if !ok {
+			return &texAtom{node: m}, nil
+		}
+		d := newMathNode("d", newMathNode("e", m))
+		if pr := delimPr(delims[0], delims[1]); len(pr.Children) > 0 {
+			d.Children = append([]*Node{pr}, d.Children...)
+		}
+		return &texAtom{node: d}, nil
+	case "cases", "aligned", "align", "align*", "gathered", "array":
+		eqArr := newMathNode("eqArr")
+		for _, row := range rows {
+			atoms := []texAtom{}
+			for _, cell := range row {
+				atoms = append(atoms, cell...)
+			}
+			eqArr.Children = append(eqArr.Children, mathContainer("e", atoms))
+		}
+		if name != "cases" {
+			return &texAtom{node: eqArr}, nil
+		}
+		return &texAtom{node: newMathNode("d", delimPr("{", ""), newMathNode("e", eqArr))}, nil
+	}
+	return nil, fmt.Errorf("latex: unsupported environment %s", name)
+}
+
+func nodeAtom(node *Node) texAtom {
+	return texAtom{node: node}
+}
+
+// atomsToNodes 将原子序列转换为OMML节点，相邻同样式的字符合并为一个m:r
+func atomsToNodes(atoms []texAtom) []*Node {
+	nodes := []*Node{}
+	var text strings.Builder
+	upright := false
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, newMathRun(text.String(), upright))
+			text.Reset()
+		}
+	}
+
+	var walk func(atoms []texAtom)
+	walk = func(atoms []texAtom) {
+		for _, atom := range atoms {
+			switch {
+			case atom.isGroup:
+				walk(atom.group)
+			case atom.node != nil:
+				flush()
+				nodes = append(nodes, atom.node)
+			default:
+				if atom.upright != upright {
+					flush()
+					upright = atom.upright
+				}
+				text.WriteString(atom.text)
+			}
+		}
+	}
+	walk(atoms)
+	flush()
+	return nodes
+}
+
+// newMathNode 创建m命名空间下的元素
+func newMathNode(local string, children ...*Node) *Node {
+	return &Node{
+		XMLName:  xml.Name{Space: nsMath, Local: local},
+		Attrs:    []xml.Attr{},
+		Content:  []byte{},
+		Children: children,
+	}
+}
+
+// mathContainer 创建包含原子序列的参数元素，如m:e、m:num
+func mathContainer(local string, atoms []texAtom) *Node {
+	return newMathNode(local, atomsToNodes(atoms)...)
+}
+
+// mathVal 创建带m:val属性的属性元素
+func mathVal(local, val string) *Node {
+	node := newMathNode(local)
+	node.Attrs = []xml.Attr{{Name: xml.Name{Space: nsMath, Local: "val"}, Value: val}}
+	return node
+}
+
+// newMathRun 创建与Word一致的m:r，正体文本带m:sty
+func newMathRun(text string, upright bool) *Node {
+	run := newMathNode("r")
+	if upright {
+		run.Children = append(run.Children, newMathNode("rPr", mathVal("sty", "p")))
+	}
+	fonts := &Node{
+		XMLName: xml.Name{Space: nsWord, Local: "rFonts"},
+		Attrs: []xml.Attr{
+			{Name: xml.Name{Space: nsWord, Local: "ascii"}, Value: "Cambria Math"},
+			{Name: xml.Name{Space: nsWord, Local: "hAnsi"}, Value: "Cambria Math"},
+		},
+		Content:  []byte{},
+		Children: []*Node{},
+	}
+	rPr := &Node{XMLName: xml.Name{Space: nsWord, Local: "rPr"}, Attrs: []xml.Attr{}, Content: []byte{}, Children: []*Node{fonts}}
+	t := newMathNode("t")
+	t.Content = []byte(text)
+	run.Children = append(run.Children, rPr, t)
+	return run
+}
+
+// newTextRun 创建公式中的普通文本w:r
+func newTextRun(text string) *Node {
+	t := &Node{XMLName: xml.Name{Space: nsWord, Local: "t"}, Attrs: []xml.Attr{}, Content: []byte(text), Children: []*Node{}}
+	if strings.TrimSpace(text) != text {
+		t.Attrs = append(t.Attrs, xml.Attr{Name: xml.Name{Space: nsXML, Local: "space"}, Value: "preserve"})
+	}
+	return &Node{XMLName: xml.Name{Space: nsWord, Local: "r"}, Attrs: []xml.Attr{}, Content: []byte{}, Children: []*Node{t}}
+}
@@ -0,0 +1,129 @@
+package DocTrim
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+// roundTripLatex 验证LaTeX经OMML转换后再转回LaTeX保持不变
+func roundTripLatex(t *testing.T, tex string) {
+	node, err := LatexToOMML(tex)
+	if err != nil {
+		t.Fatalf("%s: %v", tex, err)
+	}
+	got, err := OMMLToLatex(node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != tex {
+		t.Errorf("round trip %q -> %q", tex, got)
+	}
+}
+
+func TestLatexRoundTripFixtures(t *testing.T) {
+	sources := [][]byte{[]byte(testXml)}
+	for _, filename := range []string{"docs/document.xml", "docs/test.xml", "docs/text.xml"} {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, data)
+	}
+
+	count := 0
+	for _, data := range sources {
+		var root Node
+		if err := xml.Unmarshal(data, &root); err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range findMath(&root, nil) {
+			tex, err := OMMLToLatex(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			roundTripLatex(t, tex)
+			count++
+		}
+	}
+	if count == 0 {
+		t.Fatal("no formulas found in fixtures")
+	}
+}
+
+func TestLatexRoundTripStructures(t *testing.T) {
+	cases := []string{
+		`\frac{a}{b}`,
+		`\sqrt{2}`,
+		`\sqrt[3]{x}`,
+		`\sum_{i=1}^{n}{i}`,
+		`\int{f\left(x\right)}`,
+		`a_{n}`,
+		`x_{i}^{2}`,
+		`\left\{x\right.`,
+		`\left(a\middle|b\right)`,
+		`\begin{matrix}1&0\\0&1\end{matrix}`,
+		`\vec{a}`,
+		`\sin{\alpha}`,
+		`\lim_{x\rightarrow0}{\frac{\sin{x}}{x}}`,
+		`\alpha\leq\beta`,
+		`\mathrm{cm}`,
+		`\overline{AB}`,
+		`\triangle ABC\backsim\triangle DEF`,
+	}
+	for _, tex := range cases {
+		roundTripLatex(t, tex)
+	}
+}
+
+func TestLatexToOMMLShape(t *testing.T) {
+	node, err := LatexToOMML(`x^2+1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(node.Children) != 2 || node.Children[0].XMLName.Local != "sSup" || node.Children[1].XMLName.Local != "r" {
+		t.Fatalf("unexpected shape: %+v", node.Children)
+	}
+	if got := runText(node.Children[1]); got != "+1" {
+		t.Errorf("got run %q", got)
+	}
+
+	if _, err := LatexToOMML(`\frac{a}`); err == nil {
+		t.Error("expected error for missing argument")
+	}
+	if _, err := LatexToOMML(`\unknown{x}`); err == nil {
+		t.Error("expected error for unknown command")
+	}
+}
+
+func TestUnpackEditedLatex(t *testing.T) {
+	s := DocTrim{MathToLatex: true}
+	data, err := s.Pack(bytes.NewReader([]byte(testXml)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := bytes.Replace(data, []byte(`_tex="x^{2}+4x+1=0"`), []byte(`_tex="x^{2}+4x+3=0"`), 1)
+
+	// 新的实例没有原始公式，全部由LaTeX生成
+	to, err := DocTrim{}.Unpack(bytes.NewReader(edited))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var root Node
+	if err := xml.Unmarshal(to, &root); err != nil {
+		t.Fatal(err)
+	}
+	maths := findMath(&root, nil)
+	if len(maths) == 0 {
+		t.Fatal("no formulas after unpack")
+	}
+	tex, err := OMMLToLatex(maths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tex != `x^{2}+4x+3=0` {
+		t.Errorf("got %q", tex)
+	}
+}
@@ -0,0 +1,398 @@
+// 格式一致性检查
+// 排版时逐段调整格式，容易留下只差w:hint或w:szCs的格式变体、正文字号不统一、
+// 中西文字体设置混乱以及直接加粗放大代替标题样式等问题
+// Lint复用ComputeHash的hashDict区分不同的w:rPr，每条结果附带相关节点的路径
+
+package DocTrim
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 检查规则
+const (
+	// LintPropertyVariants 只差w:hint或w:szCs的run格式
+	LintPropertyVariants = "property-variants"
+	// LintFontSizes 正文字号过多
+	LintFontSizes = "font-sizes"
+	// LintMixedFonts 中西文字体设置混乱
+	LintMixedFonts = "mixed-fonts"
+	// LintDirectHeading 用直接格式代替标题样式
+	LintDirectHeading = "direct-heading"
+)
+
+const (
+	// defaultMaxFontSizes 正文允许的缺省字号数
+	defaultMaxFontSizes = 2
+	// lintHeadingLength 疑似标题的段落的最大字符数
+	lintHeadingLength = 40
+)
+
+// LintOptions 检查选项
+type LintOptions struct {
+	// Styles 样式表，用于计算有效字号和识别标题样式，为nil时只看直接格式
+	Styles *Styles
+	// MaxFontSizes 正文允许的字号数，缺省为2
+	MaxFontSizes int
+}
+
+// LintFinding 一条检查结果
+type LintFinding struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+	// Paths 相关节点的路径，按文档顺序排列
+	Paths []string `json:"paths"`
+}
+
+func (f LintFinding) String() string {
+	return f.Rule + ": " + f.Message
+}
+
+// lintRun 段落中的一个run
+type lintRun struct {
+	node *Node
+	path string
+	text string
+}
+
+// lintParagraph 段落及其中的run，body表示不在表格、文本框和脚注中
+type lintParagraph struct {
+	node *Node
+	path string
+	text string
+	runs []lintRun
+	body bool
+}
+
+// lintContainers 其中的段落不算正文
+var lintContainers = map[string]bool{
+	"tbl": true, "txbxContent": true, "footnote": true, "endnote": true, "comment": true,
+}
+
+// Lint 检查子树的格式一致性，返回的结果按规则分组
+func (slim *DocTrim) Lint(root *Node, opts LintOptions) []LintFinding {
+	if opts.MaxFontSizes <= 0 {
+		opts.MaxFontSizes = defaultMaxFontSizes
+	}
+	l := &linter{slim: slim, opts: opts}
+	l.collect(root, "/"+qualifiedName(root), nil, true)
+
+	findings := l.propertyVariants(root)
+	dominant, sizes := l.fontSizes()
+	findings = append(findings, sizes...)
+	findings = append(findings, l.mixedFonts()...)
+	findings = append(findings, l.directHeadings(dominant)...)
+	return findings
+}
+
+// LintFile 打开docx并检查主文档，opts.Styles为nil时使用文档的样式表
+func (s DocTrim) LintFile(url string, opts LintOptions) ([]LintFinding, error) {
+	pkg, err := s.OpenPackage(url)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := pkg.Part(documentPart)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Styles == nil {
+		if opts.Styles, err = pkg.Styles(); err != nil {
+			return nil, err
+		}
+	}
+	return s.Lint(doc, opts), nil
+}
+
+type linter struct {
+	slim       *DocTrim
+	opts       LintOptions
+	paragraphs []*lintParagraph
+}
+
+// collect 按文档顺序收集段落和run
+func (l *linter) collect(node *Node, path string, p *lintParagraph, body bool) {
+	if node.XMLName.Space == nsWord {
+		switch {
+		case lintContainers[node.XMLName.Local]:
+			body = false
+		case node.XMLName.Local == "p":
+			p = &lintParagraph{node: node, path: path, body: body}
+			l.paragraphs = append(l.paragraphs, p)
+		case node.XMLName.Local == "r" && p != nil:
+			var b strings.Builder
+			for _, c := range node.Children {
+				if c.XMLName.Local == "t" {
+					b.Write(c.Content)
+				}
+			}
+			p.runs = append(p.runs, lintRun{node: node, path: path, text: b.String()})
+			p.text += b.String()
+			return
+		}
+	}
+	for i, childPath := range childPaths(node, path) {
+		l.collect(node.Children[i], childPath, p, body)
+	}
+}
+
+// propertyVariants 按hashDict区分不同的w:rPr，去掉w:hint和w:szCs后相同的归为一组
+func (l *linter) propertyVariants(root *Node) []LintFinding {
+	l.slim.Reset()
+	root.ComputeHash(l.slim)
+
+	type variants struct {
+		order []uint64
+		paths map[uint64]string
+	}
+	groups := map[uint64]*variants{}
+	order := []uint64{}
+	for _, p := range l.paragraphs {
+		for _, r := range p.runs {
+			rPr := r.node.child("rPr")
+			if rPr == nil {
+				continue
+			}
+			key := normalizedRPr(rPr).Digest()
+			g, ok := groups[key]
+			if !ok {
+				g = &variants{paths: map[uint64]string{}}
+				groups[key] = g
+				order = append(order, key)
+			}
+			// 内容相同的w:rPr在hashDict中登记为同一个序号
+			if _, ok := g.paths[rPr.hash]; !ok {
+				g.order = append(g.order, rPr.hash)
+				g.paths[rPr.hash] = r.path + "/w:rPr[1]"
+			}
+		}
+	}
+
+	findings := []LintFinding{}
+	for _, key := range order {
+		g := groups[key]
+		if len(g.order) < 2 {
+			continue
+		}
+		f := LintFinding{Rule: LintPropertyVariants, Message: fmt.Sprintf("%d run property variants differ only in w:hint or w:szCs", len(g.order))}
+		for _, seq := range g.order {
+			f.Paths = append(f.Paths, g.paths[seq])
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// normalizedRPr 返回去掉w:hint和w:szCs的w:rPr副本，只有w:hint的w:rFonts整个去掉
+func normalizedRPr(rPr *Node) *Node {
+	c := rPr.clone()
+	children := c.Children[:0]
+	for _, child := range c.Children {
+		if child.XMLName.Local == "szCs" {
+			continue
+		}
+		if child.XMLName.Local == "rFonts" {
+			attrs := child.Attrs[:0]
+			for _, a := range child.Attrs {
+				if a.Name.Local != "hint" {
+					attrs = append(attrs, a)
+				}
+			}
+			child.Attrs = attrs
+			if len(attrs) == 0 {
+				continue
+			}
+		}
+		children = append(children, child)
+	}
+	c.Children = children
+	return c
+}
+
+// runProps 返回run的有效属性，没有样式表时返回直接格式
+func (l *linter) runProps(p *lintParagraph, r lintRun) *Node {
+	if l.opts.Styles != nil {
+		return l.opts.Styles.RunProps(p.node, r.node)
+	}
+	return r.node.child("rPr")
+}
+
+// fontSize 返回属性中的字号，单位为半磅，未设置时返回空串
+func fontSize(rPr *Node) string {
+	if rPr == nil {
+		return ""
+	}
+	if sz := rPr.child("sz"); sz != nil {
+		v, _ := sz.attr("val")
+		return v
+	}
+	return ""
+}
+
+// sizeLabel 将半磅字号显示为磅
+func sizeLabel(sz string) string {
+	if sz == "" {
+		return "default size"
+	}
+	n, err := strconv.Atoi(sz)
+	if err != nil {
+		return sz
+	}
+	return strconv.FormatFloat(float64(n)/2, 'f', -1, 64) + "pt"
+}
+
+// fontSizes 统计正文各字号的字符数，字号超过MaxFontSizes时为主字号之外的每个字号报告一条
+// 返回字符数最多的字号
+func (l *linter) fontSizes() (string, []LintFinding) {
+	chars := map[string]int{}
+	paths := map[string][]string{}
+	order := []string{}
+	for _, p := range l.paragraphs {
+		// 直接加粗的标题不算正文
+		if !p.body || headingLevel(p.node, l.opts.Styles) >= 0 || l.headingLike(p, 0) {
+			continue
+		}
+		for _, r := range p.runs {
+			if strings.TrimSpace(r.text) == "" {
+				continue
+			}
+			sz := fontSize(l.runProps(p, r))
+			if _, ok := chars[sz]; !ok {
+				order = append(order, sz)
+			}
+			chars[sz] += utf8.RuneCountInString(r.text)
+			paths[sz] = append(paths[sz], r.path)
+		}
+	}
+	if len(order) == 0 {
+		return "", nil
+	}
+	sort.SliceStable(order, func(i, j int) bool { return chars[order[i]] > chars[order[j]] })
+	dominant := order[0]
+	if len(order) <= l.opts.MaxFontSizes {
+		return dominant, nil
+	}
+
+	findings := []LintFinding{}
+	for _, sz := range order[1:] {
+		findings = append(findings, LintFinding{
+			Rule: LintFontSizes,
+			Message: fmt.Sprintf("body text uses %d font sizes; %s in %d runs, most text is %s",
+				len(order), sizeLabel(sz), len(paths[sz]), sizeLabel(dominant)),
+			Paths: paths[sz],
+		})
+	}
+	return dominant, findings
+}
+
+// eastAsianFonts 名字不含CJK字符的常见东亚字体
+var eastAsianFonts = map[string]bool{
+	"simsun": true, "nsimsun": true, "simhei": true, "kaiti": true, "fangsong": true,
+	"microsoft yahei": true, "dengxian": true, "mingliu": true, "pmingliu": true,
+	"ms mincho": true, "ms gothic": true, "yu mincho": true, "yu gothic": true,
+	"malgun gothic": true, "batang": true, "gulim": true,
+}
+
+// isEastAsianFont 判断字体是否为东亚字体
+func isEastAsianFont(name string) bool {
+	if eastAsianFonts[strings.ToLower(name)] {
+		return true
+	}
+	for _, r := range name {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			return true
+		}
+	}
+	return false
+}
+
+// mixedFonts 检查直接设置的w:rFonts：西文字体用了东亚字体、东亚字体用了西文字体、w:ascii与w:hAnsi不一致
+// 相同的问题合并为一条
+func (l *linter) mixedFonts() []LintFinding {
+	findings := []LintFinding{}
+	index := map[string]int{}
+	add := func(message, path string) {
+		i, ok := index[message]
+		if !ok {
+			i = len(findings)
+			index[message] = i
+			findings = append(findings, LintFinding{Rule: LintMixedFonts, Message: message})
+		}
+		findings[i].Paths = append(findings[i].Paths, path)
+	}
+	for _, p := range l.paragraphs {
+		for _, r := range p.runs {
+			rPr := r.node.child("rPr")
+			if rPr == nil || rPr.child("rFonts") == nil {
+				continue
+			}
+			fonts := rPr.child("rFonts")
+			path := r.path + "/w:rPr[1]/w:rFonts[1]"
+			ascii, hasAscii := fonts.attr("ascii")
+			hAnsi, hasHAnsi := fonts.attr("hAnsi")
+			if hasAscii && isEastAsianFont(ascii) {
+				add(fmt.Sprintf("w:ascii=%q is an East Asian font used for Latin text", ascii), path)
+			}
+			if hasHAnsi && isEastAsianFont(hAnsi) && hAnsi != ascii {
+				add(fmt.Sprintf("w:hAnsi=%q is an East Asian font used for Latin text", hAnsi), path)
+			}
+			if ea, ok := fonts.attr("eastAsia"); ok && !isEastAsianFont(ea) {
+				add(fmt.Sprintf("w:eastAsia=%q is a Latin font used for East Asian text", ea), path)
+			}
+			if hasAscii && hasHAnsi && ascii != hAnsi {
+				add(fmt.Sprintf("w:ascii=%q and w:hAnsi=%q differ", ascii, hAnsi), path)
+			}
+		}
+	}
+	return findings
+}
+
+// sentenceEnds 以这些字符结尾的段落是句子而不是标题
+const sentenceEnds = "。．.！!？?；;：:，,"
+
+// directHeadings 查找没有使用标题样式、但每个run都直接加粗或放大的短段落
+func (l *linter) directHeadings(dominant string) []LintFinding {
+	findings := []LintFinding{}
+	body, _ := strconv.Atoi(dominant)
+	for _, p := range l.paragraphs {
+		if l.headingLike(p, body) {
+			findings = append(findings, LintFinding{
+				Rule:    LintDirectHeading,
+				Message: fmt.Sprintf("%q looks like a heading but uses direct formatting instead of a heading style", strings.TrimSpace(p.text)),
+				Paths:   []string{p.path},
+			})
+		}
+	}
+	return findings
+}
+
+// headingLike 判断正文中的短段落是否不用标题样式、而是每个run都直接加粗或字号大于body
+// body为0时只看加粗
+func (l *linter) headingLike(p *lintParagraph, body int) bool {
+	text := strings.TrimSpace(p.text)
+	if !p.body || text == "" || utf8.RuneCountInString(text) > lintHeadingLength || headingLevel(p.node, l.opts.Styles) >= 0 {
+		return false
+	}
+	if last, _ := utf8.DecodeLastRuneInString(text); strings.ContainsRune(sentenceEnds, last) {
+		return false
+	}
+	for _, r := range p.runs {
+		if strings.TrimSpace(r.text) == "" {
+			continue
+		}
+		rPr := r.node.child("rPr")
+		if rPr == nil {
+			return false
+		}
+		bold := rPr.child("b") != nil && propOn(rPr.child("b"))
+		sz, err := strconv.Atoi(fontSize(rPr))
+		if !bold && (err != nil || body == 0 || sz <= body) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package DocTrim
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+func TestLint(t *testing.T) {
+	run := func(rPr, text string) string {
+		return `<w:r><w:rPr>` + rPr + `</w:rPr><w:t>` + text + `</w:t></w:r>`
+	}
+	para := func(runs ...string) string {
+		return `<w:p>` + strings.Join(runs, "") + `</w:p>`
+	}
+	body := `<w:sz w:val="21"/>`
+	src := `<w:document xmlns:w="` + nsWord + `"><w:body>` +
+		para(run(`<w:b/><w:sz w:val="32"/>`, "第一章 总则")) +
+		para(run(`<w:rFonts w:hint="eastAsia"/>`+body, "正文的第一段。"), run(body, "接着是第二句。")) +
+		para(run(`<w:rFonts w:ascii="宋体" w:hAnsi="宋体" w:eastAsia="宋体"/>`+body, "Latin text in 宋体。")) +
+		para(run(`<w:rFonts w:ascii="Arial" w:hAnsi="Times New Roman" w:eastAsia="Arial"/>`+body, "混合字体设置。")) +
+		para(run(`<w:sz w:val="24"/>`, "字号稍大的一段文字。")) +
+		para(run(`<w:sz w:val="18"/><w:szCs w:val="18"/>`, "字号稍小的一段文字。")) +
+		para(run(`<w:sz w:val="18"/>`, "另一段小字号文字。")) +
+		`<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr>` + run(`<w:b/>`, "使用样式的标题") + `</w:p>` +
+		`<w:sectPr/></w:body></w:document>`
+	var root Node
+	if err := xml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatal(err)
+	}
+
+	findings := (&DocTrim{}).Lint(&root, LintOptions{})
+	byRule := map[string][]LintFinding{}
+	for _, f := range findings {
+		byRule[f.Rule] = append(byRule[f.Rule], f)
+	}
+
+	variants := byRule[LintPropertyVariants]
+	if len(variants) != 2 {
+		t.Fatalf("got %d property variant findings: %v", len(variants), variants)
+	}
+	if got := strings.Join(variants[0].Paths, " "); got != "/w:document/w:body[1]/w:p[2]/w:r[1]/w:rPr[1] /w:document/w:body[1]/w:p[2]/w:r[2]/w:rPr[1]" {
+		t.Errorf("got paths %s", got)
+	}
+
+	// 正文有10.5、12、9磅三种字号，按字符数从多到少报告两个少数字号，加粗的标题不计入
+	sizes := byRule[LintFontSizes]
+	if len(sizes) != 2 || !strings.Contains(sizes[0].Message, "9pt in 2 runs, most text is 10.5pt") || len(sizes[0].Paths) != 2 {
+		t.Errorf("got font size findings %v", sizes)
+	}
+
+	fonts := []string{}
+	for _, f := range byRule[LintMixedFonts] {
+		fonts = append(fonts, f.Message)
+	}
+	want := []string{
+		`w:ascii="宋体" is an East Asian font used for Latin text`,
+		`w:eastAsia="Arial" is a Latin font used for East Asian text`,
+		`w:ascii="Arial" and w:hAnsi="Times New Roman" differ`,
+	}
+	if strings.Join(fonts, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got mixed font findings:\n%s", strings.Join(fonts, "\n"))
+	}
+
+	headings := byRule[LintDirectHeading]
+	if len(headings) != 1 || headings[0].Paths[0] != "/w:document/w:body[1]/w:p[1]" {
+		t.Errorf("got heading findings %v", headings)
+	}
+}
+
+func TestLintFile(t *testing.T) {
+	findings, err := DocTrim{}.LintFile("docs/test.docx", LintOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range findings {
+		if len(f.Paths) == 0 {
+			t.Errorf("%s: no paths", f)
+		}
+	}
+}
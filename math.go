@@ -0,0 +1,483 @@
+// 将Office Math (OMML)公式转换为LaTeX
+// 支持分式、上下标、根式、n元运算符、定界符、矩阵、重音和函数
+// Pack时可将m:oMath子树替换为携带LaTeX的紧凑元素，Unpack时还原或由LaTeX重新生成
+
+package DocTrim
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nbio/xml"
+)
+
+const (
+	nsMath = "http://schemas.openxmlformats.org/officeDocument/2006/math"
+	nsWord = "http://schemas.openxmlformats.org/wordprocessingml/2006/main"
+	nsXML  = "http://www.w3.org/XML/1998/namespace"
+
+	texTag  = "_tex"
+	mathTag = "_m"
+)
+
+// mathSource 记录被替换公式的原始子树及其LaTeX
+type mathSource struct {
+	tex  string
+	node *Node
+}
+
+// naryLatex n元运算符字符到LaTeX命令的映射，m:chr缺省为积分号
+var naryLatex = map[string]string{
+	"∑": `\sum`,
+	"∏": `\prod`,
+	"∐": `\coprod`,
+	"∫": `\int`,
+	"∬": `\iint`,
+	"∭": `\iiint`,
+	"∮": `\oint`,
+	"⋃": `\bigcup`,
+	"⋂": `\bigcap`,
+	"⋁": `\bigvee`,
+	"⋀": `\bigwedge`,
+}
+
+// accentLatex 重音组合字符到LaTeX命令的映射，m:chr缺省为U+0302
+var accentLatex = map[string]string{
+	"̂": `\hat`,
+	"̃": `\tilde`,
+	"̇": `\dot`,
+	"̈": `\ddot`,
+	"̄": `\bar`,
+	"̅": `\bar`,
+	"⃗": `\vec`,
+	"́": `\acute`,
+	"̀": `\grave`,
+	"̆": `\breve`,
+	"̌": `\check`,
+}
+
+// delimLatex 定界符到LaTeX的映射，空字符串表示不显示
+var delimLatex = map[string]string{
+	"":  ".",
+	"{": `\{`,
+	"}": `\}`,
+	"⟨": `\langle`,
+	"⟩": `\rangle`,
+	"〈": `\langle`,
+	"〉": `\rangle`,
+	"‖": `\|`,
+	"⌊": `\lfloor`,
+	"⌋": `\rfloor`,
+	"⌈": `\lceil`,
+	"⌉": `\rceil`,
+}
+
+// symbolLatex 公式文本中的符号到LaTeX命令的映射
+var symbolLatex = map[rune]string{
+	'α': `\alpha`, 'β': `\beta`, 'γ': `\gamma`, 'δ': `\delta`, 'ε': `\varepsilon`,
+	'ζ': `\zeta`, 'η': `\eta`, 'θ': `\theta`, 'ι': `\iota`, 'κ': `\kappa`,
+	'λ': `\lambda`, 'μ': `\mu`, 'ν': `\nu`, 'ξ': `\xi`, 'π': `\pi`,
+	'ρ': `\rho`, 'σ': `\sigma`, 'τ': `\tau`, 'υ': `\upsilon`, 'φ': `\varphi`,
+	'χ': `\chi`, 'ψ': `\psi`, 'ω': `\omega`, 'ϕ': `\phi`, 'ϵ': `\epsilon`,
+	'Γ': `\Gamma`, 'Δ': `\Delta`, 'Θ': `\Theta`, 'Λ': `\Lambda`, 'Ξ': `\Xi`,
+	'Π': `\Pi`, 'Σ': `\Sigma`, 'Φ': `\Phi`, 'Ψ': `\Psi`, 'Ω': `\Omega`,
+	'±': `\pm`, '∓': `\mp`, '×': `\times`, '÷': `\div`, '·': `\cdot`, '⋅': `\cdot`,
+	'≤': `\leq`, '≥': `\geq`, '≠': `\neq`, '≈': `\approx`, '≡': `\equiv`,
+	'∼': `\sim`, '≅': `\cong`, '∝': `\propto`, '∞': `\infty`, '∂': `\partial`,
+	'∇': `\nabla`, '∈': `\in`, '∉': `\notin`, '⊂': `\subset`, '⊆': `\subseteq`,
+	'⊃': `\supset`, '⊇': `\supseteq`, '∪': `\cup`, '∩': `\cap`, '∅': `\emptyset`,
+	'∀': `\forall`, '∃': `\exists`, '¬': `\neg`, '∧': `\wedge`, '∨': `\vee`,
+	'→': `\rightarrow`, '←': `\leftarrow`, '↔': `\leftrightarrow`, '⇒': `\Rightarrow`,
+	'⇐': `\Leftarrow`, '⇔': `\Leftrightarrow`, '∠': `\angle`, '⊥': `\perp`,
+	'∥': `\parallel`, '△': `\triangle`, '∽': `\backsim`, '°': `\circ`, '…': `\ldots`,
+	'⋯': `\cdots`, '′': `'`, '−': `-`,
+	'#': `\#`, '$': `\$`, '%': `\%`, '&': `\&`, '_': `\_`, '{': `\{`, '}': `\}`,
+	'\\': `\backslash`,
+}
+
+// textLatex \text中需要转义的字符，文本模式下反斜杠等没有数学模式的写法
+var textLatex = map[rune]string{
+	'#': `\#`, '$': `\$`, '%': `\%`, '&': `\&`, '_': `\_`, '{': `\{`, '}': `\}`,
+	'\\': `\textbackslash{}`, '^': `\textasciicircum{}`, '~': `\textasciitilde{}`,
+}
+
+// mathFuncs 可直接写成LaTeX命令的函数名
+var mathFuncs = map[string]bool{
+	"sin": true, "cos": true, "tan": true, "cot": true, "sec": true, "csc": true,
+	"arcsin": true, "arccos": true, "arctan": true, "sinh": true, "cosh": true,
+	"tanh": true, "coth": true, "log": true, "ln": true, "lg": true, "exp": true,
+	"lim": true, "max": true, "min": true, "sup": true, "inf": true, "det": true,
+	"gcd": true, "deg": true, "dim": true, "ker": true, "arg": true,
+}
+
+var (
+	latexCommandTail = regexp.MustCompile(`\\[a-zA-Z]+$`)
+	latexCommand     = regexp.MustCompile(`^\\[a-zA-Z]+$`)
+	latexRightDelim  = regexp.MustCompile(`\\right(\\[a-zA-Z]+|\\?.)$`)
+)
+
+// joinLatex 拼接LaTeX片段，命令后紧跟字母时插入空格
+func joinLatex(parts ...string) string {
+	var b strings.Builder
+	for _, p := range parts {
+		if p == "" {
+			continue
+		}
+		first, _ := utf8.DecodeRuneInString(p)
+		if latexCommandTail.MatchString(b.String()) && isASCIILetter(first) {
+			b.WriteByte(' ')
+		}
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+func isASCIILetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+// isLatexAtom 判断LaTeX片段作为上下标的底数时是否无需加括号
+func isLatexAtom(s string) bool {
+	if len([]rune(s)) == 1 {
+		return true
+	}
+	if latexCommand.MatchString(s) {
+		return true
+	}
+	return strings.HasPrefix(s, `\left`) && strings.Count(s, `\left`) == 1 &&
+		latexRightDelim.MatchString(s)
+}
+
+// onOff 判断OMML开关属性是否打开，元素存在且m:val缺省时视为打开
+func onOff(pr *Node, local string) bool {
+	if pr == nil {
+		return false
+	}
+	c := pr.child(local)
+	if c == nil {
+		return false
+	}
+	val, ok := c.attr("val")
+	return !ok || val == "1" || val == "on" || val == "true"
+}
+
+// propVal 返回属性节点pr中子元素local的m:val，不存在时返回def
+func propVal(pr *Node, local string, def string) string {
+	if pr == nil {
+		return def
+	}
+	if c := pr.child(local); c != nil {
+		if val, ok := c.attr("val"); ok {
+			return val
+		}
+	}
+	return def
+}
+
+// OMMLToLatex 将m:oMath或m:oMathPara子树转换为LaTeX
+// m:oMathPara中的多个公式以\\分隔
+func OMMLToLatex(node *Node) (string, error) {
+	if node == nil {
+		return "", errors.New("math node is nil")
+	}
+	switch node.XMLName.Local {
+	case "oMathPara":
+		rows := []string{}
+		for _, child := range node.Children {
+			if child.XMLName.Local == "oMath" {
+				rows = append(rows, mathSeq(child))
+			}
+		}
+		return strings.Join(rows, ` \\ `), nil
+	case "oMath":
+		return mathSeq(node), nil
+	}
+	return "", fmt.Errorf("not a math node: %s", node.XMLName.Local)
+}
+
+// mathSeq 依次转换子元素并拼接
+func mathSeq(node *Node) string {
+	if node == nil {
+		return ""
+	}
+	parts := []string{}
+	for _, child := range node.Children {
+		parts = append(parts, mathElem(child))
+	}
+	return joinLatex(parts...)
+}
+
+// mathArg 转换名为local的参数元素，如m:num、m:sup
+func mathArg(node *Node, local string) string {
+	return mathSeq(node.child(local))
+}
+
+// mathBase 转换作为底数的m:e，必要时加括号
+func mathBase(node *Node) string {
+	e := mathArg(node, "e")
+	if isLatexAtom(e) {
+		return e
+	}
+	return "{" + e + "}"
+}
+
+// mathElem 转换单个OMML元素
+func mathElem(node *Node) string {
+	local := node.XMLName.Local
+	if node.XMLName.Space == nsWord {
+		if local == "r" {
+			return `\text{` + latexTextMode(runText(node)) + `}`
+		}
+		return ""
+	}
+	if strings.HasSuffix(local, "Pr") {
+		return ""
+	}
+
+	switch local {
+	case "r":
+		return mathRun(node)
+	case "f":
+		num, den := mathArg(node, "num"), mathArg(node, "den")
+		if propVal(node.child("fPr"), "type", "bar") == "noBar" {
+			return `\genfrac{}{}{0pt}{}{` + num + `}{` + den + `}`
+		}
+		return `\frac{` + num + `}{` + den + `}`
+	case "sSup":
+		return mathBase(node) + "^{" + mathArg(node, "sup") + "}"
+	case "sSub":
+		return mathBase(node) + "_{" + mathArg(node, "sub") + "}"
+	case "sSubSup":
+		return mathBase(node) + "_{" + mathArg(node, "sub") + "}^{" + mathArg(node, "sup") + "}"
+	case "sPre":
+		return "{}_{" + mathArg(node, "sub") + "}^{" + mathArg(node, "sup") + "}" + mathBase(node)
+	case "rad":
+		deg := mathArg(node, "deg")
+		if deg == "" || onOff(node.child("radPr"), "degHide") {
+			return `\sqrt{` + mathArg(node, "e") + `}`
+		}
+		return `\sqrt[` + deg + `]{` + mathArg(node, "e") + `}`
+	case "nary":
+		return mathNary(node)
+	case "d":
+		return mathDelim(node)
+	case "m":
+		rows := []string{}
+		for _, mr := range node.Children {
+			if mr.XMLName.Local != "mr" {
+				continue
+			}
+			cells := []string{}
+			for _, e := range mr.Children {
+				if e.XMLName.Local == "e" {
+					cells = append(cells, mathSeq(e))
+				}
+			}
+			rows = append(rows, strings.Join(cells, "&"))
+		}
+		return `\begin{matrix}` + strings.Join(rows, `\\`) + `\end{matrix}`
+	case "eqArr":
+		rows := []string{}
+		for _, e := range node.Children {
+			if e.XMLName.Local == "e" {
+				rows = append(rows, mathSeq(e))
+			}
+		}
+		return `\begin{aligned}` + strings.Join(rows, `\\`) + `\end{aligned}`
+	case "acc":
+		chr := propVal(node.child("accPr"), "chr", "̂")
+		cmd, ok := accentLatex[chr]
+		if !ok {
+			return `\overset{` + latexText(chr) + `}{` + mathArg(node, "e") + `}`
+		}
+		return cmd + "{" + mathArg(node, "e") + "}"
+	case "bar":
+		if propVal(node.child("barPr"), "pos", "bot") == "top" {
+			return `\overline{` + mathArg(node, "e") + `}`
+		}
+		return `\underline{` + mathArg(node, "e") + `}`
+	case "groupChr":
+		if propVal(node.child("groupChrPr"), "pos", "bot") == "top" {
+			return `\overbrace{` + mathArg(node, "e") + `}`
+		}
+		return `\underbrace{` + mathArg(node, "e") + `}`
+	case "borderBox":
+		return `\boxed{` + mathArg(node, "e") + `}`
+	case "func":
+		return joinLatex(mathArg(node, "fName"), "{"+mathArg(node, "e")+"}")
+	case "limLow", "limUpp":
+		e, lim := mathArg(node, "e"), mathArg(node, "lim")
+		if local == "limUpp" {
+			return `\overset{` + lim + `}{` + e + `}`
+		}
+		if name := strings.TrimPrefix(e, `\`); name != e && mathFuncs[name] {
+			return e + "_{" + lim + "}"
+		}
+		return `\underset{` + lim + `}{` + e + `}`
+	case "oMath":
+		return mathSeq(node)
+	}
+
+	// m:box、m:e等容器直接转换子元素
+	return mathSeq(node)
+}
+
+// mathNary 转换n元运算符
+func mathNary(node *Node) string {
+	pr := node.child("naryPr")
+	chr := propVal(pr, "chr", "∫")
+	cmd, ok := naryLatex[chr]
+	if !ok {
+		cmd = latexText(chr)
+	}
+	if sub := mathArg(node, "sub"); sub != "" && !onOff(pr, "subHide") {
+		cmd += "_{" + sub + "}"
+	}
+	if sup := mathArg(node, "sup"); sup != "" && !onOff(pr, "supHide") {
+		cmd += "^{" + sup + "}"
+	}
+	return cmd + "{" + mathArg(node, "e") + "}"
+}
+
+// mathDelim 转换定界符，多个m:e之间以\middle分隔符连接
+func mathDelim(node *Node) string {
+	pr := node.child("dPr")
+	beg := delimiter(propVal(pr, "begChr", "("))
+	end := delimiter(propVal(pr, "endChr", ")"))
+	sep := `\middle` + delimiter(propVal(pr, "sepChr", "|"))
+
+	items := []string{}
+	for _, e := range node.Children {
+		if e.XMLName.Local == "e" {
+			items = append(items, mathSeq(e))
+		}
+	}
+	return joinLatex(`\left`+beg, strings.Join(items, sep), `\right`+end)
+}
+
+func delimiter(chr string) string {
+	if d, ok := delimLatex[chr]; ok {
+		return d
+	}
+	return chr
+}
+
+// mathRun 转换m:r，正体的多字母文本使用\mathrm，已知函数名使用命令
+func mathRun(node *Node) string {
+	text := runText(node)
+	if text == "" {
+		return ""
+	}
+	if mathFuncs[text] {
+		return `\` + text
+	}
+
+	rPr := node.child("rPr")
+	upright := onOff(rPr, "nor") || propVal(rPr, "sty", "") == "p"
+	if upright && strings.IndexFunc(text, unicode.IsLetter) >= 0 &&
+		strings.IndexFunc(text, func(r rune) bool { return !unicode.IsLetter(r) }) < 0 {
+		return `\mathrm{` + latexText(text) + `}`
+	}
+	return latexText(text)
+}
+
+// runText 拼接m:r或w:r中m:t、w:t的文本
+func runText(node *Node) string {
+	var b strings.Builder
+	for _, child := range node.Children {
+		if child.XMLName.Local == "t" {
+			b.Write(child.Content)
+		}
+	}
+	return b.String()
+}
+
+// latexText 转义文本中的LaTeX特殊字符并替换符号
+func latexText(text string) string {
+	parts := []string{}
+	for _, r := range text {
+		if cmd, ok := symbolLatex[r]; ok {
+			parts = append(parts, cmd)
+		} else if !unicode.IsSpace(r) {
+			parts = append(parts, string(r))
+		}
+	}
+	return joinLatex(parts...)
+}
+
+// latexTextMode 转义\text中的LaTeX特殊字符，空格原样保留
+func latexTextMode(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if esc, ok := textLatex[r]; ok {
+			b.WriteString(esc)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// packMath 将子树中的m:oMath替换为携带LaTeX的紧凑元素
+// 原始子树保存在mathDict中，Unpack时据此还原
+func (slim *DocTrim) packMath(node *Node) error {
+	node.digest = 0
+	for _, child := range node.Children {
+		if child.XMLName.Space != nsMath || child.XMLName.Local != "oMath" {
+			if err := slim.packMath(child); err != nil {
+				return err
+			}
+			continue
+		}
+
+		tex, err := OMMLToLatex(child)
+		if err != nil {
+			return err
+		}
+		orig := *child
+		seq := uint64(len(slim.mathDict) + 1)
+		slim.mathDict[seq] = mathSource{tex: tex, node: &orig}
+
+		child.Attrs = []xml.Attr{
+			{Name: xml.Name{Local: texTag}, Value: tex},
+			{Name: xml.Name{Local: mathTag}, Value: strconv.FormatUint(seq, 16)},
+		}
+		child.Content = []byte{}
+		child.Children = []*Node{}
+	}
+	return nil
+}
+
+// unpackMath 还原packMath生成的紧凑公式元素
+func unpackMath(node *Node, dict map[uint64]mathSource) error {
+	node.digest = 0
+	for _, child := range node.Children {
+		tex, ok := child.attr(texTag)
+		if !ok {
+			if err := unpackMath(child, dict); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// 原始公式可用且LaTeX未被修改时还原原始子树，否则由LaTeX重新生成
+		seqStr, _ := child.attr(mathTag)
+		seq, _ := strconv.ParseUint(seqStr, 16, 64)
+		if src, ok := dict[seq]; ok && src.tex == tex {
+			*child = *src.node
+			continue
+		}
+		omml, err := LatexToOMML(tex)
+		if err != nil {
+			return err
+		}
+		omml.XMLName = child.XMLName
+		*child = *omml
+	}
+	return nil
+}
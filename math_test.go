@@ -0,0 +1,131 @@
+package DocTrim
+
+import (
+	"bytes"
+	"log"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+// findMath 收集子树中的m:oMath节点
+func findMath(node *Node, found []*Node) []*Node {
+	for _, child := range node.Children {
+		if child.XMLName.Local == "oMath" {
+			found = append(found, child)
+			continue
+		}
+		found = findMath(child, found)
+	}
+	return found
+}
+
+func TestOMMLToLatex(t *testing.T) {
+	var root Node
+	if err := xml.Unmarshal([]byte(testXml), &root); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		`x^{2}+4x+1=0`,
+		`\left(x+2\right)^{2}=3`,
+		`\left(x-2\right)^{2}=3`,
+		`\left(x+2\right)^{2}=5`,
+		`\left(x+4\right)^{2}=5`,
+	}
+	maths := findMath(&root, nil)
+	if len(maths) != len(want) {
+		t.Fatalf("found %d formulas, want %d", len(maths), len(want))
+	}
+	for i, m := range maths {
+		tex, err := OMMLToLatex(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tex != want[i] {
+			t.Errorf("got %q, want %q", tex, want[i])
+		}
+	}
+}
+
+func TestOMMLTextEscapes(t *testing.T) {
+	// 公式中的普通文本含有LaTeX特殊字符，转换后必须能原样解析回来
+	text := `50% a_b} {#1 \ ^ ~ & $x`
+	var tw Node
+	if err := xml.Unmarshal([]byte(`<w:t xmlns:w="`+nsWord+`" xml:space="preserve"></w:t>`), &tw); err != nil {
+		t.Fatal(err)
+	}
+	tw.Content = []byte(text)
+	math := newMathNode("oMath", newWordNode("r", &tw))
+	tex, err := OMMLToLatex(math)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tex != `\text{50\% a\_b\} \{\#1 \textbackslash{} \textasciicircum{} \textasciitilde{} \& \$x}` {
+		t.Errorf("got %s", tex)
+	}
+	node, err := LatexToOMML(tex)
+	if err != nil {
+		t.Fatalf("%s: %v", tex, err)
+	}
+	if len(node.Children) != 1 || runText(node.Children[0]) != text {
+		t.Errorf("%s parsed as %+v", tex, node.Children)
+	}
+	if again, _ := OMMLToLatex(node); again != tex {
+		t.Errorf("round trip %q -> %q", tex, again)
+	}
+}
+
+func TestOMMLToLatexStructures(t *testing.T) {
+	cases := []struct {
+		omml string
+		want string
+	}{
+		{`<m:f><m:num><m:r><m:t>a</m:t></m:r></m:num><m:den><m:r><m:t>b</m:t></m:r></m:den></m:f>`, `\frac{a}{b}`},
+		{`<m:rad><m:radPr><m:degHide m:val="1"/></m:radPr><m:deg/><m:e><m:r><m:t>2</m:t></m:r></m:e></m:rad>`, `\sqrt{2}`},
+		{`<m:rad><m:deg><m:r><m:t>3</m:t></m:r></m:deg><m:e><m:r><m:t>x</m:t></m:r></m:e></m:rad>`, `\sqrt[3]{x}`},
+		{`<m:nary><m:naryPr><m:chr m:val="∑"/></m:naryPr><m:sub><m:r><m:t>i=1</m:t></m:r></m:sub><m:sup><m:r><m:t>n</m:t></m:r></m:sup><m:e><m:r><m:t>i</m:t></m:r></m:e></m:nary>`, `\sum_{i=1}^{n}{i}`},
+		{`<m:sSub><m:e><m:r><m:t>a</m:t></m:r></m:e><m:sub><m:r><m:t>n</m:t></m:r></m:sub></m:sSub>`, `a_{n}`},
+		{`<m:d><m:dPr><m:begChr m:val="{"/><m:endChr m:val=""/></m:dPr><m:e><m:r><m:t>x</m:t></m:r></m:e></m:d>`, `\left\{x\right.`},
+		{`<m:m><m:mr><m:e><m:r><m:t>1</m:t></m:r></m:e><m:e><m:r><m:t>0</m:t></m:r></m:e></m:mr><m:mr><m:e><m:r><m:t>0</m:t></m:r></m:e><m:e><m:r><m:t>1</m:t></m:r></m:e></m:mr></m:m>`, `\begin{matrix}1&0\\0&1\end{matrix}`},
+		{`<m:acc><m:accPr><m:chr m:val="⃗"/></m:accPr><m:e><m:r><m:t>a</m:t></m:r></m:e></m:acc>`, `\vec{a}`},
+		{`<m:func><m:fName><m:r><m:rPr><m:sty m:val="p"/></m:rPr><m:t>sin</m:t></m:r></m:fName><m:e><m:r><m:t>α</m:t></m:r></m:e></m:func>`, `\sin{\alpha}`},
+		{`<m:r><m:t>α≤β</m:t></m:r>`, `\alpha\leq\beta`},
+		{`<m:r><m:rPr><m:sty m:val="p"/></m:rPr><m:t>cm</m:t></m:r>`, `\mathrm{cm}`},
+	}
+
+	for _, c := range cases {
+		src := `<m:oMath xmlns:m="` + nsMath + `">` + c.omml + `</m:oMath>`
+		var node Node
+		if err := xml.Unmarshal([]byte(src), &node); err != nil {
+			t.Fatal(err)
+		}
+		tex, err := OMMLToLatex(&node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tex != c.want {
+			t.Errorf("got %q, want %q", tex, c.want)
+		}
+	}
+}
+
+func TestPackMath(t *testing.T) {
+	s := DocTrim{MathToLatex: true}
+	data, err := s.Pack(bytes.NewReader([]byte(testXml)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Printf("%d -> %d", len(testXml), len(data))
+	if !bytes.Contains(data, []byte(`_tex="x^{2}+4x+1=0"`)) {
+		t.Fatalf("latex not found in %s", data)
+	}
+
+	to, err := s.Unpack(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !EqualXml([]byte(testXml), to) {
+		t.Fatal("Not equals")
+	}
+}
@@ -0,0 +1,145 @@
+// 内容哈希
+// ComputeHash的序号依赖遍历顺序，每次都要重建字典；Digest按内容计算子树哈希(Merkle树)并缓存在节点上，
+// 相同内容在任何文档、任何位置得到相同的值。修改节点后用Invalidate清除从根到该节点路径上的缓存，
+// 再次调用Digest时只重新计算这条路径，其余子树沿用缓存。包内修改节点树的操作返回前都会清除受影响的缓存
+// Changed比较两个版本，返回内容不同的最小子树
+
+package DocTrim
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/fnv"
+	"io"
+	"strconv"
+)
+
+// Digest 返回子树的内容哈希，结果缓存在节点上
+// 直接修改节点后需要调用根节点的Invalidate，否则返回旧的缓存
+func (node *Node) Digest() uint64 {
+	if node.digest != 0 {
+		return node.digest
+	}
+	h := fnv.New64a()
+	writeField(h, node.XMLName.Space)
+	writeField(h, node.XMLName.Local)
+	binary.Write(h, binary.LittleEndian, uint32(len(node.Attrs)))
+	for _, a := range node.Attrs {
+		writeField(h, a.Name.Space)
+		writeField(h, a.Name.Local)
+		writeField(h, a.Value)
+	}
+	writeField(h, string(node.Content))
+	binary.Write(h, binary.LittleEndian, uint32(len(node.Children)))
+	for _, child := range node.Children {
+		binary.Write(h, binary.LittleEndian, child.Digest())
+	}
+
+	node.digest = h.Sum64()
+	// 0表示没有缓存
+	if node.digest == 0 {
+		node.digest = 1
+	}
+	return node.digest
+}
+
+// writeField 写入带长度前缀的字段，避免相邻字段拼接产生歧义
+func writeField(w io.Writer, s string) {
+	binary.Write(w, binary.LittleEndian, uint32(len(s)))
+	io.WriteString(w, s)
+}
+
+// Invalidate 清除从本节点到target路径上的哈希缓存，target不在子树中时返回false
+// target为本节点时只清除本节点，修改了多处时对每个被修改的节点分别调用
+func (node *Node) Invalidate(target *Node) bool {
+	found := node == target
+	for _, child := range node.Children {
+		if !found && child.Invalidate(target) {
+			found = true
+		}
+	}
+	if found {
+		node.digest = 0
+	}
+	return found
+}
+
+// clearDigests 清除整棵子树的哈希缓存，用于修改处分散在子树各处的操作
+func (node *Node) clearDigests() {
+	node.digest = 0
+	for _, child := range node.Children {
+		child.clearDigests()
+	}
+}
+
+// SubtreeChange 两个版本之间的一处修改，Old为nil表示插入，New为nil表示删除
+type SubtreeChange struct {
+	// Path 新版本中的路径，删除时为旧版本中的路径
+	Path string
+	Old  *Node
+	New  *Node
+}
+
+// Changed 返回两个版本之间内容不同的最小子树
+// 哈希相同的子树直接跳过；元素名、属性或文本不同的节点整体报告，否则继续比较子节点
+func Changed(old, new *Node) []SubtreeChange {
+	changes := []SubtreeChange{}
+	changedSubtrees(old, new, "/"+qualifiedName(new), &changes)
+	return changes
+}
+
+func changedSubtrees(old, new *Node, path string, changes *[]SubtreeChange) {
+	if old.Digest() == new.Digest() {
+		return
+	}
+	if !sameShallow(old, new) {
+		*changes = append(*changes, SubtreeChange{Path: path, Old: old, New: new})
+		return
+	}
+
+	oldPaths, newPaths := childPaths(old, path), childPaths(new, path)
+	// 按哈希对齐子节点，两个相同子节点之间剩余的节点按顺序配对
+	gap := func(i, m, j, n int) {
+		for ; i < m && j < n && old.Children[i].XMLName == new.Children[j].XMLName; i, j = i+1, j+1 {
+			changedSubtrees(old.Children[i], new.Children[j], newPaths[j], changes)
+		}
+		for ; i < m; i++ {
+			*changes = append(*changes, SubtreeChange{Path: oldPaths[i], Old: old.Children[i]})
+		}
+		for ; j < n; j++ {
+			*changes = append(*changes, SubtreeChange{Path: newPaths[j], New: new.Children[j]})
+		}
+	}
+	i, j := 0, 0
+	for _, m := range lcs(len(old.Children), len(new.Children), func(i, j int) bool {
+		return old.Children[i].Digest() == new.Children[j].Digest()
+	}) {
+		gap(i, m[0], j, m[1])
+		i, j = m[0]+1, m[1]+1
+	}
+	gap(i, len(old.Children), j, len(new.Children))
+}
+
+// sameShallow 判断两个节点的元素名、属性和文本是否相同，不比较子节点
+func sameShallow(l, r *Node) bool {
+	if l.XMLName != r.XMLName || len(l.Attrs) != len(r.Attrs) || !bytes.Equal(l.Content, r.Content) {
+		return false
+	}
+	for i, a := range l.Attrs {
+		if a != r.Attrs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// String 返回便于阅读的修改描述
+func (c SubtreeChange) String() string {
+	switch {
+	case c.Old == nil:
+		return "+ " + c.Path
+	case c.New == nil:
+		return "- " + c.Path
+	}
+	return "~ " + c.Path + " " + strconv.FormatUint(c.Old.Digest(), 16) + " -> " + strconv.FormatUint(c.New.Digest(), 16)
+}
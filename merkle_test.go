@@ -0,0 +1,137 @@
+package DocTrim
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+func TestDigest(t *testing.T) {
+	data, _ := os.ReadFile("docs/test.xml")
+	var root Node
+	if err := xml.Unmarshal(data, &root); err != nil {
+		t.Fatal(err)
+	}
+	c := root.clone()
+	if root.Digest() != c.Digest() {
+		t.Fatal("equal trees should have equal digests")
+	}
+
+	body := c.child("body")
+	sibling := body.Children[0]
+	text := findNode(body.Children[1], "t")
+	text.Content = []byte("edited")
+	if c.Digest() != root.Digest() {
+		t.Fatal("digest should be cached until invalidated")
+	}
+	if !c.Invalidate(text) {
+		t.Fatal("target not found")
+	}
+	if sibling.digest == 0 || body.digest != 0 || c.digest != 0 {
+		t.Error("only the path to the edited node should be invalidated")
+	}
+	if c.Digest() == root.Digest() {
+		t.Error("digest should change after an edit")
+	}
+	if c.Invalidate(&Node{}) {
+		t.Error("node outside the tree should not be found")
+	}
+}
+
+func TestDigestAfterMutation(t *testing.T) {
+	src := `<w:body xmlns:w="` + nsWord + `"><w:p w:rsidR="00A1"><w:r><w:rPr><w:b/></w:rPr><w:t>电话</w:t></w:r>` +
+		`<w:r><w:rPr><w:b/></w:rPr><w:t>13812345678</w:t></w:r><w:ins w:id="1" w:author="A"><w:r><w:t>新增</w:t></w:r></w:ins>` +
+		`<w:r><w:rPr><w:vanish/><w:i w:val="0"/></w:rPr><w:t>隐藏</w:t></w:r></w:p></w:body>`
+	slim := &DocTrim{}
+	mutators := map[string]func(root *Node){
+		"StripNoise":     func(root *Node) { StripNoise(root, DefaultStripProfile) },
+		"MergeRuns":      func(root *Node) { slim.MergeRuns(root) },
+		"Replace":        func(root *Node) { Replace(root, "电话", "手机", false) },
+		"Redact":         func(root *Node) { Redact(root, []RedactRule{PhoneRule}, NewVault()) },
+		"ApplyRevisions": func(root *Node) { ApplyRevisions(root, RevisionsAccept, RevisionFilter{}) },
+		"SanitizeNode":   func(root *Node) { SanitizeNode(root, SanitizePolicy{HiddenText: true}) },
+		"OmitDefaults":   func(root *Node) { root.OmitDefaults(true) },
+	}
+	for name, mutate := range mutators {
+		var root Node
+		if err := xml.Unmarshal([]byte(src), &root); err != nil {
+			t.Fatal(err)
+		}
+		before := root.Digest()
+		mutate(&root)
+		// clone不复制缓存，重新计算的结果应与修改后的缓存一致
+		if got, want := root.Digest(), root.clone().Digest(); got != want || got == before {
+			t.Errorf("%s left a stale digest", name)
+		}
+	}
+}
+
+// findNode 返回子树中第一个本地名为local的节点
+func findNode(node *Node, local string) *Node {
+	if node.XMLName.Local == local {
+		return node
+	}
+	for _, child := range node.Children {
+		if found := findNode(child, local); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func TestChanged(t *testing.T) {
+	parse := func(src string) *Node {
+		var root Node
+		xml.Unmarshal([]byte(`<w:body xmlns:w="`+nsWord+`">`+src+`</w:body>`), &root)
+		return &root
+	}
+	old := parse(`<w:p><w:r><w:t>a</w:t></w:r><w:r><w:t>b</w:t></w:r></w:p><w:p><w:r><w:t>removed</w:t></w:r></w:p><w:p/>`)
+	new := parse(`<w:p><w:r><w:t>a</w:t></w:r><w:r><w:t>B</w:t></w:r></w:p><w:p/><w:tbl/>`)
+
+	want := []string{
+		"~ /w:body/w:p[1]/w:r[2]/w:t[1]",
+		"- /w:body/w:p[2]",
+		"+ /w:body/w:tbl[1]",
+	}
+	changes := Changed(old, new)
+	if len(changes) != len(want) {
+		t.Fatalf("got %v", changes)
+	}
+	for i, c := range changes {
+		if got := c.String(); got[:len(want[i])] != want[i] {
+			t.Errorf("change %d: got %s, want %s", i, got, want[i])
+		}
+	}
+	if string(changes[0].Old.Content) != "b" || string(changes[0].New.Content) != "B" {
+		t.Error("changed nodes mismatch")
+	}
+	if len(Changed(old, old.clone())) != 0 {
+		t.Error("equal trees should have no changes")
+	}
+}
+
+func TestPackAfterDigest(t *testing.T) {
+	src := `<w:document xmlns:w="` + nsWord + `"><w:body><w:p><w:r><w:t>aaa</w:t></w:r></w:p><w:p><w:r><w:t>aaa</w:t></w:r></w:p></w:body></w:document>`
+	var root Node
+	if err := xml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatal(err)
+	}
+	root.Digest()
+	// 直接修改字段，不调用Invalidate
+	findNode(root.child("body").Children[1], "t").Content = []byte("bbb")
+
+	slim := &DocTrim{}
+	data, err := slim.PackNode(&root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := slim.Unpack(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(to, []byte("bbb")) {
+		t.Errorf("edit lost: %s", to)
+	}
+}
@@ -0,0 +1,297 @@
+// docx包的读写
+// Package保存包中所有部件的原始内容，修改后按原顺序写出新的docx
+
+package DocTrim
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nbio/xml"
+)
+
+const xmlDeclaration = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\r\n"
+
+const (
+	nsRelationships = "http://schemas.openxmlformats.org/package/2006/relationships"
+	nsContentTypes  = "http://schemas.openxmlformats.org/package/2006/content-types"
+	contentTypes    = "[Content_Types].xml"
+)
+
+const (
+	documentPart  = "word/document.xml"
+	stylesPart    = "word/styles.xml"
+	numberingPart = "word/numbering.xml"
+)
+
+// Package docx包
+type Package struct {
+	names []string
+	parts map[string][]byte
+}
+
+// OpenPackage 根据URL打开或下载docx文件并读取所有部件
+func (s DocTrim) OpenPackage(url string) (*Package, error) {
+	if url == "" {
+		return nil, errors.New("url is empty")
+	}
+	r, err := s.MakeReader(url)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readPackage(&r.Reader)
+}
+
+// ReadPackage 从内存中的docx数据读取所有部件
+func ReadPackage(data []byte) (*Package, error) {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	return readPackage(r)
+}
+
+func readPackage(r *zip.Reader) (*Package, error) {
+	pkg := &Package{parts: map[string][]byte{}}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		pkg.names = append(pkg.names, f.Name)
+		pkg.parts[f.Name] = data
+	}
+	if _, ok := pkg.parts[documentPart]; !ok {
+		return nil, errors.New("document.xml not found")
+	}
+	return pkg, nil
+}
+
+// Names 返回包中部件的名字
+func (pkg *Package) Names() []string {
+	return append([]string{}, pkg.names...)
+}
+
+// contentPartRe 正文、页眉页脚、脚注尾注部件
+var contentPartRe = regexp.MustCompile(`^word/(document|header\d*|footer\d*|footnotes|endnotes|comments)\.xml$`)
+
+// ContentParts 返回包含正文内容的部件名，主文档排在最前
+func (pkg *Package) ContentParts() []string {
+	parts := []string{documentPart}
+	for _, name := range pkg.names {
+		if name != documentPart && contentPartRe.MatchString(name) {
+			parts = append(parts, name)
+		}
+	}
+	return parts
+}
+
+// Data 返回部件的原始内容
+func (pkg *Package) Data(name string) ([]byte, bool) {
+	data, ok := pkg.parts[name]
+	return data, ok
+}
+
+// SetData 替换部件的内容，部件不存在时添加到包的末尾
+func (pkg *Package) SetData(name string, data []byte) {
+	if _, ok := pkg.parts[name]; !ok {
+		pkg.names = append(pkg.names, name)
+	}
+	pkg.parts[name] = data
+}
+
+// Remove 从包中删除部件
+func (pkg *Package) Remove(name string) {
+	if _, ok := pkg.parts[name]; !ok {
+		return
+	}
+	delete(pkg.parts, name)
+	for i, n := range pkg.names {
+		if n == name {
+			pkg.names = append(pkg.names[:i], pkg.names[i+1:]...)
+			break
+		}
+	}
+}
+
+// Part 解析XML部件，部件不存在时返回nil
+func (pkg *Package) Part(name string) (*Node, error) {
+	data, ok := pkg.parts[name]
+	if !ok {
+		return nil, nil
+	}
+	var root Node
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+// Clone 复制包，修改副本不影响原包
+func (pkg *Package) Clone() *Package {
+	c := &Package{names: append([]string{}, pkg.names...), parts: map[string][]byte{}}
+	for name, data := range pkg.parts {
+		c.parts[name] = data
+	}
+	return c
+}
+
+// relsPart 返回部件的关系部件名，如word/_rels/document.xml.rels
+func relsPart(name string) string {
+	return path.Join(path.Dir(name), "_rels", path.Base(name)+".rels")
+}
+
+// AddRelationship 为部件添加关系，返回新关系的Id
+func (pkg *Package) AddRelationship(name, relType, target string) (string, error) {
+	rels, err := pkg.Part(relsPart(name))
+	if err != nil {
+		return "", err
+	}
+	if rels == nil {
+		rels = &Node{XMLName: xml.Name{Space: nsRelationships, Local: "Relationships"}, Attrs: []xml.Attr{}}
+	}
+	ids := map[string]bool{}
+	for _, rel := range rels.Children {
+		id, _ := rel.attr("Id")
+		ids[id] = true
+	}
+	id := ""
+	for n := len(rels.Children) + 1; id == "" || ids[id]; n++ {
+		id = "rId" + strconv.Itoa(n)
+	}
+	rel := &Node{XMLName: xml.Name{Space: nsRelationships, Local: "Relationship"}, Attrs: []xml.Attr{
+		{Name: xml.Name{Local: "Id"}, Value: id},
+		{Name: xml.Name{Local: "Type"}, Value: relType},
+		{Name: xml.Name{Local: "Target"}, Value: target},
+	}}
+	rels.Children = append(rels.Children, rel)
+	return id, pkg.SetPart(relsPart(name), rels)
+}
+
+// AddContentType 为扩展名注册内容类型，已注册时不做修改
+func (pkg *Package) AddContentType(ext, contentType string) error {
+	types, err := pkg.Part(contentTypes)
+	if err != nil || types == nil {
+		return err
+	}
+	for _, def := range types.Children {
+		if v, _ := def.attr("Extension"); def.XMLName.Local == "Default" && strings.EqualFold(v, ext) {
+			return nil
+		}
+	}
+	def := &Node{XMLName: xml.Name{Space: nsContentTypes, Local: "Default"}, Attrs: []xml.Attr{
+		{Name: xml.Name{Local: "Extension"}, Value: ext},
+		{Name: xml.Name{Local: "ContentType"}, Value: contentType},
+	}}
+	types.Children = append([]*Node{def}, types.Children...)
+	return pkg.SetPart(contentTypes, types)
+}
+
+// Styles 解析包中的样式表和编号定义，没有styles.xml时返回nil
+func (pkg *Package) Styles() (*Styles, error) {
+	root, err := pkg.Part(stylesPart)
+	if err != nil || root == nil {
+		return nil, err
+	}
+	st := newStyles(root)
+	if data, ok := pkg.parts[numberingPart]; ok {
+		if err := st.LoadNumbering(bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// SetPart 将节点写回XML部件
+func (pkg *Package) SetPart(name string, root *Node) error {
+	data, err := root.Marshal()
+	if err != nil {
+		return err
+	}
+	pkg.SetData(name, append([]byte(xmlDeclaration), data...))
+	return nil
+}
+
+// Write 按原顺序写出docx
+func (pkg *Package) Write(w io.Writer) error {
+	zw := zip.NewWriter(w)
+	for _, name := range pkg.names {
+		f, err := zw.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(pkg.parts[name]); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// Repack 按选项修改docx并写出
+func (s DocTrim) Repack(url string, w io.Writer) error {
+	pkg, err := s.OpenPackage(url)
+	if err != nil {
+		return err
+	}
+	if err := s.RepackPackage(pkg); err != nil {
+		return err
+	}
+	return pkg.Write(w)
+}
+
+// RepackPackage 按选项修改包中的部件
+func (s *DocTrim) RepackPackage(pkg *Package) error {
+	// 接受或拒绝正文、页眉页脚和脚注尾注中的修订
+	if s.Revisions != RevisionsKeep {
+		for _, name := range pkg.ContentParts() {
+			root, err := pkg.Part(name)
+			if err != nil {
+				return err
+			}
+			if root != nil && ApplyRevisions(root, s.Revisions, s.RevisionFilter) > 0 {
+				if err := pkg.SetPart(name, root); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// 清理外发前不应保留的内容和部件
+	if s.Sanitize.Enabled() {
+		if _, err := SanitizePackage(pkg, s.Sanitize); err != nil {
+			return err
+		}
+	}
+
+	doc, err := pkg.Part(documentPart)
+	if err != nil {
+		return err
+	}
+
+	// 将重复的直接格式提取为样式
+	if s.HoistStyles > 0 {
+		styles, err := pkg.Part(stylesPart)
+		if err != nil {
+			return err
+		}
+		if styles != nil && s.HoistFormatting(doc, styles, s.HoistStyles) > 0 {
+			if err := pkg.SetPart(stylesPart, styles); err != nil {
+				return err
+			}
+		}
+	}
+
+	return pkg.SetPart(documentPart, doc)
+}
@@ -0,0 +1,44 @@
+package DocTrim
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestPackageRoundTrip(t *testing.T) {
+	pkg, err := DocTrim{}.OpenPackage("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := pkg.Part(documentPart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pkg.SetPart(documentPart, doc); err != nil {
+		t.Fatal(err)
+	}
+	pkg.SetData("customXml/extra.xml", []byte("<extra/>"))
+	pkg.Remove("customXml/extra.xml")
+
+	var buf bytes.Buffer
+	if err := pkg.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	back, err := ReadPackage(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(back.Names()) != len(pkg.Names()) {
+		t.Errorf("got %d parts, want %d", len(back.Names()), len(pkg.Names()))
+	}
+
+	orig, _ := os.ReadFile("docs/test.xml")
+	data, _ := back.Data(documentPart)
+	if !EqualXml(orig, data) {
+		t.Error("document.xml changed")
+	}
+	if _, ok := back.Data("customXml/extra.xml"); ok {
+		t.Error("removed part written")
+	}
+}
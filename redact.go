@@ -0,0 +1,438 @@
+// 可还原的个人信息脱敏
+// 学生试卷交给外部模型之前，把姓名、身份证号、手机号和邮箱替换为[[NAME_1]]这样的占位符，
+// 原文记录在Vault中；Unpack时按Vault把占位符还原
+// 查找在段落的逻辑文本上进行，被拆到多个run中的姓名或号码也能命中，替换方式与Replace相同
+
+package DocTrim
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// 个人信息的类别，用于占位符和统计
+const (
+	RedactName  = "NAME"
+	RedactID    = "ID"
+	RedactPhone = "PHONE"
+	RedactEmail = "EMAIL"
+	// RedactLiteral 原文中本来就有的占位符形式的文字，如试卷中的“[[NAME_1]]”，
+	// 替换后还原时恢复原样，不会被误换成对照表中的原文
+	RedactLiteral = "LITERAL"
+)
+
+// RedactRule 一条脱敏规则
+type RedactRule struct {
+	// Kind 类别，出现在占位符中，只能是大写字母，LITERAL保留给原文中的占位符
+	Kind    string
+	Pattern *regexp.Regexp
+	// Valid 不为nil时只替换通过校验的匹配
+	Valid func(match string) bool
+}
+
+var (
+	// IDNumberRule 18位居民身份证号，校验码不符的数字串不替换
+	IDNumberRule = RedactRule{Kind: RedactID, Pattern: regexp.MustCompile(`\d{17}[\dXx]`), Valid: validIDNumber}
+	// PhoneRule 手机号，可以带+86和空格、短横线分隔，以及带区号的固定电话
+	PhoneRule = RedactRule{Kind: RedactPhone, Pattern: regexp.MustCompile(`(?:\+86[- ]?)?1[3-9]\d(?:[- ]?\d{4}){2}|0\d{2,3}-\d{7,8}`)}
+	// EmailRule 邮箱地址
+	EmailRule = RedactRule{Kind: RedactEmail, Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)}
+)
+
+// DefaultRedactRules 缺省的规则，姓名需要用NameRule提供名单
+var DefaultRedactRules = []RedactRule{IDNumberRule, PhoneRule, EmailRule}
+
+// NameRule 按名单查找姓名，较长的名字优先
+func NameRule(names []string) RedactRule {
+	quoted := []string{}
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			quoted = append(quoted, regexp.QuoteMeta(name))
+		}
+	}
+	sort.SliceStable(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	pattern := `$^`
+	if len(quoted) > 0 {
+		pattern = strings.Join(quoted, "|")
+	}
+	return RedactRule{Kind: RedactName, Pattern: regexp.MustCompile(pattern)}
+}
+
+// idWeights 身份证号前17位的加权因子
+var idWeights = [17]int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+
+// validIDNumber 按GB 11643校验身份证号的最后一位
+func validIDNumber(id string) bool {
+	sum := 0
+	for i, w := range idWeights {
+		sum += int(id[i]-'0') * w
+	}
+	return "10X98765432"[sum%11] == strings.ToUpper(id[17:])[0]
+}
+
+// errRedactVault 设置了Redact但没有Vault时原文无处记录，无法还原
+var errRedactVault = errors.New("redaction requires a Vault")
+
+// redactMatch 逻辑文本中的一处命中，start和end为字节偏移
+type redactMatch struct {
+	kind       string
+	start, end int
+}
+
+// checkRedactRules 检查规则的类别，不合规的类别生成的占位符无法识别，脱敏后不能还原
+func checkRedactRules(rules []RedactRule) error {
+	for _, rule := range rules {
+		if !redactKindRe.MatchString(rule.Kind) || rule.Kind == RedactLiteral {
+			return fmt.Errorf("invalid redaction kind %q, use uppercase letters only", rule.Kind)
+		}
+	}
+	return nil
+}
+
+// redactKindRe 占位符中类别的形式，与placeholderRe一致
+var redactKindRe = regexp.MustCompile(`^[A-Z]+$`)
+
+// Redact 将子树中的个人信息替换为占位符，原文记录在vault中，返回每个类别替换的数量
+// 同一原文在同一个vault中总是得到相同的占位符
+// 除显示的文本外，保留修订时删除的文本、域代码以及图形的替代文字等属性也会替换
+// 规则的类别不是大写字母时返回错误，不做任何替换
+func Redact(root *Node, rules []RedactRule, vault *Vault) (map[string]int, error) {
+	if err := checkRedactRules(rules); err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	walkRedactionTexts(root, func(segs []textSegment, text string) {
+		matches := findRedactions(text, rules)
+		// 按文档顺序分配占位符，再从后向前替换，前面匹配的偏移量不受影响
+		tokens := make([]string, len(matches))
+		for i, m := range matches {
+			tokens[i] = vault.token(m.kind, text[m.start:m.end])
+			counts[m.kind]++
+		}
+		for i := len(matches) - 1; i >= 0; i-- {
+			replaceSegments(segs, matches[i].start, matches[i].end, tokens[i])
+		}
+	})
+	walkRedactionAttrs(root, func(value string) string {
+		matches := findRedactions(value, rules)
+		var b strings.Builder
+		last := 0
+		for _, m := range matches {
+			b.WriteString(value[last:m.start])
+			b.WriteString(vault.token(m.kind, value[m.start:m.end]))
+			counts[m.kind]++
+			last = m.end
+		}
+		b.WriteString(value[last:])
+		return b.String()
+	})
+	root.clearDigests()
+	return counts, nil
+}
+
+// walkRedactionTexts 按段落访问需要脱敏的文本：显示的文本、保留修订时删除的文本和域代码
+// 三者各自拼接后匹配，跨越run的内容也能命中
+func walkRedactionTexts(root *Node, visit func(segs []textSegment, text string)) {
+	walkParagraphs(root, "/"+qualifiedName(root), func(p *Node, path string) {
+		visit(paragraphSegments(p, path))
+		visit(elementSegments(p, path, "delText"))
+		visit(elementSegments(p, path, "instrText"))
+	})
+}
+
+// elementSegments 返回段落中本地名为local的文本元素及其拼接的文本，文本框中的段落不计入
+func elementSegments(p *Node, path, local string) ([]textSegment, string) {
+	segs := []textSegment{}
+	var b strings.Builder
+	var walk func(node, run *Node, path string)
+	walk = func(node, run *Node, path string) {
+		paths := childPaths(node, path)
+		for i, child := range node.Children {
+			word := child.XMLName.Space == nsWord
+			switch {
+			case word && child.XMLName.Local == local && run != nil:
+				segs = append(segs, textSegment{node: child, run: run, path: paths[i], text: string(child.Content), start: b.Len()})
+				b.Write(child.Content)
+			case word && (child.XMLName.Local == "p" || child.XMLName.Local == "txbxContent"):
+			case word && child.XMLName.Local == "r":
+				walk(child, child, paths[i])
+			default:
+				walk(child, run, paths[i])
+			}
+		}
+	}
+	walk(p, nil, path)
+	return segs, b.String()
+}
+
+// redactionAttrs 可能包含个人信息的属性，按元素的本地名
+// 图形的替代文字和标题、简单域的域代码、超链接的提示和VML图形的替代文字
+var redactionAttrs = map[string][]string{
+	"docPr":     {"descr", "title"},
+	"cNvPr":     {"descr", "title"},
+	"fldSimple": {"instr"},
+	"hyperlink": {"tooltip"},
+	"shape":     {"alt"},
+}
+
+// walkRedactionAttrs 用replace的结果替换redactionAttrs中列出的属性
+func walkRedactionAttrs(node *Node, replace func(value string) string) {
+	for _, local := range redactionAttrs[node.XMLName.Local] {
+		for i, a := range node.Attrs {
+			if a.Name.Local == local && a.Value != "" {
+				node.Attrs[i].Value = replace(a.Value)
+			}
+		}
+	}
+	for _, child := range node.Children {
+		walkRedactionAttrs(child, replace)
+	}
+}
+
+// findRedactions 返回所有规则的命中，重叠时保留开始较早、较长的一个
+// 文本中已有的占位符形式的文字作为RedactLiteral一并替换
+func findRedactions(text string, rules []RedactRule) []redactMatch {
+	all := []redactMatch{}
+	for _, loc := range placeholderRe.FindAllStringIndex(text, -1) {
+		all = append(all, redactMatch{kind: RedactLiteral, start: loc[0], end: loc[1]})
+	}
+	for _, rule := range rules {
+		for _, loc := range rule.Pattern.FindAllStringIndex(text, -1) {
+			match := text[loc[0]:loc[1]]
+			if loc[0] == loc[1] || !standalone(text, loc[0], loc[1]) || rule.Valid != nil && !rule.Valid(match) {
+				continue
+			}
+			all = append(all, redactMatch{kind: rule.Kind, start: loc[0], end: loc[1]})
+		}
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		if all[i].start != all[j].start {
+			return all[i].start < all[j].start
+		}
+		return all[i].end > all[j].end
+	})
+	matches := []redactMatch{}
+	end := 0
+	for _, m := range all {
+		if m.start >= end {
+			matches = append(matches, m)
+			end = m.end
+		}
+	}
+	return matches
+}
+
+// standalone 判断[start, end)是否是完整的词：以字母或数字开头结尾时，两侧不能紧接ASCII字母或数字
+// 避免把更长号码中的一段当作手机号，或把Anna中的Ann当作姓名
+func standalone(text string, start, end int) bool {
+	first, _ := utf8.DecodeRuneInString(text[start:])
+	last, _ := utf8.DecodeLastRuneInString(text[:end])
+	before, _ := utf8.DecodeLastRuneInString(text[:start])
+	after, _ := utf8.DecodeRuneInString(text[end:])
+	return !(isASCIIAlnum(first) && isASCIIAlnum(before)) && !(isASCIIAlnum(last) && isASCIIAlnum(after))
+}
+
+func isASCIIAlnum(r rune) bool {
+	return r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z'
+}
+
+// placeholderRe 占位符的格式
+var placeholderRe = regexp.MustCompile(`\[\[([A-Z]+)_(\d+)\]\]`)
+
+// Vault 占位符与原文的对照表
+type Vault struct {
+	// entries 占位符到原文
+	entries map[string]string
+	// tokens 类别和原文到占位符
+	tokens map[string]string
+	// counts 每个类别已分配的最大序号
+	counts map[string]int
+}
+
+// NewVault 创建空的对照表
+func NewVault() *Vault {
+	return &Vault{entries: map[string]string{}, tokens: map[string]string{}, counts: map[string]int{}}
+}
+
+// Len 返回记录的原文数
+func (v *Vault) Len() int {
+	return len(v.entries)
+}
+
+// Original 返回占位符对应的原文
+func (v *Vault) Original(token string) (string, bool) {
+	s, ok := v.entries[token]
+	return s, ok
+}
+
+// token 返回原文的占位符，没有时分配新的序号
+func (v *Vault) token(kind, original string) string {
+	key := kind + "\x00" + original
+	if token, ok := v.tokens[key]; ok {
+		return token
+	}
+	v.counts[kind]++
+	token := fmt.Sprintf("[[%s_%d]]", kind, v.counts[kind])
+	v.tokens[key] = token
+	v.entries[token] = original
+	return token
+}
+
+// add 记录已有的占位符，用于读取保存的对照表
+func (v *Vault) add(token, original string) error {
+	m := placeholderRe.FindStringSubmatch(token)
+	if m == nil || m[0] != token {
+		return fmt.Errorf("vault: invalid placeholder %q", token)
+	}
+	n, _ := strconv.Atoi(m[2])
+	if n > v.counts[m[1]] {
+		v.counts[m[1]] = n
+	}
+	v.tokens[m[1]+"\x00"+original] = token
+	v.entries[token] = original
+	return nil
+}
+
+// Restore 将子树中的占位符还原为原文，占位符可以跨越run，对照表中没有的占位符保持不变
+// 还原的范围与Redact相同，返回还原的数量
+func (v *Vault) Restore(root *Node) int {
+	restored := 0
+	walkRedactionTexts(root, func(segs []textSegment, text string) {
+		locs := placeholderRe.FindAllStringIndex(text, -1)
+		for i := len(locs) - 1; i >= 0; i-- {
+			original, ok := v.entries[text[locs[i][0]:locs[i][1]]]
+			if !ok {
+				continue
+			}
+			replaceSegments(segs, locs[i][0], locs[i][1], original)
+			restored++
+		}
+	})
+	walkRedactionAttrs(root, func(value string) string {
+		return placeholderRe.ReplaceAllStringFunc(value, func(token string) string {
+			if original, ok := v.entries[token]; ok {
+				restored++
+				return original
+			}
+			return token
+		})
+	})
+	root.clearDigests()
+	return restored
+}
+
+// RestoreText 还原纯文本中的占位符，用于模型返回的文本
+func (v *Vault) RestoreText(text string) string {
+	return placeholderRe.ReplaceAllStringFunc(text, func(token string) string {
+		if original, ok := v.entries[token]; ok {
+			return original
+		}
+		return token
+	})
+}
+
+// vaultFile 对照表的JSON格式
+type vaultFile struct {
+	Entries map[string]string `json:"entries"`
+}
+
+// vaultMagic 加密对照表的文件头，其后是盐、nonce和AES-GCM密文
+const vaultMagic = "DTVAULT1"
+
+const (
+	vaultSaltSize   = 16
+	vaultIterations = 100000
+)
+
+// Save 写出对照表，passphrase为空时写出JSON，否则用由口令派生的密钥以AES-256-GCM加密
+func (v *Vault) Save(w io.Writer, passphrase string) error {
+	data, err := json.MarshalIndent(vaultFile{Entries: v.entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if passphrase == "" {
+		_, err = w.Write(data)
+		return err
+	}
+
+	salt := make([]byte, vaultSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	aead, err := vaultCipher(passphrase, salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	out := append([]byte(vaultMagic), salt...)
+	out = append(out, nonce...)
+	out = aead.Seal(out, nonce, data, []byte(vaultMagic))
+	_, err = w.Write(out)
+	return err
+}
+
+// LoadVault 读取Save写出的对照表，加密的对照表需要相同的口令
+func LoadVault(r io.Reader, passphrase string) (*Vault, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(data, []byte(vaultMagic)) {
+		if passphrase == "" {
+			return nil, errors.New("vault: encrypted vault requires a passphrase")
+		}
+		data = data[len(vaultMagic):]
+		if len(data) < vaultSaltSize {
+			return nil, errors.New("vault: truncated file")
+		}
+		aead, err := vaultCipher(passphrase, data[:vaultSaltSize])
+		if err != nil {
+			return nil, err
+		}
+		data = data[vaultSaltSize:]
+		if len(data) < aead.NonceSize() {
+			return nil, errors.New("vault: truncated file")
+		}
+		if data, err = aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(vaultMagic)); err != nil {
+			return nil, errors.New("vault: wrong passphrase or corrupted file")
+		}
+	}
+
+	var f vaultFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("vault: %w", err)
+	}
+	v := NewVault()
+	for token, original := range f.Entries {
+		if err := v.add(token, original); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// vaultCipher 由口令和盐派生AES-256-GCM
+func vaultCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(pbkdf2.Key([]byte(passphrase), salt, vaultIterations, 32, sha256.New))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,199 @@
+package DocTrim
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+const personalRuns = `<w:document xmlns:w="` + nsWord + `"><w:body>` +
+	`<w:p><w:r><w:t>姓名：</w:t></w:r><w:r w:rsidR="001"><w:t>张</w:t></w:r><w:r w:rsidR="002"><w:t>三</w:t></w:r>` +
+	`<w:r><w:t xml:space="preserve">  电话：138 1234</w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t xml:space="preserve"> 5678</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>身份证号：11010519491231002X，学号110105194912310021</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>邮箱 zhangsan@example.edu.cn，同桌张三丰，张三的老师Ann、Anna</w:t></w:r></w:p>` +
+	`</w:body></w:document>`
+
+func TestRedact(t *testing.T) {
+	var root Node
+	if err := xml.Unmarshal([]byte(personalRuns), &root); err != nil {
+		t.Fatal(err)
+	}
+	vault := NewVault()
+	rules := append([]RedactRule{NameRule([]string{"张三", "张三丰", "Ann"})}, DefaultRedactRules...)
+	counts, err := Redact(&root, rules, vault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{RedactName: 4, RedactPhone: 1, RedactID: 1, RedactEmail: 1}
+	for kind, n := range want {
+		if counts[kind] != n {
+			t.Errorf("%s: got %d, want %d", kind, counts[kind], n)
+		}
+	}
+
+	text := []string{}
+	walkParagraphs(&root, "/w:document", func(p *Node, path string) {
+		_, s := paragraphSegments(p, path)
+		text = append(text, s)
+	})
+	wantText := []string{
+		"姓名：[[NAME_1]]  电话：[[PHONE_1]]",
+		"身份证号：[[ID_1]]，学号110105194912310021",
+		"邮箱 [[EMAIL_1]]，同桌[[NAME_2]]，[[NAME_1]]的老师[[NAME_3]]、Anna",
+	}
+	if strings.Join(text, "\n") != strings.Join(wantText, "\n") {
+		t.Errorf("got:\n%s", strings.Join(text, "\n"))
+	}
+	if original, _ := vault.Original("[[PHONE_1]]"); original != "138 1234 5678" {
+		t.Errorf("got phone %q", original)
+	}
+
+	if n := vault.Restore(&root); n != 7 {
+		t.Errorf("restored %d, want 7", n)
+	}
+	_, s := paragraphSegments(root.Children[0].Children[0], "")
+	if s != "姓名：张三  电话：138 1234 5678" {
+		t.Errorf("got %q after restore", s)
+	}
+	if got := vault.RestoreText("[[NAME_2]] and [[NAME_9]]"); got != "张三丰 and [[NAME_9]]" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestRedactHiddenLocations(t *testing.T) {
+	src := `<w:document xmlns:w="` + nsWord + `" xmlns:wp="` + nsDrawing + `"><w:body>` +
+		`<w:p><w:r><w:t>张三</w:t></w:r><w:del w:id="1" w:author="A"><w:r><w:delText>李</w:delText></w:r>` +
+		`<w:r><w:delText xml:space="preserve">四 13912345678</w:delText></w:r></w:del></w:p>` +
+		`<w:p><w:r><w:fldChar w:fldCharType="begin"/></w:r><w:r><w:instrText xml:space="preserve"> HYPERLINK "mailto:zhang@</w:instrText></w:r>` +
+		`<w:r><w:instrText>example.com"</w:instrText></w:r><w:r><w:fldChar w:fldCharType="separate"/></w:r>` +
+		`<w:r><w:t>联系我</w:t></w:r><w:r><w:fldChar w:fldCharType="end"/></w:r></w:p>` +
+		`<w:p><w:fldSimple w:instr=" HYPERLINK &quot;mailto:li@example.com&quot; "><w:r><w:t>邮件</w:t></w:r></w:fldSimple></w:p>` +
+		`<w:p><w:r><w:drawing><wp:inline><wp:docPr id="1" name="Picture 1" descr="张三的证件照" title="李四"/></wp:inline></w:drawing></w:r></w:p>` +
+		`</w:body></w:document>`
+	personal := []string{"张三", "李四", "李", "13912345678", "zhang@", "li@example.com"}
+	rules := append([]RedactRule{NameRule([]string{"张三", "李四"})}, DefaultRedactRules...)
+
+	// 保留修订时删除的文本也要替换
+	s := &DocTrim{Redact: rules, Vault: NewVault()}
+	data, err := s.Pack(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pii := range personal {
+		if bytes.Contains(data, []byte(pii)) {
+			t.Errorf("%s left in %s", pii, data)
+		}
+	}
+	for _, token := range []string{"<w:delText>[[NAME_2]]</w:delText>", "mailto:[[EMAIL_1]]", `instr=" HYPERLINK &#34;mailto:[[EMAIL_2]]&#34; "`, `descr="[[NAME_1]]的证件照" title="[[NAME_2]]"`} {
+		if !bytes.Contains(data, []byte(token)) {
+			t.Errorf("%s not in %s", token, data)
+		}
+	}
+
+	to, err := s.Unpack(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pii := range []string{"13912345678", "mailto:zhang@", "li@example.com", `descr="张三的证件照"`} {
+		if !bytes.Contains(to, []byte(pii)) {
+			t.Errorf("%s not restored in %s", pii, to)
+		}
+	}
+}
+
+func TestPackRedactUnpack(t *testing.T) {
+	s := &DocTrim{Redact: []RedactRule{NameRule([]string{"张三"}), PhoneRule}}
+	if _, err := s.Pack(strings.NewReader(personalRuns)); err == nil {
+		t.Error("expected error without a vault")
+	}
+
+	s.Vault = NewVault()
+	data, err := s.Pack(strings.NewReader(personalRuns))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("张")) || bytes.Contains(data, []byte("5678")) {
+		t.Errorf("personal data left in %s", data)
+	}
+
+	to, err := s.Unpack(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(to, []byte("[[")) || !bytes.Contains(to, []byte("张三")) {
+		t.Errorf("placeholders not restored: %s", to)
+	}
+}
+
+func TestRedactExistingPlaceholders(t *testing.T) {
+	src := `<w:p xmlns:w="` + nsWord + `"><w:r><w:t>模板字段[[NAME_1]]由</w:t></w:r><w:r><w:t>张三填写</w:t></w:r></w:p>`
+	var p Node
+	if err := xml.Unmarshal([]byte(src), &p); err != nil {
+		t.Fatal(err)
+	}
+	vault := NewVault()
+	counts, err := Redact(&p, []RedactRule{NameRule([]string{"张三"})}, vault)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts[RedactLiteral] != 1 || counts[RedactName] != 1 {
+		t.Errorf("got %v", counts)
+	}
+	if _, text := paragraphSegments(&p, ""); text != "模板字段[[LITERAL_1]]由[[NAME_1]]填写" {
+		t.Errorf("got %q", text)
+	}
+	vault.Restore(&p)
+	if _, text := paragraphSegments(&p, ""); text != "模板字段[[NAME_1]]由张三填写" {
+		t.Errorf("got %q after restore", text)
+	}
+}
+
+func TestRedactInvalidKind(t *testing.T) {
+	// 类别中的下划线会使占位符无法识别，Pack应当直接失败而不是生成无法还原的文档
+	student := RedactRule{Kind: "STUDENT_ID", Pattern: regexp.MustCompile(`\d{10}`)}
+	for _, rules := range [][]RedactRule{{student}, {{Kind: RedactLiteral, Pattern: student.Pattern}}} {
+		s := &DocTrim{Redact: rules, Vault: NewVault()}
+		if _, err := s.Pack(strings.NewReader(personalRuns)); err == nil {
+			t.Errorf("%s: expected invalid kind error", rules[0].Kind)
+		}
+	}
+}
+
+func TestVaultSave(t *testing.T) {
+	vault := NewVault()
+	vault.token(RedactName, "张三")
+	vault.token(RedactName, "李四")
+	vault.token(RedactEmail, "a@b.cn")
+
+	for _, passphrase := range []string{"", "secret"} {
+		var buf bytes.Buffer
+		if err := vault.Save(&buf, passphrase); err != nil {
+			t.Fatal(err)
+		}
+		if passphrase != "" && bytes.Contains(buf.Bytes(), []byte("张三")) {
+			t.Error("encrypted vault contains plain text")
+		}
+		loaded, err := LoadVault(bytes.NewReader(buf.Bytes()), passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.Len() != 3 {
+			t.Errorf("loaded %d entries", loaded.Len())
+		}
+		// 读取后继续分配的序号不与已有的重复
+		if token := loaded.token(RedactName, "王五"); token != "[[NAME_3]]" {
+			t.Errorf("got %s", token)
+		}
+		if token := loaded.token(RedactName, "张三"); token != "[[NAME_1]]" {
+			t.Errorf("got %s", token)
+		}
+		if passphrase != "" {
+			if _, err := LoadVault(bytes.NewReader(buf.Bytes()), "wrong"); err == nil {
+				t.Error("expected error for wrong passphrase")
+			}
+		}
+	}
+}
@@ -0,0 +1,662 @@
+// 修订对比
+// 比较同一文档的两个版本，生成以w:ins、w:del和w:rPrChange、w:pPrChange标记差异的文档，
+// 在Word中可以逐条接受或拒绝，便于审阅自动改写的内容
+// 先用清理编辑噪声后的子树摘要对齐未修改的段落和表格，剩余的段落在位置相近的窗口内按文本相似度配对后逐词比较
+
+package DocTrim
+
+import (
+	"strconv"
+	"time"
+	"unicode"
+
+	"github.com/nbio/xml"
+)
+
+// RedlineOptions 生成修订时使用的作者和时间
+type RedlineOptions struct {
+	// Author 修订作者，缺省为DocTrim
+	Author string
+	// Date 修订时间，缺省为当前时间
+	Date time.Time
+}
+
+// similarParagraph 文本相似度不低于该值的段落逐词比较，否则按删除旧段落、插入新段落处理
+const similarParagraph = 0.5
+
+// pairWindow 配对相似段落时两个版本中位置偏移的上限(不含插入或删除的块数)，
+// 超出窗口的段落按删除和插入处理，避免长文档中逐对比较
+const pairWindow = 50
+
+// Redline 比较主文档的两个版本，返回以修订标记差异的新文档，old和new不会被修改
+func Redline(old, new *Node, opts RedlineOptions) *Node {
+	if opts.Author == "" {
+		opts.Author = "DocTrim"
+	}
+	if opts.Date.IsZero() {
+		opts.Date = time.Now()
+	}
+	r := &redliner{opts: opts, stripped: map[*Node]*Node{}}
+
+	out := new.clone()
+	oldBody, body := old.child("body"), out.child("body")
+	if oldBody == nil || body == nil {
+		return out
+	}
+	r.strip(oldBody)
+	r.strip(body)
+	oldBlocks, _ := bodyBlocks(oldBody)
+	blocks, sectPr := bodyBlocks(body)
+	body.Children = r.blocks(oldBlocks, blocks)
+	if sectPr != nil {
+		body.Children = append(body.Children, sectPr)
+	}
+	return out
+}
+
+// RedlinePackage 比较两个docx的主文档，返回在新版本基础上标记了修订的包
+func RedlinePackage(old, new *Package, opts RedlineOptions) (*Package, error) {
+	oldDoc, err := old.Part(documentPart)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := new.Part(documentPart)
+	if err != nil {
+		return nil, err
+	}
+	out := new.Clone()
+	return out, out.SetPart(documentPart, Redline(oldDoc, doc, opts))
+}
+
+// bodyBlocks 返回w:body中的块级元素和节属性
+func bodyBlocks(body *Node) ([]*Node, *Node) {
+	blocks := []*Node{}
+	var sectPr *Node
+	for _, c := range body.Children {
+		if c.XMLName.Local == "sectPr" {
+			sectPr = c
+			continue
+		}
+		blocks = append(blocks, c)
+	}
+	return blocks, sectPr
+}
+
+type redliner struct {
+	opts   RedlineOptions
+	nextID int
+	// stripped 两个版本中的节点到清理编辑噪声后副本中对应节点的映射
+	stripped map[*Node]*Node
+}
+
+// strip 为子树生成清理编辑噪声后的副本，输出仍使用原节点，比较时使用副本
+func (r *redliner) strip(root *Node) {
+	c := root.clone()
+	var link func(node, c *Node)
+	link = func(node, c *Node) {
+		r.stripped[node] = c
+		for i, child := range node.Children {
+			link(child, c.Children[i])
+		}
+	}
+	link(root, c)
+	StripNoise(c, DefaultStripProfile)
+}
+
+// key 返回清理编辑噪声后的子树摘要，两个版本中相同的子树得到相同的值，nil返回0
+func (r *redliner) key(node *Node) uint64 {
+	if node == nil {
+		return 0
+	}
+	if c, ok := r.stripped[node]; ok {
+		return c.Digest()
+	}
+	return node.Digest()
+}
+
+// blocks 对齐两个版本的块级元素，相同的元素直接保留
+func (r *redliner) blocks(old, new []*Node) []*Node {
+	oldKeys, newKeys := make([]uint64, len(old)), make([]uint64, len(new))
+	for i, b := range old {
+		oldKeys[i] = r.key(b)
+	}
+	for j, b := range new {
+		newKeys[j] = r.key(b)
+	}
+
+	out := []*Node{}
+	i, j := 0, 0
+	for _, m := range lcs(len(old), len(new), func(i, j int) bool { return oldKeys[i] == newKeys[j] }) {
+		out = append(out, r.gap(old[i:m[0]], new[j:m[1]])...)
+		out = append(out, new[m[1]])
+		i, j = m[0]+1, m[1]+1
+	}
+	return append(out, r.gap(old[i:], new[j:])...)
+}
+
+// gap 处理两个相同块之间的差异，相似的段落、内容控件和结构相同的表格配对后逐个比较
+func (r *redliner) gap(old, new []*Node) []*Node {
+	oldWords, newWords := make([][]string, len(old)), make([][]string, len(new))
+	for i, b := range old {
+		oldWords[i] = blockWords(b)
+	}
+	for j, b := range new {
+		newWords[j] = blockWords(b)
+	}
+	oldBags, newBags := make([]map[string]int, len(old)), make([]map[string]int, len(new))
+	for i, words := range oldWords {
+		oldBags[i] = wordBag(words)
+	}
+	for j, words := range newWords {
+		newBags[j] = wordBag(words)
+	}
+	// 只在对角线附近配对，窗口两侧按插入或删除的块数放宽
+	lo, hi := min(0, len(new)-len(old))-pairWindow, max(0, len(new)-len(old))+pairWindow
+	// lcs对同一对下标会多次调用similar，结果缓存起来
+	scores := map[[2]int]bool{}
+	similar := func(i, j int) bool {
+		if d := j - i; d < lo || d > hi {
+			return false
+		}
+		if s, ok := scores[[2]int{i, j}]; ok {
+			return s
+		}
+		s := comparable(old[i], new[j]) &&
+			similarityBound(oldWords[i], newWords[j], oldBags[i], newBags[j]) >= similarParagraph &&
+			similarity(oldWords[i], newWords[j]) >= similarParagraph
+		scores[[2]int{i, j}] = s
+		return s
+	}
+
+	out := []*Node{}
+	unmatched := func(old, new []*Node) {
+		for _, b := range old {
+			b = b.clone()
+			markDeleted(b)
+			out = append(out, r.track(b, false))
+		}
+		for _, b := range new {
+			out = append(out, r.track(b, true))
+		}
+	}
+	i, j := 0, 0
+	for _, m := range lcs(len(old), len(new), similar) {
+		unmatched(old[i:m[0]], new[j:m[1]])
+		out = append(out, r.pair(old[m[0]], new[m[1]]))
+		i, j = m[0]+1, m[1]+1
+	}
+	unmatched(old[i:], new[j:])
+	return out
+}
+
+// comparable 判断两个块能否逐个比较：同为段落或内容控件，或行列数相同的表格
+func comparable(old, new *Node) bool {
+	if old.XMLName != new.XMLName || old.XMLName.Space != nsWord {
+		return false
+	}
+	switch old.XMLName.Local {
+	case "p", "sdt":
+		return true
+	case "tbl":
+		oldRows, newRows := tableCells(old), tableCells(new)
+		if len(oldRows) != len(newRows) {
+			return false
+		}
+		for i := range oldRows {
+			if len(oldRows[i]) != len(newRows[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// tableCells 返回表格每一行的单元格
+func tableCells(tbl *Node) [][]*Node {
+	rows := [][]*Node{}
+	for _, tr := range tbl.Children {
+		if tr.XMLName.Local != "tr" {
+			continue
+		}
+		cells := []*Node{}
+		for _, tc := range tr.Children {
+			if tc.XMLName.Local == "tc" {
+				cells = append(cells, tc)
+			}
+		}
+		rows = append(rows, cells)
+	}
+	return rows
+}
+
+// pair 比较配对的两个块，返回标记了修订的新块
+func (r *redliner) pair(old, new *Node) *Node {
+	switch new.XMLName.Local {
+	case "p":
+		return r.paragraph(old, new)
+	case "sdt":
+		if oldContent, content := old.child("sdtContent"), new.child("sdtContent"); oldContent != nil && content != nil {
+			content.Children = r.blocks(oldContent.Children, content.Children)
+		}
+	case "tbl":
+		oldRows := tableCells(old)
+		for i, cells := range tableCells(new) {
+			for k, tc := range cells {
+				r.cell(oldRows[i][k], tc)
+			}
+		}
+	}
+	return new
+}
+
+// cell 比较单元格中的块，单元格属性保持在最前
+func (r *redliner) cell(old, new *Node) {
+	split := func(tc *Node) (*Node, []*Node) {
+		if len(tc.Children) > 0 && tc.Children[0].XMLName.Local == "tcPr" {
+			return tc.Children[0], tc.Children[1:]
+		}
+		return nil, tc.Children
+	}
+	_, oldBlocks := split(old)
+	tcPr, blocks := split(new)
+	new.Children = r.blocks(oldBlocks, blocks)
+	if tcPr != nil {
+		new.Children = append([]*Node{tcPr}, new.Children...)
+	}
+}
+
+// blockWords 返回块中所有段落文本的分词结果
+func blockWords(node *Node) []string {
+	words := []string{}
+	walkParagraphs(node, "", func(p *Node, path string) {
+		_, text := paragraphSegments(p, path)
+		words = append(append(words, splitWords(text)...), "\n")
+	})
+	return words
+}
+
+// wordBag 统计每个词出现的次数
+func wordBag(words []string) map[string]int {
+	bag := make(map[string]int, len(words))
+	for _, w := range words {
+		bag[w]++
+	}
+	return bag
+}
+
+// similarityBound 返回similarity的上界，不计算公共子序列
+// 公共子序列不长于较短的序列，也不多于两边相同的词数
+func similarityBound(l, r []string, lBag, rBag map[string]int) float64 {
+	total := float64(len(l) + len(r))
+	if 2*float64(min(len(l), len(r))) < similarParagraph*total {
+		return 2 * float64(min(len(l), len(r))) / total
+	}
+	if len(lBag) > len(rBag) {
+		lBag, rBag = rBag, lBag
+	}
+	common := 0
+	for w, n := range lBag {
+		common += min(n, rBag[w])
+	}
+	return 2 * float64(common) / total
+}
+
+// similarity 返回两个词序列的相似度，即公共子序列占总长度的比例
+func similarity(l, r []string) float64 {
+	common := len(lcs(len(l), len(r), func(i, j int) bool { return l[i] == r[j] }))
+	return 2 * float64(common) / float64(len(l)+len(r))
+}
+
+// splitWords 将文本切分为单词、空白和标点，每个汉字单独成词
+func splitWords(text string) []string {
+	words := []string{}
+	start := -1
+	kind := 0
+	for i, c := range text {
+		k := 1
+		switch {
+		case unicode.IsSpace(c):
+			k = 2
+		case unicode.Is(unicode.Han, c) || !(unicode.IsLetter(c) || unicode.IsDigit(c)):
+			k = 3
+		}
+		if start >= 0 && (k != kind || k == 3) {
+			words = append(words, text[start:i])
+			start = -1
+		}
+		if start < 0 {
+			start, kind = i, k
+		}
+	}
+	if start >= 0 {
+		words = append(words, text[start:])
+	}
+	return words
+}
+
+// lcs 返回最长公共子序列中匹配的下标对，先去掉相同的前缀和后缀
+func lcs(n, m int, eq func(i, j int) bool) [][2]int {
+	prefix := 0
+	for prefix < n && prefix < m && eq(prefix, prefix) {
+		prefix++
+	}
+	suffix := 0
+	for suffix < n-prefix && suffix < m-prefix && eq(n-1-suffix, m-1-suffix) {
+		suffix++
+	}
+
+	pairs := [][2]int{}
+	for k := 0; k < prefix; k++ {
+		pairs = append(pairs, [2]int{k, k})
+	}
+	a, b := n-prefix-suffix, m-prefix-suffix
+	dp := make([][]int, a+1)
+	for i := range dp {
+		dp[i] = make([]int, b+1)
+	}
+	for i := a - 1; i >= 0; i-- {
+		for j := b - 1; j >= 0; j-- {
+			switch {
+			case eq(prefix+i, prefix+j):
+				dp[i][j] = dp[i+1][j+1] + 1
+			case dp[i+1][j] >= dp[i][j+1]:
+				dp[i][j] = dp[i+1][j]
+			default:
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+	for i, j := 0, 0; i < a && j < b; {
+		switch {
+		case eq(prefix+i, prefix+j) && dp[i][j] == dp[i+1][j+1]+1:
+			pairs = append(pairs, [2]int{prefix + i, prefix + j})
+			i++
+			j++
+		case dp[i+1][j] >= dp[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	for k := suffix; k > 0; k-- {
+		pairs = append(pairs, [2]int{n - k, m - k})
+	}
+	return pairs
+}
+
+// revision 创建带有编号、作者和时间的修订元素
+func (r *redliner) revision(local string) *Node {
+	r.nextID++
+	node := newWordNode(local)
+	node.Attrs = append(node.Attrs,
+		xml.Attr{Name: xml.Name{Space: nsWord, Local: "id"}, Value: strconv.Itoa(r.nextID)},
+		xml.Attr{Name: xml.Name{Space: nsWord, Local: "author"}, Value: r.opts.Author},
+		xml.Attr{Name: xml.Name{Space: nsWord, Local: "date"}, Value: r.opts.Date.UTC().Format("2006-01-02T15:04:05Z")},
+	)
+	return node
+}
+
+// track 将整个块标记为插入或删除：run放入w:ins或w:del，段落标记和表格行同样标记
+// 删除的内容需要先用markDeleted转换文本
+func (r *redliner) track(node *Node, inserted bool) *Node {
+	local := "del"
+	if inserted {
+		local = "ins"
+	}
+
+	var wrapper *Node
+	children := make([]*Node, 0, len(node.Children))
+	for _, c := range node.Children {
+		if c.XMLName.Local != "r" || c.XMLName.Space != nsWord {
+			wrapper = nil
+			children = append(children, r.track(c, inserted))
+			continue
+		}
+		if wrapper == nil {
+			wrapper = r.revision(local)
+			children = append(children, wrapper)
+		}
+		wrapper.Children = append(wrapper.Children, c)
+	}
+	node.Children = children
+
+	switch node.XMLName.Local {
+	case "p":
+		rPr := paragraphMarkProps(node)
+		rPr.Children = append([]*Node{r.revision(local)}, rPr.Children...)
+	case "tr":
+		trPr := node.child("trPr")
+		if trPr == nil {
+			trPr = newWordNode("trPr")
+			node.Children = insertProps(node.Children, trPr, "tblPrEx")
+		}
+		trPr.Children = append(trPr.Children, r.revision(local))
+	}
+	return node
+}
+
+// markDeleted 将w:t、w:instrText转换为删除的文本，是restoreDeleted的逆操作
+func markDeleted(node *Node) {
+	switch node.XMLName.Local {
+	case "t":
+		node.XMLName.Local = "delText"
+	case "instrText":
+		node.XMLName.Local = "delInstrText"
+	}
+	for _, child := range node.Children {
+		markDeleted(child)
+	}
+}
+
+// paragraphMarkProps 返回段落标记的w:rPr，不存在时创建
+func paragraphMarkProps(p *Node) *Node {
+	pPr := p.child("pPr")
+	if pPr == nil {
+		pPr = newWordNode("pPr")
+		p.Children = append([]*Node{pPr}, p.Children...)
+	}
+	rPr := pPr.child("rPr")
+	if rPr == nil {
+		rPr = newWordNode("rPr")
+		// w:rPr位于w:sectPr和w:pPrChange之前
+		i := len(pPr.Children)
+		for i > 0 && (pPr.Children[i-1].XMLName.Local == "sectPr" || pPr.Children[i-1].XMLName.Local == "pPrChange") {
+			i--
+		}
+		pPr.Children = append(pPr.Children[:i], append([]*Node{rPr}, pPr.Children[i:]...)...)
+	}
+	return rPr
+}
+
+// insertProps 将属性节点插入到children的开头，after中的元素保持在其之前
+func insertProps(children []*Node, props *Node, after string) []*Node {
+	i := 0
+	for i < len(children) && children[i].XMLName.Local == after {
+		i++
+	}
+	return append(children[:i], append([]*Node{props}, children[i:]...)...)
+}
+
+// redlineToken 段落中参与逐词比较的单元：一个词，或run中的制表符、图片等元素，或段落中的其他元素
+type redlineToken struct {
+	key  string
+	text string
+	node *Node
+	rPr  *Node
+	run  bool
+}
+
+// tokens 将段落内容切分为比较单元
+func (r *redliner) tokens(p *Node) []redlineToken {
+	tokens := []redlineToken{}
+	for _, c := range p.Children {
+		switch {
+		case c.XMLName.Local == "pPr":
+		case c.XMLName.Local != "r" || c.XMLName.Space != nsWord:
+			tokens = append(tokens, redlineToken{key: r.nodeKey(c), node: c})
+		default:
+			rPr := c.child("rPr")
+			for _, rc := range c.Children {
+				switch rc.XMLName.Local {
+				case "rPr":
+				case "t":
+					for _, w := range splitWords(string(rc.Content)) {
+						tokens = append(tokens, redlineToken{key: w, text: w, rPr: rPr, run: true})
+					}
+				default:
+					tokens = append(tokens, redlineToken{key: r.nodeKey(rc), node: rc, rPr: rPr, run: true})
+				}
+			}
+		}
+	}
+	return tokens
+}
+
+// nodeKey 元素的比较键，以\x00开头与文本区分
+func (r *redliner) nodeKey(node *Node) string {
+	return "\x00" + strconv.FormatUint(r.key(node), 16)
+}
+
+// paragraph 逐词比较两个版本的段落，返回标记了修订的新段落
+func (r *redliner) paragraph(old, new *Node) *Node {
+	p := &Node{XMLName: new.XMLName, Attrs: new.Attrs, Content: new.Content}
+	if pPr := r.paragraphProps(old.child("pPr"), new.child("pPr")); pPr != nil {
+		p.Children = append(p.Children, pPr)
+	}
+
+	oldTokens, newTokens := r.tokens(old), r.tokens(new)
+	b := &redlineBuilder{r: r, p: p}
+	i, j := 0, 0
+	for _, m := range lcs(len(oldTokens), len(newTokens), func(i, j int) bool { return oldTokens[i].key == newTokens[j].key }) {
+		b.changes(oldTokens[i:m[0]], newTokens[j:m[1]])
+		b.add("", newTokens[m[1]], oldTokens[m[0]].rPr)
+		i, j = m[0]+1, m[1]+1
+	}
+	b.changes(oldTokens[i:], newTokens[j:])
+	return p
+}
+
+// paragraphProps 段落属性不同时在新属性中记录w:pPrChange，段落标记的格式和节属性不参与比较
+func (r *redliner) paragraphProps(old, new *Node) *Node {
+	props := func(pPr *Node) *Node {
+		c := newWordNode("pPr")
+		if pPr != nil {
+			for _, child := range pPr.Children {
+				if !preservedProps[child.XMLName.Local] {
+					c.Children = append(c.Children, child.clone())
+				}
+			}
+		}
+		return c
+	}
+	oldProps := props(old)
+	if props(r.stripped[old]).Digest() == props(r.stripped[new]).Digest() {
+		return new
+	}
+	pPr := newWordNode("pPr")
+	if new != nil {
+		pPr = new.clone()
+	}
+	change := r.revision("pPrChange")
+	change.Children = append(change.Children, oldProps)
+	pPr.Children = append(pPr.Children, change)
+	return pPr
+}
+
+// redlineBuilder 将比较结果写入段落，连续的同类修改合并到同一个w:ins、w:del和run中
+type redlineBuilder struct {
+	r       *redliner
+	p       *Node
+	wrapper *Node
+	kind    string
+	run     *Node
+	runKey  [2]uint64
+}
+
+// changes 写入一段删除和插入
+func (b *redlineBuilder) changes(old, new []redlineToken) {
+	for _, t := range old {
+		b.add("del", t, nil)
+	}
+	for _, t := range new {
+		b.add("ins", t, nil)
+	}
+}
+
+// add 写入一个比较单元，kind为空表示未修改，此时oldRPr为旧版本的格式
+func (b *redlineBuilder) add(kind string, t redlineToken, oldRPr *Node) {
+	if kind != b.kind {
+		b.wrapper, b.kind = nil, kind
+		if kind != "" && t.run {
+			b.wrapper = b.r.revision(kind)
+			b.p.Children = append(b.p.Children, b.wrapper)
+		}
+	}
+	if !t.run {
+		// 超链接等元素内部的run单独标记，元素本身不放入w:ins、w:del
+		b.run, b.wrapper, b.kind = nil, nil, ""
+		node := t.node.clone()
+		if kind == "del" {
+			markDeleted(node)
+		}
+		if kind != "" {
+			node = b.r.track(node, kind == "ins")
+		}
+		b.p.Children = append(b.p.Children, node)
+		return
+	}
+	parent := b.p
+	if b.wrapper != nil {
+		parent = b.wrapper
+	}
+
+	runKey := [2]uint64{b.r.key(t.rPr), 0}
+	formatChanged := kind == "" && b.r.key(oldRPr) != runKey[0]
+	if formatChanged {
+		runKey[1] = b.r.key(oldRPr) + 1
+	}
+	if b.run == nil || len(parent.Children) == 0 || parent.Children[len(parent.Children)-1] != b.run || b.runKey != runKey {
+		b.run = newWordNode("r")
+		b.runKey = runKey
+		if t.rPr != nil || formatChanged {
+			rPr := newWordNode("rPr")
+			if t.rPr != nil {
+				rPr = t.rPr.clone()
+			}
+			if formatChanged {
+				change := b.r.revision("rPrChange")
+				old := newWordNode("rPr")
+				if oldRPr != nil {
+					old.Children = oldRPr.clone().Children
+				}
+				change.Children = append(change.Children, old)
+				rPr.Children = append(rPr.Children, change)
+			}
+			b.run.Children = append(b.run.Children, rPr)
+		}
+		parent.Children = append(parent.Children, b.run)
+	}
+
+	if t.node != nil {
+		node := t.node.clone()
+		if kind == "del" {
+			markDeleted(node)
+		}
+		b.run.Children = append(b.run.Children, node)
+		return
+	}
+	local := "t"
+	if kind == "del" {
+		local = "delText"
+	}
+	var last *Node
+	if n := len(b.run.Children); n > 0 {
+		last = b.run.Children[n-1]
+	}
+	if last == nil || last.XMLName.Local != local {
+		last = newWordNode(local)
+		b.run.Children = append(b.run.Children, last)
+	}
+	setText(last, string(last.Content)+t.text)
+}
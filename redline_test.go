@@ -0,0 +1,157 @@
+package DocTrim
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbio/xml"
+)
+
+func redlineDocument(body string) *Node {
+	var root Node
+	xml.Unmarshal([]byte(`<w:document xmlns:w="`+nsWord+`"><w:body>`+body+`<w:sectPr/></w:body></w:document>`), &root)
+	return &root
+}
+
+func TestRedline(t *testing.T) {
+	old := redlineDocument(
+		`<w:p w:rsidR="01"><w:r><w:t>Unchanged heading</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t xml:space="preserve">The buyer pays </w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>100 USD</w:t></w:r><w:r><w:t xml:space="preserve"> within 30 days.</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>This clause is removed entirely.</w:t></w:r></w:p>` +
+			`<w:p><w:pPr><w:jc w:val="left"/></w:pPr><w:r><w:t>Signature</w:t></w:r></w:p>`)
+	new := redlineDocument(
+		`<w:p w:rsidR="02"><w:r><w:t>Unchanged heading</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t xml:space="preserve">The buyer pays </w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>200 USD</w:t></w:r><w:r><w:t xml:space="preserve"> within 30 days.</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>A brand new paragraph.</w:t></w:r></w:p>` +
+			`<w:tbl><w:tr><w:tc><w:p><w:r><w:t>cell</w:t></w:r></w:p></w:tc></w:tr></w:tbl>` +
+			`<w:p><w:pPr><w:jc w:val="center"/></w:pPr><w:r><w:rPr><w:i/></w:rPr><w:t>Signature</w:t></w:r></w:p>`)
+	oldText, newText := ExtractText(old, nil).Text, ExtractText(new, nil).Text
+
+	date := time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)
+	red := Redline(old, new, RedlineOptions{Author: "Reviewer", Date: date})
+	data, _ := red.Marshal()
+	for _, want := range []string{
+		`<w:p w:rsidR="02"><w:r><w:t>Unchanged heading</w:t></w:r></w:p>`,
+		`<w:del w:id="1" w:author="Reviewer" w:date="2024-05-01T08:00:00Z"><w:r><w:rPr><w:b></w:b></w:rPr><w:delText>100</w:delText></w:r></w:del>`,
+		`<w:ins w:id="2" w:author="Reviewer" w:date="2024-05-01T08:00:00Z"><w:r><w:rPr><w:b></w:b></w:rPr><w:t>200</w:t></w:r></w:ins>`,
+		`<w:rPr><w:i></w:i><w:rPrChange`,
+		`<w:pPrChange`,
+		`<w:trPr><w:ins`,
+	} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("missing %s in %s", want, data)
+		}
+	}
+	if !bytes.HasSuffix(data, []byte(`<w:sectPr></w:sectPr></w:body></w:document>`)) {
+		t.Error("sectPr should stay at the end of body")
+	}
+	if got := ExtractText(new, nil).Text; got != newText {
+		t.Error("new document was modified")
+	}
+
+	// 接受全部修订得到新版本，拒绝全部修订得到旧版本
+	accepted := red.clone()
+	ApplyRevisions(accepted, RevisionsAccept, RevisionFilter{})
+	if got := ExtractText(accepted, nil).Text; got != newText {
+		t.Errorf("accepted %q, want %q", got, newText)
+	}
+	rejected := red.clone()
+	ApplyRevisions(rejected, RevisionsReject, RevisionFilter{})
+	if got := ExtractText(rejected, nil).Text; got != oldText {
+		t.Errorf("rejected %q, want %q", got, oldText)
+	}
+	data, _ = rejected.Marshal()
+	if !bytes.Contains(data, []byte(`<w:jc w:val="left"></w:jc>`)) || bytes.Contains(data, []byte(`<w:i>`)) {
+		t.Errorf("formatting not restored: %s", data)
+	}
+}
+
+func TestRedlineNoise(t *testing.T) {
+	// 只有rsid、校对标记和空书签不同的段落和run视为未修改，输出保留新版本的原样内容
+	old := redlineDocument(`<w:p><w:r w:rsidR="01"><w:rPr><w:b/><w:noProof/></w:rPr><w:t>Same</w:t></w:r><w:proofErr w:type="spellStart"/>` +
+		`<w:r><w:t xml:space="preserve"> words</w:t></w:r></w:p><w:p><w:r><w:t>Old text</w:t></w:r></w:p>`)
+	new := redlineDocument(`<w:p><w:bookmarkStart w:id="0" w:name="_GoBack"/><w:bookmarkEnd w:id="0"/>` +
+		`<w:r w:rsidR="02"><w:rPr><w:b/></w:rPr><w:t>Same</w:t></w:r><w:r><w:t xml:space="preserve"> words</w:t></w:r></w:p>` +
+		`<w:p><w:r w:rsidRPr="03"><w:t>New text</w:t></w:r></w:p>`)
+	data, _ := Redline(old, new, RedlineOptions{}).Marshal()
+	if !bytes.Contains(data, []byte(`<w:p><w:bookmarkStart w:id="0" w:name="_GoBack"></w:bookmarkStart><w:bookmarkEnd w:id="0"></w:bookmarkEnd><w:r w:rsidR="02">`)) {
+		t.Errorf("unchanged paragraph not kept as is: %s", data)
+	}
+	if n := bytes.Count(data, []byte("<w:ins ")) + bytes.Count(data, []byte("<w:del ")); n != 2 || bytes.Contains(data, []byte("rPrChange")) {
+		t.Errorf("expected only the changed word to be marked: %s", data)
+	}
+}
+
+func TestSplitWords(t *testing.T) {
+	got := strings.Join(splitWords("Pay 100 USD, 合同生效."), "|")
+	if got != "Pay| |100| |USD|,| |合|同|生|效|." {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestRedlinePackage(t *testing.T) {
+	pkg, err := DocTrim{}.OpenPackage("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	edited := pkg.Clone()
+	if _, err := ReplacePackage(edited, "的", "之", false); err != nil {
+		t.Fatal(err)
+	}
+	out, err := RedlinePackage(pkg, edited, RedlineOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		mode RevisionMode
+		pkg  *Package
+	}{{RevisionsAccept, edited}, {RevisionsReject, pkg}} {
+		doc, _ := out.Part(documentPart)
+		want, _ := c.pkg.Part(documentPart)
+		ApplyRevisions(doc, c.mode, RevisionFilter{})
+		if ExtractText(doc, nil).Text != ExtractText(want, nil).Text {
+			t.Errorf("mode %d: text differs from the original version", c.mode)
+		}
+	}
+}
+
+// largeRedlineDocuments 生成paragraphs个段落的两个版本：新版本每个段落都改了一个词，
+// 开头插入一段、末尾删除一段，所有段落落在同一个差异区间中
+func largeRedlineDocuments(paragraphs int) (*Node, *Node) {
+	var old, new strings.Builder
+	new.WriteString(`<w:p><w:r><w:t>inserted</w:t></w:r></w:p>`)
+	for i := 0; i < paragraphs; i++ {
+		// 每个汉字是一个词，不同段落之间很少有公共子序列
+		words := make([]rune, 40)
+		for k := range words {
+			words[k] = rune(0x4e00 + (i*31+k*17)%2000)
+		}
+		fmt.Fprintf(&old, `<w:p><w:r><w:t>%s</w:t></w:r></w:p>`, string(words))
+		if i < paragraphs-1 {
+			words[i%40] = '改'
+			fmt.Fprintf(&new, `<w:p><w:r><w:t>%s</w:t></w:r></w:p>`, string(words))
+		}
+	}
+	return redlineDocument(old.String()), redlineDocument(new.String())
+}
+
+func TestRedlineLarge(t *testing.T) {
+	old, new := largeRedlineDocuments(200)
+	red := Redline(old, new, RedlineOptions{})
+	// 插入的段落、199个逐词比较的段落和1个删除的段落，没有配对的段落会各出现两次
+	if blocks, _ := bodyBlocks(red.child("body")); len(blocks) != 201 {
+		t.Errorf("got %d paragraphs, want 201", len(blocks))
+	}
+}
+
+func BenchmarkRedline(b *testing.B) {
+	old, new := largeRedlineDocuments(2000)
+	opts := RedlineOptions{Date: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Redline(old, new, opts)
+	}
+}
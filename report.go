@@ -0,0 +1,273 @@
+// 压缩统计
+// PackReport记录一次Pack各阶段的效果：输入输出的长度、_h定义和_r引用的数量、
+// 节省最多的重复子树、各元素打包前后的长度、被删除的内容以及各阶段的耗时
+// 长度按DocTrim.Tokenizer计量，未设置时按字节计
+
+package DocTrim
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/nbio/xml"
+)
+
+// reportTopSubtrees 报告中列出的重复子树数
+const reportTopSubtrees = 10
+
+// PackReport 一次Pack的统计
+type PackReport struct {
+	// Unit 长度单位，bytes或tokens
+	Unit       string `json:"unit"`
+	InputSize  int    `json:"input_size"`
+	OutputSize int    `json:"output_size"`
+	// Definitions 带_h的定义数，References 带_r的引用数
+	Definitions int `json:"definitions"`
+	References  int `json:"references"`
+	// Repeated 按节省的长度从大到小排列的重复子树
+	Repeated []RepeatedSubtree `json:"repeated"`
+	// Elements 各元素打包前后的长度，按打包前的长度从大到小排列
+	Elements []ElementReport `json:"elements"`
+	// Omitted 各阶段删除的内容及数量，如修订、清理规则、缺省值
+	Omitted map[string]int `json:"omitted"`
+	// Stages 各阶段的耗时，按执行顺序排列
+	Stages []StageTiming `json:"stages"`
+}
+
+// RepeatedSubtree 被引用的重复子树
+type RepeatedSubtree struct {
+	// Name 元素名，Hash 输出中_h和_r的值
+	Name string `json:"name"`
+	Hash string `json:"hash"`
+	// Path 定义在打包前文档中的路径
+	Path       string `json:"path"`
+	References int    `json:"references"`
+	// Size 一份子树的长度，Saved 引用代替副本节省的长度，减去了_h属性的开销
+	// 嵌套的重复子树在外层和内层都会计入，各项之和大于实际节省的长度
+	Size  int `json:"size"`
+	Saved int `json:"saved"`
+}
+
+// ElementReport 一种元素打包前后的长度
+type ElementReport struct {
+	Name   string `json:"name"`
+	Count  int    `json:"count"`
+	Before int    `json:"before"`
+	After  int    `json:"after"`
+}
+
+// StageTiming 一个阶段的耗时
+type StageTiming struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Total 返回各阶段耗时之和
+func (r *PackReport) Total() time.Duration {
+	total := time.Duration(0)
+	for _, s := range r.Stages {
+		total += s.Duration
+	}
+	return total
+}
+
+// PackWithReport 与Pack相同，同时返回统计
+func (slim *DocTrim) PackWithReport(xmlData io.Reader) ([]byte, *PackReport, error) {
+	input, err := io.ReadAll(xmlData)
+	if err != nil {
+		return nil, nil, err
+	}
+	start := time.Now()
+	var root Node
+	if err := xml.Unmarshal(input, &root); err != nil {
+		return nil, nil, err
+	}
+	report := slim.newReport()
+	report.stage("decode", start)
+	return slim.finishReport(&root, input, report)
+}
+
+// PackNodeWithReport 与PackNode相同，同时返回统计，打包前的长度按root序列化的结果计算
+func (slim *DocTrim) PackNodeWithReport(root *Node) ([]byte, *PackReport, error) {
+	input, err := root.Marshal()
+	if err != nil {
+		return nil, nil, err
+	}
+	input = EmptyToSelfClosing(input)
+	return slim.finishReport(root, input, slim.newReport())
+}
+
+// newReport 创建空的统计
+func (slim *DocTrim) newReport() *PackReport {
+	unit := "bytes"
+	if slim.Tokenizer != nil {
+		unit = "tokens"
+	}
+	return &PackReport{Unit: unit, Omitted: map[string]int{}}
+}
+
+// finishReport 打包root并补全统计，input是打包前的XML
+func (slim *DocTrim) finishReport(root *Node, input []byte, report *PackReport) ([]byte, *PackReport, error) {
+	output, err := slim.packNode(root, report)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start := time.Now()
+	report.InputSize = slim.measure(input)
+	report.OutputSize = slim.measure(output)
+	before, err := ElementCosts(input, slim.measure)
+	if err != nil {
+		return nil, nil, err
+	}
+	after, err := ElementCosts(output, slim.measure)
+	if err != nil {
+		return nil, nil, err
+	}
+	index := map[string]int{}
+	for _, c := range before {
+		index[c.Name] = len(report.Elements)
+		report.Elements = append(report.Elements, ElementReport{Name: c.Name, Count: c.Count, Before: c.Size})
+	}
+	for _, c := range after {
+		i, ok := index[c.Name]
+		if !ok {
+			i = len(report.Elements)
+			report.Elements = append(report.Elements, ElementReport{Name: c.Name})
+		}
+		report.Elements[i].After = c.Size
+	}
+	report.stage("report", start)
+	return output, report, nil
+}
+
+// stage 记录从start开始的阶段耗时，r为nil时忽略
+func (r *PackReport) stage(name string, start time.Time) {
+	if r != nil {
+		r.Stages = append(r.Stages, StageTiming{Name: name, Duration: time.Since(start)})
+	}
+}
+
+// omit 记录删除的内容，r为nil时忽略
+func (r *PackReport) omit(what string, n int) {
+	if r != nil && n > 0 {
+		r.Omitted[what] += n
+	}
+}
+
+// repeatedCandidate 计算哈希之后、压缩之前记录的重复子树
+type repeatedCandidate struct {
+	node *Node
+	path string
+	size int
+}
+
+// repeatedCandidates 返回被引用的子树及其长度，须在Compact之前调用
+func (slim *DocTrim) repeatedCandidates(root *Node) map[uint64]repeatedCandidate {
+	candidates := map[uint64]repeatedCandidate{}
+	var walk func(node *Node, path string)
+	walk = func(node *Node, path string) {
+		if node.isCompat {
+			return
+		}
+		if node.refCount > 0 {
+			candidates[node.hash] = repeatedCandidate{node: node, path: path, size: slim.measure(detachedMarkup(node))}
+		}
+		for i, p := range childPaths(node, path) {
+			walk(node.Children[i], p)
+		}
+	}
+	walk(root, "/"+qualifiedName(root))
+	return candidates
+}
+
+// countReferences 统计压缩后的_h定义和每个哈希的_r引用数
+func (r *PackReport) countReferences(root *Node, candidates map[uint64]repeatedCandidate, measure func(data []byte) int) {
+	refs := map[uint64]int{}
+	var walk func(node *Node)
+	walk = func(node *Node) {
+		for _, a := range node.Attrs {
+			switch a.Name.Local {
+			case hashTag:
+				r.Definitions++
+			case refTag:
+				r.References++
+				hash, _ := strconv.ParseUint(a.Value, 16, 64)
+				refs[hash]++
+			}
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	for hash, c := range candidates {
+		if refs[hash] == 0 {
+			continue
+		}
+		hex := strconv.FormatUint(hash, 16)
+		name := prefixedName(c.node.XMLName)
+		ref := []byte("<" + name + " " + refTag + `="` + hex + `" />`)
+		def := []byte(" " + hashTag + `="` + hex + `"`)
+		r.Repeated = append(r.Repeated, RepeatedSubtree{
+			Name:       name,
+			Hash:       hex,
+			Path:       c.path,
+			References: refs[hash],
+			Size:       c.size,
+			Saved:      refs[hash]*(c.size-measure(ref)) - measure(def),
+		})
+	}
+	sort.Slice(r.Repeated, func(i, j int) bool {
+		if r.Repeated[i].Saved != r.Repeated[j].Saved {
+			return r.Repeated[i].Saved > r.Repeated[j].Saved
+		}
+		return r.Repeated[i].Hash < r.Repeated[j].Hash
+	})
+	if len(r.Repeated) > reportTopSubtrees {
+		r.Repeated = r.Repeated[:reportTopSubtrees]
+	}
+}
+
+// detachedMarkup 按输出中的写法序列化子树：带前缀的限定名，不带命名空间声明，空元素自闭合
+func detachedMarkup(node *Node) []byte {
+	var buf bytes.Buffer
+	var write func(node *Node)
+	write = func(node *Node) {
+		name := prefixedName(node.XMLName)
+		buf.WriteString("<" + name)
+		for _, a := range node.Attrs {
+			buf.WriteString(" " + prefixedName(a.Name) + `="`)
+			xml.EscapeText(&buf, []byte(a.Value))
+			buf.WriteString(`"`)
+		}
+		if len(node.Children) == 0 && len(node.Content) == 0 {
+			buf.WriteString(" />")
+			return
+		}
+		buf.WriteString(">")
+		xml.EscapeText(&buf, node.Content)
+		for _, child := range node.Children {
+			write(child)
+		}
+		buf.WriteString("</" + name + ">")
+	}
+	write(node)
+	return buf.Bytes()
+}
+
+// countOmittedSections 返回OmitNode将清空的w:sectPr数
+func countOmittedSections(node *Node) int {
+	n := 0
+	if node.XMLName.Local == "sectPr" && (len(node.Attrs) > 0 || len(node.Children) > 0) {
+		n++
+	}
+	for _, child := range node.Children {
+		n += countOmittedSections(child)
+	}
+	return n
+}
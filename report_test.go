@@ -0,0 +1,88 @@
+package DocTrim
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+func TestPackWithReport(t *testing.T) {
+	data, _ := os.ReadFile("docs/test.xml")
+	slim := DocTrim{StripRules: DefaultStripProfile, Defaults: DefaultsStrict}
+	packed, report, err := slim.PackWithReport(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 统计不影响打包结果
+	plain := DocTrim{StripRules: DefaultStripProfile, Defaults: DefaultsStrict}
+	want, _ := plain.Pack(bytes.NewReader(data))
+	if !bytes.Equal(packed, want) {
+		t.Error("report changed the packed output")
+	}
+
+	if report.Unit != "bytes" || report.InputSize != len(data) || report.OutputSize != len(packed) {
+		t.Errorf("got sizes %d -> %d %s", report.InputSize, report.OutputSize, report.Unit)
+	}
+	if report.Definitions != bytes.Count(packed, []byte(hashTag+`="`)) || report.References != bytes.Count(packed, []byte(refTag+`="`)) {
+		t.Errorf("got %d definitions, %d references", report.Definitions, report.References)
+	}
+	if len(report.Repeated) == 0 || len(report.Repeated) > reportTopSubtrees {
+		t.Fatalf("got %d repeated subtrees", len(report.Repeated))
+	}
+	for i, r := range report.Repeated {
+		if i > 0 && r.Saved > report.Repeated[i-1].Saved {
+			t.Errorf("repeated subtrees not sorted by saved bytes")
+		}
+		if !strings.Contains(r.Path, "/"+r.Name+"[") {
+			t.Errorf("path %s does not contain %s", r.Path, r.Name)
+		}
+	}
+
+	before, after := 0, 0
+	for _, e := range report.Elements {
+		before += e.Before
+		after += e.After
+	}
+	if before != report.InputSize || after != report.OutputSize {
+		t.Errorf("element breakdown sums to %d -> %d", before, after)
+	}
+	if report.Omitted["sectPr"] != 1 || report.Omitted["defaults"] == 0 {
+		t.Errorf("got omitted %v", report.Omitted)
+	}
+	stages := []string{}
+	for _, s := range report.Stages {
+		stages = append(stages, s.Name)
+	}
+	if got := strings.Join(stages, ","); got != "decode,strip,defaults,hash,compact,marshal,report" {
+		t.Errorf("got stages %s", got)
+	}
+
+	if _, err := json.Marshal(report); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPackNodeWithReportTokens(t *testing.T) {
+	var root Node
+	src := `<w:document xmlns:w="` + nsWord + `"><w:body>` +
+		strings.Repeat(`<w:p><w:r><w:rPr><w:b/><w:sz w:val="28"/></w:rPr><w:t>重复的段落</w:t></w:r></w:p>`, 5) +
+		`</w:body></w:document>`
+	if err := xml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatal(err)
+	}
+	slim := DocTrim{Tokenizer: DefaultTokenizer()}
+	packed, report, err := slim.PackNodeWithReport(&root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Unit != "tokens" || report.OutputSize != DefaultTokenizer().Count(packed) || report.OutputSize >= report.InputSize {
+		t.Errorf("got %d -> %d %s", report.InputSize, report.OutputSize, report.Unit)
+	}
+	if len(report.Repeated) != 1 || report.Repeated[0].Name != "w:p" || report.Repeated[0].References != 4 {
+		t.Errorf("got repeated %+v", report.Repeated)
+	}
+}
@@ -0,0 +1,294 @@
+// 修订处理
+// 接受或拒绝w:ins、w:del、w:moveFrom/To以及w:rPrChange、w:pPrChange等格式修订，
+// 可以按作者和时间筛选；标记模式下把插入和删除渲染为{++ ++}、{-- --}文本标记(CriticMarkup)，
+// 导出的纯文本和Markdown中可以直接看到修改
+
+package DocTrim
+
+import (
+	"strings"
+	"time"
+)
+
+// RevisionMode 修订的处理方式
+type RevisionMode int
+
+const (
+	// RevisionsKeep 保留修订
+	RevisionsKeep RevisionMode = iota
+	// RevisionsAccept 接受修订
+	RevisionsAccept
+	// RevisionsReject 拒绝修订
+	RevisionsReject
+	// RevisionsMark 插入和删除转换为文本标记，格式修订按接受处理
+	RevisionsMark
+)
+
+const (
+	insertOpen  = "{++"
+	insertClose = "++}"
+	deleteOpen  = "{--"
+	deleteClose = "--}"
+)
+
+// RevisionFilter 选择要处理的修订，零值表示处理全部修订
+type RevisionFilter struct {
+	// Authors 只处理这些作者的修订
+	Authors []string
+	// After、Before 只处理该时间范围内的修订，没有日期的修订不处理
+	After  time.Time
+	Before time.Time
+}
+
+// Match 判断修订元素是否满足条件
+func (f RevisionFilter) Match(rev *Node) bool {
+	if len(f.Authors) > 0 {
+		author, _ := rev.attr("author")
+		found := false
+		for _, a := range f.Authors {
+			if a == author {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.After.IsZero() && f.Before.IsZero() {
+		return true
+	}
+	value, _ := rev.attr("date")
+	date, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return false
+	}
+	return (f.After.IsZero() || !date.Before(f.After)) && (f.Before.IsZero() || date.Before(f.Before))
+}
+
+// contentRevisions 包含内容的修订元素，true表示插入，false表示删除
+var contentRevisions = map[string]bool{
+	"ins": true, "moveTo": true,
+	"del": false, "moveFrom": false,
+}
+
+// moveRanges 移动范围标记
+var moveRanges = map[string]bool{
+	"moveFromRangeStart": true, "moveFromRangeEnd": true,
+	"moveToRangeStart": true, "moveToRangeEnd": true,
+}
+
+// preservedProps 拒绝w:pPrChange时保留的子元素，修订前的属性中不包含这些元素
+var preservedProps = map[string]bool{
+	"rPr": true, "sectPr": true, "pPrChange": true,
+}
+
+// preservedMarks 拒绝段落标记的w:rPrChange或表格行的w:trPrChange时保留的修订记录，
+// 段落标记和表格行本身的插入、删除随后由marks处理
+var preservedMarks = map[string]bool{
+	"ins": true, "del": true, "moveFrom": true, "moveTo": true,
+}
+
+// ApplyRevisions 按mode处理子树中满足filter的修订，返回处理的修订数
+func ApplyRevisions(root *Node, mode RevisionMode, filter RevisionFilter) int {
+	if mode == RevisionsKeep {
+		return 0
+	}
+	r := &revisionPass{mode: mode, filter: filter}
+	r.apply(root)
+	root.clearDigests()
+	return r.count
+}
+
+type revisionPass struct {
+	mode   RevisionMode
+	filter RevisionFilter
+	count  int
+}
+
+func (r *revisionPass) apply(node *Node) {
+	children := make([]*Node, 0, len(node.Children))
+	for _, child := range node.Children {
+		r.apply(child)
+		children = append(children, r.resolve(node, child)...)
+	}
+	node.Children = children
+
+	if strings.HasSuffix(node.XMLName.Local, "Pr") || node.XMLName.Local == "tblGrid" {
+		r.properties(node)
+	}
+	r.marks(node)
+}
+
+// resolve 返回内容修订处理后替换child的节点
+func (r *revisionPass) resolve(parent, child *Node) []*Node {
+	if child.XMLName.Space != nsWord || !r.filter.Match(child) {
+		return []*Node{child}
+	}
+	local := child.XMLName.Local
+	if moveRanges[local] {
+		r.count++
+		return nil
+	}
+	inserted, ok := contentRevisions[local]
+	// 属性中的w:ins、w:del表示段落标记或表格行的修订，由marks处理
+	if !ok || strings.HasSuffix(parent.XMLName.Local, "Pr") {
+		return []*Node{child}
+	}
+	r.count++
+
+	switch {
+	case r.mode == RevisionsMark && inserted:
+		return wrapRevision(child.Children, insertOpen, insertClose)
+	case r.mode == RevisionsMark:
+		restoreDeleted(child)
+		return wrapRevision(child.Children, deleteOpen, deleteClose)
+	case (r.mode == RevisionsAccept) == inserted:
+		if !inserted {
+			restoreDeleted(child)
+		}
+		return child.Children
+	}
+	return nil
+}
+
+// wrapRevision 在修订内容前后加上标记文本
+func wrapRevision(children []*Node, open, close string) []*Node {
+	out := []*Node{markerRun(open)}
+	out = append(out, children...)
+	return append(out, markerRun(close))
+}
+
+func markerRun(text string) *Node {
+	t := newWordNode("t")
+	setText(t, text)
+	return newWordNode("r", t)
+}
+
+// restoreDeleted 将删除的文本和域代码转换为正常内容
+func restoreDeleted(node *Node) {
+	switch node.XMLName.Local {
+	case "delText":
+		node.XMLName.Local = "t"
+	case "delInstrText":
+		node.XMLName.Local = "instrText"
+	}
+	for _, child := range node.Children {
+		restoreDeleted(child)
+	}
+}
+
+// properties 处理属性节点中的w:rPrChange、w:pPrChange等格式修订
+// 接受时删除修订记录，拒绝时用修订前的属性替换当前属性
+func (r *revisionPass) properties(props *Node) {
+	change := props.child(props.XMLName.Local + "Change")
+	if change == nil || !r.filter.Match(change) {
+		return
+	}
+	r.count++
+	if r.mode != RevisionsReject {
+		replaceChild(props, change, nil)
+		return
+	}
+
+	children := []*Node{}
+	if old := change.child(props.XMLName.Local); old != nil {
+		children = append(children, old.Children...)
+	}
+	preserved := map[string]bool{}
+	switch props.XMLName.Local {
+	case "pPr":
+		preserved = preservedProps
+	case "rPr", "trPr":
+		// run的w:rPr中没有这些元素，只有段落标记的w:rPr会保留
+		preserved = preservedMarks
+	}
+	for _, c := range props.Children {
+		if preserved[c.XMLName.Local] && c != change {
+			children = append(children, c)
+		}
+	}
+	props.Children = children
+}
+
+// marks 处理段落标记和表格行的插入、删除
+// 段落标记被删除时与下一段合并，表格行被删除时删除整行
+func (r *revisionPass) marks(node *Node) {
+	children := make([]*Node, 0, len(node.Children))
+	var pending *Node
+	for _, child := range node.Children {
+		if pending != nil && child.XMLName.Local == "p" && child.XMLName.Space == nsWord {
+			child = joinParagraphs(pending, child)
+			pending = nil
+		}
+
+		var rev *Node
+		switch child.XMLName.Local {
+		case "p":
+			if pPr := child.child("pPr"); pPr != nil {
+				rev = markRevision(pPr.child("rPr"), r.filter)
+			}
+		case "tr":
+			rev = markRevision(child.child("trPr"), r.filter)
+		}
+		if rev == nil {
+			if pending != nil {
+				children = append(children, pending)
+				pending = nil
+			}
+			children = append(children, child)
+			continue
+		}
+
+		r.count++
+		removeMark(child, rev)
+		remove := r.mode != RevisionsMark && (r.mode == RevisionsAccept) != contentRevisions[rev.XMLName.Local]
+		switch {
+		case !remove:
+			children = append(children, child)
+		case child.XMLName.Local == "p":
+			pending = child
+		}
+	}
+	if pending != nil {
+		children = append(children, pending)
+	}
+	node.Children = children
+}
+
+// markRevision 返回属性中满足条件的w:ins或w:del
+func markRevision(props *Node, filter RevisionFilter) *Node {
+	if props == nil {
+		return nil
+	}
+	for _, c := range props.Children {
+		if (c.XMLName.Local == "ins" || c.XMLName.Local == "del") && filter.Match(c) {
+			return c
+		}
+	}
+	return nil
+}
+
+// removeMark 删除段落标记或表格行上的修订记录
+func removeMark(node, rev *Node) {
+	props := node.child("trPr")
+	if node.XMLName.Local == "p" {
+		props = node.child("pPr").child("rPr")
+	}
+	replaceChild(props, rev, nil)
+}
+
+// joinParagraphs 合并段落，合并后的段落使用后一段的段落标记
+func joinParagraphs(first, second *Node) *Node {
+	joined := &Node{XMLName: second.XMLName, Attrs: second.Attrs, Content: second.Content}
+	if pPr := second.child("pPr"); pPr != nil {
+		joined.Children = append(joined.Children, pPr)
+	}
+	for _, p := range []*Node{first, second} {
+		for _, c := range p.Children {
+			if c.XMLName.Local != "pPr" {
+				joined.Children = append(joined.Children, c)
+			}
+		}
+	}
+	return joined
+}
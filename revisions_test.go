@@ -0,0 +1,132 @@
+package DocTrim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbio/xml"
+)
+
+const trackedChanges = `<w:body xmlns:w="` + nsWord + `">` +
+	`<w:p><w:r><w:t xml:space="preserve">The fee is </w:t></w:r>` +
+	`<w:del w:id="1" w:author="Alice" w:date="2024-01-10T09:00:00Z"><w:r><w:delText>100</w:delText></w:r></w:del>` +
+	`<w:ins w:id="2" w:author="Alice" w:date="2024-01-10T09:00:00Z"><w:r><w:t>200</w:t></w:r></w:ins>` +
+	`<w:r><w:rPr><w:b/><w:rPrChange w:id="3" w:author="Bob" w:date="2024-03-01T09:00:00Z"><w:rPr><w:i/></w:rPr></w:rPrChange></w:rPr><w:t xml:space="preserve"> USD</w:t></w:r></w:p>` +
+	`<w:p><w:pPr><w:jc w:val="center"/><w:rPr><w:del w:id="4" w:author="Bob" w:date="2024-03-01T09:00:00Z"/></w:rPr>` +
+	`<w:pPrChange w:id="5" w:author="Bob" w:date="2024-03-01T09:00:00Z"><w:pPr><w:jc w:val="left"/></w:pPr></w:pPrChange></w:pPr>` +
+	`<w:r><w:t>first</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>second</w:t></w:r></w:p>` +
+	`<w:moveFromRangeStart w:id="6" w:author="Bob" w:date="2024-03-01T09:00:00Z" w:name="move1"/>` +
+	`<w:p><w:moveFrom w:id="7" w:author="Bob" w:date="2024-03-01T09:00:00Z"><w:r><w:t>moved</w:t></w:r></w:moveFrom></w:p>` +
+	`<w:moveFromRangeEnd w:id="6"/>` +
+	`<w:tbl><w:tr><w:trPr><w:ins w:id="8" w:author="Alice" w:date="2024-01-10T09:00:00Z"/></w:trPr>` +
+	`<w:tc><w:p><w:r><w:t>row</w:t></w:r></w:p></w:tc></w:tr></w:tbl>` +
+	`</w:body>`
+
+func parseRevisions(t *testing.T) *Node {
+	var root Node
+	if err := xml.Unmarshal([]byte(trackedChanges), &root); err != nil {
+		t.Fatal(err)
+	}
+	return &root
+}
+
+func TestAcceptRevisions(t *testing.T) {
+	root := parseRevisions(t)
+	if n := ApplyRevisions(root, RevisionsAccept, RevisionFilter{}); n != 9 {
+		t.Errorf("accepted %d revisions, want 9", n)
+	}
+	text := ExtractText(root, nil).Text
+	if text != "The fee is 200 USD\nfirstsecond\n\nrow\n" {
+		t.Errorf("got %q", text)
+	}
+	data, _ := root.Marshal()
+	for _, tag := range []string{"Change", "w:ins", "w:del", "move", "w:i/"} {
+		if bytes.Contains(data, []byte(tag)) {
+			t.Errorf("%s left in %s", tag, data)
+		}
+	}
+	// 合并后的段落使用后一段的段落属性
+	if bytes.Contains(data, []byte(`center`)) {
+		t.Errorf("joined paragraph should use second paragraph mark: %s", data)
+	}
+}
+
+func TestRejectRevisions(t *testing.T) {
+	root := parseRevisions(t)
+	ApplyRevisions(root, RevisionsReject, RevisionFilter{})
+	text := ExtractText(root, nil).Text
+	if text != "The fee is 100 USD\nfirst\nsecond\nmoved\n" {
+		t.Errorf("got %q", text)
+	}
+	data, _ := root.Marshal()
+	for _, want := range []string{`<w:rPr><w:i></w:i></w:rPr>`, `<w:pPr><w:jc w:val="left"></w:jc><w:rPr></w:rPr></w:pPr>`} {
+		if !bytes.Contains(data, []byte(want)) {
+			t.Errorf("missing %s in %s", want, data)
+		}
+	}
+	if bytes.Contains(data, []byte("delText")) || bytes.Contains(data, []byte("w:tbl><w:tr")) {
+		t.Errorf("unexpected content %s", data)
+	}
+}
+
+func TestRejectInsertedMarkWithFormatChange(t *testing.T) {
+	// 插入的段落标记同时有格式修订，拒绝时段落标记的w:ins不能随w:rPrChange一起丢失
+	src := `<w:body xmlns:w="` + nsWord + `"><w:p><w:pPr><w:rPr><w:ins w:id="1" w:author="A"/><w:b/>` +
+		`<w:rPrChange w:id="2" w:author="A"><w:rPr/></w:rPrChange></w:rPr></w:pPr><w:r><w:t>one</w:t></w:r></w:p>` +
+		`<w:p><w:r><w:t>two</w:t></w:r></w:p></w:body>`
+	var root Node
+	if err := xml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatal(err)
+	}
+	if n := ApplyRevisions(&root, RevisionsReject, RevisionFilter{}); n != 2 {
+		t.Errorf("rejected %d revisions, want 2", n)
+	}
+	if text := ExtractText(&root, nil).Text; text != "onetwo\n" {
+		t.Errorf("got %q", text)
+	}
+}
+
+func TestRevisionFilter(t *testing.T) {
+	root := parseRevisions(t)
+	ApplyRevisions(root, RevisionsAccept, RevisionFilter{Authors: []string{"Alice"}})
+	data, _ := root.Marshal()
+	if bytes.Contains(data, []byte(`w:author="Alice"`)) || !bytes.Contains(data, []byte(`w:author="Bob"`)) {
+		t.Errorf("author filter failed: %s", data)
+	}
+
+	root = parseRevisions(t)
+	after := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	ApplyRevisions(root, RevisionsReject, RevisionFilter{After: after})
+	// 只拒绝Bob的修订，Alice的修改保留
+	if text := ExtractText(root, nil).Text; text != "The fee is 200 USD\nfirst\nsecond\nmoved\nrow\n" {
+		t.Errorf("got %q", text)
+	}
+
+	rev := &Node{Attrs: []xml.Attr{{Name: xml.Name{Space: nsWord, Local: "date"}, Value: "invalid"}}}
+	if (RevisionFilter{Before: after}).Match(rev) {
+		t.Error("revision without valid date should not match a date filter")
+	}
+}
+
+func TestMarkRevisions(t *testing.T) {
+	root := parseRevisions(t)
+	ApplyRevisions(root, RevisionsMark, RevisionFilter{})
+	text := ExtractText(root, nil).Text
+	if !strings.HasPrefix(text, "The fee is {--100--}{++200++} USD\nfirst\nsecond\n{--moved--}\n") {
+		t.Errorf("got %q", text)
+	}
+}
+
+func TestPackRevisions(t *testing.T) {
+	slim := DocTrim{Revisions: RevisionsAccept}
+	data, err := slim.Pack(strings.NewReader(trackedChanges))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("100")) || !bytes.Contains(data, []byte("200")) {
+		t.Errorf("got %s", data)
+	}
+}
@@ -0,0 +1,158 @@
+// 合并格式相同的相邻run
+// Word常把一段文字拆成多个w:rPr相同的w:r，语义模式下将其合并
+
+package DocTrim
+
+import (
+	"strings"
+
+	"github.com/nbio/xml"
+)
+
+// PackMode Pack的处理模式
+type PackMode int
+
+const (
+	// ModeExact 无损模式，Unpack可还原原始xml
+	ModeExact PackMode = iota
+	// ModeSemantic 语义模式，允许不改变显示效果的规范化，Unpack不再逐字节还原
+	ModeSemantic
+)
+
+// runContent 可以随run合并的内容元素，其余内容(域、图形、脚注引用等)阻止合并
+var runContent = map[string]bool{
+	"t":             true,
+	"tab":           true,
+	"br":            true,
+	"cr":            true,
+	"noBreakHyphen": true,
+	"softHyphen":    true,
+	"sym":           true,
+}
+
+// MergeRuns 合并相邻且格式相同的w:r，并删除只有w:rPr的空run
+// 格式是否相同由ComputeHash得到的w:rPr子树哈希判断，返回减少的run数
+func (slim *DocTrim) MergeRuns(root *Node) int {
+	slim.Reset()
+	root.ComputeHash(slim)
+	merged := mergeRuns(root)
+	root.clearDigests()
+	return merged
+}
+
+func mergeRuns(node *Node) int {
+	merged := 0
+	children := make([]*Node, 0, len(node.Children))
+	for _, child := range node.Children {
+		if !isTextRun(child) {
+			merged += mergeRuns(child)
+			children = append(children, child)
+			continue
+		}
+		if isEmptyRun(child) {
+			merged++
+			continue
+		}
+		if n := len(children); n > 0 && isTextRun(children[n-1]) && sameRunFormat(children[n-1], child) {
+			appendRun(children[n-1], child)
+			merged++
+			continue
+		}
+		children = append(children, child)
+	}
+	node.Children = children
+	return merged
+}
+
+// isTextRun 判断是否为只含文本类内容的w:r
+func isTextRun(node *Node) bool {
+	if node.XMLName.Space != nsWord || node.XMLName.Local != "r" {
+		return false
+	}
+	for _, child := range node.Children {
+		if child.XMLName.Local != "rPr" && !runContent[child.XMLName.Local] {
+			return false
+		}
+	}
+	return true
+}
+
+func isEmptyRun(run *Node) bool {
+	for _, child := range run.Children {
+		if child.XMLName.Local != "rPr" {
+			return false
+		}
+	}
+	return true
+}
+
+// sameRunFormat 比较两个run的w:rPr哈希以及除rsid外的属性
+func sameRunFormat(l, r *Node) bool {
+	lPr, rPr := l.child("rPr"), r.child("rPr")
+	if (lPr == nil) != (rPr == nil) {
+		return false
+	}
+	if lPr != nil && lPr.hash != rPr.hash {
+		return false
+	}
+
+	lAttrs, rAttrs := runAttrs(l), runAttrs(r)
+	if len(lAttrs) != len(rAttrs) {
+		return false
+	}
+	for i := range lAttrs {
+		if lAttrs[i] != rAttrs[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// runAttrs 返回run上除修订标识rsid*之外的属性
+func runAttrs(run *Node) []xml.Attr {
+	attrs := []xml.Attr{}
+	for _, a := range run.Attrs {
+		if !strings.HasPrefix(a.Name.Local, "rsid") {
+			attrs = append(attrs, a)
+		}
+	}
+	return attrs
+}
+
+// appendRun 将from的内容追加到to，相邻的w:t合并为一个
+func appendRun(to, from *Node) {
+	for _, child := range from.Children {
+		if child.XMLName.Local == "rPr" {
+			continue
+		}
+		last := to.Children[len(to.Children)-1]
+		if child.XMLName.Local != "t" || last.XMLName.Local != "t" {
+			to.Children = append(to.Children, child)
+			continue
+		}
+
+		text := make([]byte, 0, len(last.Content)+len(child.Content))
+		text = append(append(text, last.Content...), child.Content...)
+		to.Children[len(to.Children)-1] = &Node{
+			XMLName:  last.XMLName,
+			Attrs:    textAttrs(last, child, text),
+			Content:  text,
+			Children: []*Node{},
+		}
+	}
+}
+
+// textAttrs 合并后文本首尾有空白或原文本声明了保留空白时，设置xml:space="preserve"
+func textAttrs(l, r *Node, text []byte) []xml.Attr {
+	for _, t := range []*Node{l, r} {
+		for _, a := range t.Attrs {
+			if a.Name.Local == "space" {
+				return []xml.Attr{a}
+			}
+		}
+	}
+	if strings.TrimSpace(string(text)) != string(text) {
+		return []xml.Attr{{Name: xml.Name{Space: nsXML, Local: "space"}, Value: "preserve"}}
+	}
+	return []xml.Attr{}
+}
@@ -0,0 +1,106 @@
+package DocTrim
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+// allText 按文档顺序拼接w:t文本
+func allText(node *Node) string {
+	var b strings.Builder
+	var walk func(node *Node)
+	walk = func(node *Node) {
+		if node.XMLName.Local == "t" && node.XMLName.Space == nsWord {
+			b.Write(node.Content)
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(node)
+	return b.String()
+}
+
+func TestMergeRuns(t *testing.T) {
+	src := `<w:p xmlns:w="` + nsWord + `">` +
+		`<w:r w:rsidR="001"><w:rPr><w:b/></w:rPr><w:t>{{cust</w:t></w:r>` +
+		`<w:r w:rsidR="002"><w:rPr><w:b/></w:rPr><w:t xml:space="preserve">omer_ </w:t></w:r>` +
+		`<w:r w:rsidR="003"><w:rPr><w:b/></w:rPr><w:tab/><w:t>name}}</w:t></w:r>` +
+		`<w:r><w:rPr><w:i/></w:rPr><w:t>italic</w:t></w:r>` +
+		`<w:r><w:rPr><w:i/></w:rPr></w:r>` +
+		`<w:r><w:rPr><w:i/></w:rPr><w:fldChar w:fldCharType="begin"/></w:r>` +
+		`<w:r><w:rPr><w:i/></w:rPr><w:t>after</w:t></w:r>` +
+		`</w:p>`
+	var p Node
+	if err := xml.Unmarshal([]byte(src), &p); err != nil {
+		t.Fatal(err)
+	}
+
+	s := DocTrim{}
+	if merged := s.MergeRuns(&p); merged != 3 {
+		t.Errorf("merged %d runs, want 3", merged)
+	}
+	if len(p.Children) != 4 {
+		t.Fatalf("got %d runs, want 4", len(p.Children))
+	}
+
+	first := p.Children[0]
+	names := []string{}
+	for _, c := range first.Children {
+		names = append(names, c.XMLName.Local)
+	}
+	if strings.Join(names, ",") != "rPr,t,tab,t" {
+		t.Errorf("unexpected run content %v", names)
+	}
+	if text := string(first.Children[1].Content); text != "{{customer_ " {
+		t.Errorf("got text %q", text)
+	}
+	if space, _ := first.Children[1].attr("space"); space != "preserve" {
+		t.Error("xml:space not kept")
+	}
+	if p.Children[2].child("fldChar") == nil {
+		t.Error("field run merged")
+	}
+}
+
+func TestPackSemantic(t *testing.T) {
+	exact, err := (&DocTrim{}).Pack(bytes.NewReader([]byte(testXml)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := DocTrim{Mode: ModeSemantic}
+	data, err := s.Pack(bytes.NewReader([]byte(testXml)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Printf("exact %d -> semantic %d", len(exact), len(data))
+	if len(data) >= len(exact) {
+		t.Errorf("semantic pack not smaller: %d >= %d", len(data), len(exact))
+	}
+
+	to, err := s.Unpack(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var from, back Node
+	xml.Unmarshal([]byte(testXml), &from)
+	if err := xml.Unmarshal(to, &back); err != nil {
+		t.Fatal(err)
+	}
+	if allText(&from) != allText(&back) {
+		t.Errorf("text changed: %q -> %q", allText(&from), allText(&back))
+	}
+
+	keep := DocTrim{Mode: ModeSemantic, KeepRuns: true}
+	kept, err := keep.Pack(bytes.NewReader([]byte(testXml)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(kept, exact) {
+		t.Error("KeepRuns should leave runs untouched")
+	}
+}
@@ -0,0 +1,546 @@
+// 外发文档清理
+// 文档交给外部服务之前删除作者和公司信息、批注、修订作者、隐藏文字、自定义XML、宏、
+// 外部链接、附加模板和嵌入的OLE对象
+// SanitizeNode只处理节点树，适用于Pack的输出；SanitizePackage还删除相关的部件和关系，
+// 并清除指向已删除关系的引用，结果可以直接写出为docx
+
+package DocTrim
+
+import (
+	"path"
+	"regexp"
+	"strings"
+)
+
+// 清理的内容类别，用于统计
+const (
+	SanitizeMetadata         = "metadata"
+	SanitizeComments         = "comments"
+	SanitizeRevisionAuthors  = "revision-authors"
+	SanitizeHiddenText       = "hidden-text"
+	SanitizeCustomXML        = "custom-xml"
+	SanitizeMacros           = "macros"
+	SanitizeExternalLinks    = "external-links"
+	SanitizeAttachedTemplate = "attached-template"
+	SanitizeEmbeddedObjects  = "embedded-objects"
+)
+
+const (
+	nsOffice = "urn:schemas-microsoft-com:office:office"
+	nsRel    = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+	// sanitizedAuthor 替换修订和批注作者的名字
+	sanitizedAuthor = "Author"
+	relTypeTemplate = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/attachedTemplate"
+	settingsPart    = "word/settings.xml"
+	appPart         = "docProps/app.xml"
+)
+
+// SanitizePolicy 清理策略，每项为true时删除对应的内容
+type SanitizePolicy struct {
+	// Metadata docProps中的作者、最后修改者、公司、经理和自定义属性
+	Metadata bool
+	// Comments 批注及其在正文中的范围和引用
+	Comments bool
+	// RevisionAuthors 修订和批注的作者替换为Author，删除缩写和people.xml
+	RevisionAuthors bool
+	// HiddenText 带w:vanish的隐藏文字，包括通过字符样式和段落样式隐藏的文字
+	HiddenText bool
+	// CustomXML w:customXml标记、数据绑定和customXml部件
+	CustomXML bool
+	// Macros VBA工程，宏文档的内容类型改为普通文档
+	Macros bool
+	// ExternalLinks 外部关系，超链接保留文字
+	ExternalLinks bool
+	// AttachedTemplate 附加模板的链接
+	AttachedTemplate bool
+	// EmbeddedObjects 嵌入的OLE对象，保留显示用的预览图
+	EmbeddedObjects bool
+}
+
+// DefaultSanitizePolicy 删除所有类别
+var DefaultSanitizePolicy = SanitizePolicy{
+	Metadata:         true,
+	Comments:         true,
+	RevisionAuthors:  true,
+	HiddenText:       true,
+	CustomXML:        true,
+	Macros:           true,
+	ExternalLinks:    true,
+	AttachedTemplate: true,
+	EmbeddedObjects:  true,
+}
+
+// Enabled 判断是否有需要清理的类别
+func (p SanitizePolicy) Enabled() bool {
+	return p != SanitizePolicy{}
+}
+
+// SanitizeReport 清理结果
+type SanitizeReport struct {
+	// Removed 每个类别删除或替换的元素、属性和关系数
+	Removed map[string]int `json:"removed"`
+	// Parts 删除的部件
+	Parts []string `json:"parts"`
+}
+
+func (r *SanitizeReport) add(counts map[string]int) {
+	for kind, n := range counts {
+		if n > 0 {
+			r.Removed[kind] += n
+		}
+	}
+}
+
+// SanitizeNode 按策略清理节点树，返回每个类别处理的数量
+// 不含包级的内容：文档属性、部件、关系和附加模板
+// 没有样式表，只能识别run上直接设置的w:vanish，通过样式隐藏的文字需要用SanitizePackage
+func SanitizeNode(root *Node, policy SanitizePolicy) map[string]int {
+	return sanitizeNode(root, policy, nil)
+}
+
+// sanitizeNode 按策略清理节点树，styles不为nil时按有效属性判断run是否隐藏
+func sanitizeNode(root *Node, policy SanitizePolicy, styles *Styles) map[string]int {
+	s := &sanitizer{policy: policy, counts: map[string]int{}, hidden: map[*Node]bool{}}
+	if policy.HiddenText && styles != nil {
+		walkRuns(root, nil, func(p, r *Node) {
+			if r == nil {
+				return
+			}
+			if rPr := styles.RunProps(p, r); rPr != nil && rPr.child("vanish") != nil && propOn(rPr.child("vanish")) {
+				s.hidden[r] = true
+			}
+		})
+	}
+	s.node(root)
+	root.clearDigests()
+	return s.counts
+}
+
+type sanitizer struct {
+	policy SanitizePolicy
+	counts map[string]int
+	// hidden 按样式计算出的隐藏run
+	hidden map[*Node]bool
+}
+
+// node 清理子节点，被拆开的元素的子节点接到原来的位置
+func (s *sanitizer) node(node *Node) {
+	if s.policy.RevisionAuthors {
+		s.authors(node)
+	}
+	children := make([]*Node, 0, len(node.Children))
+	for _, child := range node.Children {
+		switch kind, action := s.classify(child); action {
+		case sanitizeRemove:
+			s.counts[kind]++
+			continue
+		case sanitizeUnwrap:
+			s.counts[kind]++
+			s.node(child)
+			for _, c := range child.Children {
+				if c.XMLName.Local != "customXmlPr" {
+					children = append(children, c)
+				}
+			}
+			continue
+		}
+		s.node(child)
+		children = append(children, child)
+	}
+	node.Children = children
+}
+
+const (
+	sanitizeKeep = iota
+	sanitizeRemove
+	sanitizeUnwrap
+)
+
+// classify 返回节点的处理方式
+func (s *sanitizer) classify(node *Node) (string, int) {
+	if node.XMLName.Space == nsOffice && node.XMLName.Local == "OLEObject" && s.policy.EmbeddedObjects {
+		return SanitizeEmbeddedObjects, sanitizeRemove
+	}
+	if node.XMLName.Space != nsWord {
+		return "", sanitizeKeep
+	}
+	switch local := node.XMLName.Local; {
+	case s.policy.Comments && (local == "commentRangeStart" || local == "commentRangeEnd" || local == "commentReference" || isCommentReferenceRun(node)):
+		return SanitizeComments, sanitizeRemove
+	case s.policy.HiddenText && local == "r" && (s.hidden[node] || isHiddenRun(node)):
+		return SanitizeHiddenText, sanitizeRemove
+	case s.policy.HiddenText && (local == "vanish" || local == "specVanish") && propOn(node):
+		// 段落标记上的隐藏属性
+		return SanitizeHiddenText, sanitizeRemove
+	case s.policy.CustomXML && local == "customXml":
+		return SanitizeCustomXML, sanitizeUnwrap
+	case s.policy.CustomXML && local == "dataBinding":
+		return SanitizeCustomXML, sanitizeRemove
+	case s.policy.ExternalLinks && local == "hyperlink" && hasRelAttr(node, "id"):
+		// 带r:id的超链接都指向外部，文档内的跳转使用w:anchor
+		return SanitizeExternalLinks, sanitizeUnwrap
+	case s.policy.EmbeddedObjects && (local == "objectEmbed" || local == "objectLink"):
+		return SanitizeEmbeddedObjects, sanitizeRemove
+	}
+	return "", sanitizeKeep
+}
+
+// authors 将作者替换为sanitizedAuthor，删除作者缩写
+func (s *sanitizer) authors(node *Node) {
+	if node.XMLName.Space != nsWord {
+		return
+	}
+	attrs := node.Attrs[:0]
+	for _, a := range node.Attrs {
+		if a.Name.Space == nsWord {
+			switch a.Name.Local {
+			case "author":
+				if a.Value != sanitizedAuthor {
+					a.Value = sanitizedAuthor
+					s.counts[SanitizeRevisionAuthors]++
+				}
+			case "initials":
+				s.counts[SanitizeRevisionAuthors]++
+				continue
+			}
+		}
+		attrs = append(attrs, a)
+	}
+	node.Attrs = attrs
+}
+
+// isHiddenRun 判断run是否直接设置了隐藏
+func isHiddenRun(r *Node) bool {
+	rPr := r.child("rPr")
+	return rPr != nil && rPr.child("vanish") != nil && propOn(rPr.child("vanish"))
+}
+
+// isCommentReferenceRun 判断run是否只包含批注引用
+func isCommentReferenceRun(r *Node) bool {
+	if r.XMLName.Local != "r" {
+		return false
+	}
+	found := false
+	for _, c := range r.Children {
+		switch c.XMLName.Local {
+		case "rPr":
+		case "commentReference":
+			found = true
+		default:
+			return false
+		}
+	}
+	return found
+}
+
+// hasRelAttr 判断节点是否有r命名空间中本地名为local的属性
+func hasRelAttr(node *Node, local string) bool {
+	for _, a := range node.Attrs {
+		if a.Name.Space == nsRel && a.Name.Local == local {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	// commentPartRe 批注相关的部件
+	commentPartRe = regexp.MustCompile(`^word/comments(Extended|Ids|Extensible)?\.xml$`)
+	// macroPartRe VBA工程相关的部件
+	macroPartRe = regexp.MustCompile(`(^|/)(vbaProject\.bin|vbaData\.xml)$`)
+)
+
+// macroContentTypes 启用宏的主文档内容类型及对应的普通类型
+var macroContentTypes = map[string]string{
+	"application/vnd.ms-word.document.macroEnabled.main+xml":         "application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml",
+	"application/vnd.ms-word.template.macroEnabledTemplate.main+xml": "application/vnd.openxmlformats-officedocument.wordprocessingml.template.main+xml",
+}
+
+// SanitizePackage 按策略清理包，返回删除的内容
+func SanitizePackage(pkg *Package, policy SanitizePolicy) (*SanitizeReport, error) {
+	report := &SanitizeReport{Removed: map[string]int{}, Parts: []string{}}
+	var styles *Styles
+	if policy.HiddenText {
+		var err error
+		if styles, err = pkg.Styles(); err != nil {
+			return nil, err
+		}
+	}
+
+	// 正文、页眉页脚、脚注尾注和批注
+	for _, name := range pkg.ContentParts() {
+		if policy.Comments && commentPartRe.MatchString(name) {
+			continue
+		}
+		root, err := pkg.Part(name)
+		if err != nil {
+			return nil, err
+		}
+		if root == nil {
+			continue
+		}
+		counts := sanitizeNode(root, policy, styles)
+		if len(counts) == 0 {
+			continue
+		}
+		report.add(counts)
+		if err := pkg.SetPart(name, root); err != nil {
+			return nil, err
+		}
+	}
+
+	// 按策略删除整个部件
+	remove := func(kind string, match func(name string) bool) error {
+		for _, name := range pkg.Names() {
+			if _, ok := pkg.Data(name); !ok || !match(name) {
+				continue
+			}
+			if err := pkg.removePart(name); err != nil {
+				return err
+			}
+			report.Removed[kind]++
+			report.Parts = append(report.Parts, name)
+		}
+		return nil
+	}
+	removals := []struct {
+		enabled bool
+		kind    string
+		match   func(name string) bool
+	}{
+		{policy.Comments, SanitizeComments, commentPartRe.MatchString},
+		{policy.RevisionAuthors, SanitizeRevisionAuthors, func(name string) bool { return name == "word/people.xml" }},
+		{policy.CustomXML, SanitizeCustomXML, func(name string) bool { return strings.HasPrefix(name, "customXml/") }},
+		{policy.Macros, SanitizeMacros, macroPartRe.MatchString},
+		{policy.EmbeddedObjects, SanitizeEmbeddedObjects, func(name string) bool { return strings.HasPrefix(name, "word/embeddings/") }},
+		{policy.Metadata, SanitizeMetadata, func(name string) bool { return name == "docProps/custom.xml" }},
+	}
+	for _, r := range removals {
+		if !r.enabled {
+			continue
+		}
+		if err := remove(r.kind, r.match); err != nil {
+			return nil, err
+		}
+	}
+	if policy.Macros {
+		if err := pkg.replaceContentTypes(macroContentTypes); err != nil {
+			return nil, err
+		}
+	}
+
+	// 附加模板
+	if policy.AttachedTemplate {
+		n, err := pkg.removeElements(settingsPart, "attachedTemplate")
+		if err != nil {
+			return nil, err
+		}
+		report.Removed[SanitizeAttachedTemplate] += n
+		ids, err := pkg.removeRelationships(relsPart(settingsPart), func(rel *Node) bool {
+			t, _ := rel.attr("Type")
+			return t == relTypeTemplate
+		})
+		if err != nil {
+			return nil, err
+		}
+		report.Removed[SanitizeAttachedTemplate] += len(ids)
+		if n, err = pkg.removeElements(appPart, "Template"); err != nil {
+			return nil, err
+		}
+		report.Removed[SanitizeAttachedTemplate] += n
+	}
+
+	// 外部关系，附加模板由AttachedTemplate处理
+	if policy.ExternalLinks {
+		for _, name := range pkg.Names() {
+			if !strings.HasSuffix(name, ".rels") {
+				continue
+			}
+			ids, err := pkg.removeRelationships(name, func(rel *Node) bool {
+				mode, _ := rel.attr("TargetMode")
+				t, _ := rel.attr("Type")
+				return mode == "External" && t != relTypeTemplate
+			})
+			if err != nil {
+				return nil, err
+			}
+			report.Removed[SanitizeExternalLinks] += len(ids)
+		}
+	}
+
+	// 文档属性
+	if policy.Metadata {
+		for part, locals := range map[string][]string{
+			corePart: {"creator", "lastModifiedBy", "lastPrinted"},
+			appPart:  {"Company", "Manager", "HyperlinkBase"},
+		} {
+			n, err := pkg.removeElements(part, locals...)
+			if err != nil {
+				return nil, err
+			}
+			report.Removed[SanitizeMetadata] += n
+		}
+	}
+
+	for kind, n := range report.Removed {
+		if n == 0 {
+			delete(report.Removed, kind)
+		}
+	}
+	return report, nil
+}
+
+// removeElements 删除XML部件根节点下本地名为locals之一的子元素，部件不存在时返回0
+func (pkg *Package) removeElements(name string, locals ...string) (int, error) {
+	root, err := pkg.Part(name)
+	if err != nil || root == nil {
+		return 0, err
+	}
+	set := map[string]bool{}
+	for _, local := range locals {
+		set[local] = true
+	}
+	n := removeElements(root, func(node *Node) bool { return set[node.XMLName.Local] })
+	if n == 0 {
+		return 0, nil
+	}
+	return n, pkg.SetPart(name, root)
+}
+
+// removePart 删除部件及其关系部件、内容类型和指向它的关系
+func (pkg *Package) removePart(name string) error {
+	pkg.Remove(name)
+	pkg.Remove(relsPart(name))
+
+	types, err := pkg.Part(contentTypes)
+	if err != nil {
+		return err
+	}
+	if types != nil && removeElements(types, func(node *Node) bool {
+		v, _ := node.attr("PartName")
+		return node.XMLName.Local == "Override" && strings.TrimPrefix(v, "/") == name
+	}) > 0 {
+		if err := pkg.SetPart(contentTypes, types); err != nil {
+			return err
+		}
+	}
+
+	for _, rels := range pkg.Names() {
+		if !strings.HasSuffix(rels, ".rels") {
+			continue
+		}
+		source := relsSource(rels)
+		if _, err := pkg.removeRelationships(rels, func(rel *Node) bool {
+			mode, _ := rel.attr("TargetMode")
+			target, _ := rel.attr("Target")
+			return mode != "External" && resolveTarget(source, target) == name
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeRelationships 删除关系部件中满足match的关系，并清除源部件中对这些关系的引用，返回删除的Id
+func (pkg *Package) removeRelationships(rels string, match func(rel *Node) bool) ([]string, error) {
+	root, err := pkg.Part(rels)
+	if err != nil || root == nil {
+		return nil, err
+	}
+	ids := map[string]bool{}
+	removed := []string{}
+	removeElements(root, func(node *Node) bool {
+		if node.XMLName.Local != "Relationship" || !match(node) {
+			return false
+		}
+		id, _ := node.attr("Id")
+		ids[id] = true
+		removed = append(removed, id)
+		return true
+	})
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	if err := pkg.SetPart(rels, root); err != nil {
+		return nil, err
+	}
+
+	source := relsSource(rels)
+	if !strings.HasSuffix(source, ".xml") {
+		return removed, nil
+	}
+	doc, err := pkg.Part(source)
+	if err != nil || doc == nil {
+		return removed, err
+	}
+	scrubReferences(doc, ids)
+	return removed, pkg.SetPart(source, doc)
+}
+
+// scrubReferences 清除对已删除关系的引用：以r:id引用的元素删除，超链接保留文字，其他r命名空间的属性删除
+func scrubReferences(node *Node, ids map[string]bool) {
+	children := make([]*Node, 0, len(node.Children))
+	for _, child := range node.Children {
+		scrubReferences(child, ids)
+		id := ""
+		for _, a := range child.Attrs {
+			if a.Name.Space == nsRel && a.Name.Local == "id" {
+				id = a.Value
+			}
+		}
+		if ids[id] {
+			if child.XMLName.Local == "hyperlink" {
+				children = append(children, child.Children...)
+			}
+			continue
+		}
+		attrs := child.Attrs[:0]
+		for _, a := range child.Attrs {
+			if a.Name.Space != nsRel || !ids[a.Value] {
+				attrs = append(attrs, a)
+			}
+		}
+		child.Attrs = attrs
+		children = append(children, child)
+	}
+	node.Children = children
+}
+
+// replaceContentTypes 按映射替换Override中的内容类型
+func (pkg *Package) replaceContentTypes(replace map[string]string) error {
+	types, err := pkg.Part(contentTypes)
+	if err != nil || types == nil {
+		return err
+	}
+	changed := false
+	for _, node := range types.Children {
+		for i, a := range node.Attrs {
+			if to, ok := replace[a.Value]; ok && a.Name.Local == "ContentType" {
+				node.Attrs[i].Value = to
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return pkg.SetPart(contentTypes, types)
+}
+
+// relsSource 返回关系部件所属的部件，包级关系_rels/.rels返回空串
+func relsSource(rels string) string {
+	dir := path.Dir(path.Dir(rels))
+	base := strings.TrimSuffix(path.Base(rels), ".rels")
+	if dir == "." {
+		return base
+	}
+	return dir + "/" + base
+}
+
+// resolveTarget 将关系的目标解析为部件名
+func resolveTarget(source, target string) string {
+	if strings.HasPrefix(target, "/") {
+		return strings.TrimPrefix(target, "/")
+	}
+	return strings.TrimPrefix(path.Join(path.Dir(source), target), "./")
+}
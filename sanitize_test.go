@@ -0,0 +1,161 @@
+package DocTrim
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+func TestSanitizeNode(t *testing.T) {
+	src := `<w:document xmlns:w="` + nsWord + `" xmlns:r="` + nsRel + `" xmlns:v="urn:schemas-microsoft-com:vml" xmlns:o="` + nsOffice + `"><w:body>` +
+		`<w:p><w:commentRangeStart w:id="0"/><w:r><w:t>Visible</w:t></w:r><w:commentRangeEnd w:id="0"/>` +
+		`<w:r><w:rPr><w:rStyle w:val="CommentReference"/></w:rPr><w:commentReference w:id="0"/></w:r>` +
+		`<w:r><w:rPr><w:vanish/></w:rPr><w:t>secret</w:t></w:r></w:p>` +
+		`<w:p><w:pPr><w:rPr><w:vanish/></w:rPr></w:pPr><w:ins w:id="1" w:author="Alice" w:date="2024-01-01T00:00:00Z"><w:r><w:t>added</w:t></w:r></w:ins></w:p>` +
+		`<w:customXml w:element="answer"><w:customXmlPr/><w:p><w:hyperlink r:id="rId5"><w:r><w:t>link</w:t></w:r></w:hyperlink>` +
+		`<w:hyperlink w:anchor="top"><w:r><w:t>top</w:t></w:r></w:hyperlink></w:p></w:customXml>` +
+		`<w:p><w:r><w:object><v:shape id="s1"><v:imagedata r:id="rId6"/></v:shape><o:OLEObject ProgID="Equation.DSMT4" r:id="rId7"/></w:object></w:r></w:p>` +
+		`<w:sectPr/></w:body></w:document>`
+	var root Node
+	if err := xml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := SanitizeNode(&root, DefaultSanitizePolicy)
+	want := map[string]int{
+		SanitizeComments:        3,
+		SanitizeHiddenText:      2,
+		SanitizeRevisionAuthors: 1,
+		SanitizeCustomXML:       1,
+		SanitizeExternalLinks:   1,
+		SanitizeEmbeddedObjects: 1,
+	}
+	for kind, n := range want {
+		if counts[kind] != n {
+			t.Errorf("%s: got %d, want %d", kind, counts[kind], n)
+		}
+	}
+
+	data, err := xml.Marshal(&root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := string(data)
+	for _, gone := range []string{"comment", "secret", "vanish", "Alice", "customXml", "rId5", "OLEObject"} {
+		if strings.Contains(out, gone) {
+			t.Errorf("%s left in %s", gone, out)
+		}
+	}
+	for _, kept := range []string{"Visible", "added", `author="Author"`, "link", `anchor="top"`, "imagedata"} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("%s removed from %s", kept, out)
+		}
+	}
+}
+
+func TestSanitizePackage(t *testing.T) {
+	pkg, err := DocTrim{}.OpenPackage("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := SanitizePackage(pkg, DefaultSanitizePolicy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 样例中有5个公式对象、自定义XML和自定义属性，作者和最后修改者写在core.xml中
+	if report.Removed[SanitizeEmbeddedObjects] != 10 || report.Removed[SanitizeCustomXML] != 2 ||
+		report.Removed[SanitizeMetadata] != 3 || report.Removed[SanitizeAttachedTemplate] != 1 {
+		t.Errorf("got %v", report.Removed)
+	}
+
+	for _, name := range pkg.Names() {
+		if strings.HasPrefix(name, "word/embeddings/") || strings.HasPrefix(name, "customXml/") || name == "docProps/custom.xml" {
+			t.Errorf("%s not removed", name)
+		}
+	}
+	for _, name := range []string{contentTypes, "_rels/.rels", relsPart(documentPart)} {
+		data, _ := pkg.Data(name)
+		for _, gone := range []string{"embeddings/", "customXml/", "custom.xml"} {
+			if bytes.Contains(data, []byte(gone)) {
+				t.Errorf("%s still references %s", name, gone)
+			}
+		}
+	}
+	for _, name := range []string{corePart, appPart} {
+		data, _ := pkg.Data(name)
+		for _, gone := range []string{"lvliying", "John Smith", "Normal.dotm"} {
+			if bytes.Contains(data, []byte(gone)) {
+				t.Errorf("%s still contains %s", name, gone)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := pkg.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadPackage(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSanitizeKeep(t *testing.T) {
+	pkg, err := DocTrim{}.OpenPackage("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := DefaultSanitizePolicy
+	policy.EmbeddedObjects = false
+	policy.Metadata = false
+	report, err := SanitizePackage(pkg, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Removed[SanitizeEmbeddedObjects] != 0 || report.Removed[SanitizeMetadata] != 0 {
+		t.Errorf("got %v", report.Removed)
+	}
+	if _, ok := pkg.Data("word/embeddings/oleObject1.bin"); !ok {
+		t.Error("embedded object removed")
+	}
+}
+
+func TestSanitizeStyleHidden(t *testing.T) {
+	pkg, err := DocTrim{}.OpenPackage("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 字符样式和段落样式设置的隐藏，run上的w:vanish w:val="0"可以取消段落样式的隐藏
+	pkg.SetData(stylesPart, []byte(`<w:styles xmlns:w="`+nsWord+`">`+
+		`<w:style w:type="character" w:styleId="Secret"><w:rPr><w:vanish/></w:rPr></w:style>`+
+		`<w:style w:type="paragraph" w:styleId="HiddenPara"><w:rPr><w:vanish/></w:rPr></w:style></w:styles>`))
+	pkg.SetData(documentPart, []byte(`<w:document xmlns:w="`+nsWord+`"><w:body>`+
+		`<w:p><w:r><w:t>public</w:t></w:r><w:r><w:rPr><w:rStyle w:val="Secret"/></w:rPr><w:t>styled</w:t></w:r></w:p>`+
+		`<w:p><w:pPr><w:pStyle w:val="HiddenPara"/></w:pPr><w:r><w:t>para</w:t></w:r>`+
+		`<w:r><w:rPr><w:vanish w:val="0"/></w:rPr><w:t>shown</w:t></w:r></w:p></w:body></w:document>`))
+	report, err := SanitizePackage(pkg, SanitizePolicy{HiddenText: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Removed[SanitizeHiddenText] != 2 {
+		t.Errorf("got %v", report.Removed)
+	}
+	doc, _ := pkg.Part(documentPart)
+	if text := ExtractText(doc, nil).Text; text != "public\nshown\n" {
+		t.Errorf("got %q", text)
+	}
+}
+
+func TestPackSanitize(t *testing.T) {
+	src := `<w:document xmlns:w="` + nsWord + `"><w:body><w:p><w:r><w:t>shown</w:t></w:r>` +
+		`<w:r><w:rPr><w:vanish/></w:rPr><w:t>hidden</w:t></w:r></w:p></w:body></w:document>`
+	slim := &DocTrim{Sanitize: SanitizePolicy{HiddenText: true}}
+	_, report, err := slim.PackWithReport(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Omitted["sanitize:"+SanitizeHiddenText] != 1 {
+		t.Errorf("got %v", report.Omitted)
+	}
+}
@@ -0,0 +1,751 @@
+// 版本库
+// 按内容寻址保存文档的各个版本：正文部件先按Trim精简，XML部件拆成段落、表格等块级对象，
+// 每个对象以其内容(含块级子节点的键)的SHA-256为键，相同的块在所有版本和文档之间只保存一份，
+// 图片等其他部件整体保存
+// 目录结构：
+//
+//	objects.pack                对象文件，每次保存追加若干段，段由键表和deflate压缩的对象内容组成
+//	refs/<文档>/<版本>.json     版本清单，记录部件顺序和每个部件的根对象
+//
+// 同一段内的对象一起压缩，小块之间也能共享压缩上下文；打开时只读取键表
+// 样式和编号定义的块数多而小，整个部件作为一个对象保存
+// 删除版本后用GC重写对象文件，回收不再被任何版本引用的对象
+
+package DocTrim
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nbio/xml"
+)
+
+const (
+	packFile = "objects.pack"
+	// segmentSize 段中对象内容的总长度上限，读取一个对象最多解压这么多字节
+	segmentSize = 1 << 20
+	// segmentCache 缓存的已解压段数
+	segmentCache = 16
+)
+
+// Store 目录形式的版本库
+type Store struct {
+	// Trim 保存前对正文部件应用的精简选项，OpenStore设为只应用无损的DefaultStripProfile
+	Trim DocTrim
+
+	dir  string
+	mu   sync.Mutex
+	pack *os.File
+	// size 对象文件中最后一个完整段的末尾
+	size  int64
+	index map[string]packEntry
+	// pending 尚未写入的对象，Put结束时作为新段写入
+	pending      map[string][]byte
+	pendingOrder []string
+	segments     map[int64][]byte
+}
+
+// packEntry 对象所在的段及其在解压后内容中的位置
+type packEntry struct {
+	segment int64
+	clen    uint32
+	offset  uint32
+	length  uint32
+}
+
+// storedNode 节点对象，块级子节点以键引用，其他子节点内联
+// 已知的命名空间记为前缀
+type storedNode struct {
+	Space    string        `json:"s,omitempty"`
+	Local    string        `json:"l,omitempty"`
+	Attrs    [][3]string   `json:"a,omitempty"`
+	Content  string        `json:"c,omitempty"`
+	Children []*storedNode `json:"k,omitempty"`
+	// Ref 块级子节点的对象键
+	Ref string `json:"r,omitempty"`
+}
+
+// storedPart 清单中的部件，Tree为true时Key指向根节点对象，否则指向部件内容
+type storedPart struct {
+	Name string `json:"name"`
+	Tree bool   `json:"tree,omitempty"`
+	Key  string `json:"key"`
+}
+
+// manifest 版本清单
+type manifest struct {
+	Parts []storedPart `json:"parts"`
+}
+
+// blockElements 单独保存为对象的元素，版本之间和部件之间相同的块只保存一份
+var blockElements = map[string]bool{
+	"p": true, "tbl": true, "footnote": true, "endnote": true, "comment": true,
+}
+
+// OpenStore 打开版本库，目录不存在时创建
+// 对象文件末尾不完整的段(写入中断)会被截掉
+func OpenStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "refs"), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, packFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	st := &Store{Trim: DocTrim{StripRules: DefaultStripProfile}, dir: dir, pack: f}
+	if err := st.loadIndex(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return st, nil
+}
+
+// Close 关闭对象文件
+func (st *Store) Close() error {
+	return st.pack.Close()
+}
+
+// loadIndex 读取各段的键表建立索引，不解压内容
+func (st *Store) loadIndex() error {
+	info, err := st.pack.Stat()
+	if err != nil {
+		return err
+	}
+	st.index = map[string]packEntry{}
+	st.pending = map[string][]byte{}
+	st.pendingOrder = nil
+	st.segments = map[int64][]byte{}
+	offset := int64(0)
+	for {
+		next, ok, err := st.readSegmentIndex(offset, info.Size())
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		offset = next
+	}
+	st.size = offset
+	if offset < info.Size() {
+		return st.pack.Truncate(offset)
+	}
+	return nil
+}
+
+// readSegmentIndex 读取offset处的段的键表，段不完整时返回false
+func (st *Store) readSegmentIndex(offset, size int64) (int64, bool, error) {
+	buf := make([]byte, 4)
+	if offset+4 > size {
+		return 0, false, nil
+	}
+	if _, err := st.pack.ReadAt(buf, offset); err != nil {
+		return 0, false, err
+	}
+	count := int64(binary.BigEndian.Uint32(buf))
+	if count == 0 {
+		return 0, false, nil
+	}
+	tableSize := count * segmentEntrySize
+	if offset+4+tableSize+4 > size {
+		return 0, false, nil
+	}
+	table := make([]byte, tableSize+4)
+	if _, err := st.pack.ReadAt(table, offset+4); err != nil {
+		return 0, false, err
+	}
+	clen := binary.BigEndian.Uint32(table[tableSize:])
+	body := offset + 4 + tableSize + 4
+	if body+int64(clen) > size {
+		return 0, false, nil
+	}
+	for i := int64(0); i < count; i++ {
+		e := table[i*segmentEntrySize:]
+		st.index[hex.EncodeToString(e[:sha256.Size])] = packEntry{
+			segment: body,
+			clen:    clen,
+			offset:  binary.BigEndian.Uint32(e[sha256.Size:]),
+			length:  binary.BigEndian.Uint32(e[sha256.Size+4:]),
+		}
+	}
+	return body + int64(clen), true, nil
+}
+
+// segmentEntrySize 键表中每项的长度：键、偏移和长度
+const segmentEntrySize = sha256.Size + 4 + 4
+
+// writeSegments 将对象按顺序写成若干段：对象数、键表、压缩后长度和deflate压缩的内容
+func (st *Store) writeSegments(w io.WriterAt, offset int64, keys []string, data func(key string) []byte) (int64, error) {
+	for len(keys) > 0 {
+		n, total := 0, 0
+		for n < len(keys) && (n == 0 || total+len(data(keys[n])) <= segmentSize) {
+			total += len(data(keys[n]))
+			n++
+		}
+
+		var body bytes.Buffer
+		zw, _ := flate.NewWriter(&body, flate.BestCompression)
+		table := make([]byte, 4, 4+n*segmentEntrySize+4)
+		binary.BigEndian.PutUint32(table, uint32(n))
+		pos := 0
+		for _, key := range keys[:n] {
+			d := data(key)
+			raw, _ := hex.DecodeString(key)
+			table = append(table, raw...)
+			table = binary.BigEndian.AppendUint32(table, uint32(pos))
+			table = binary.BigEndian.AppendUint32(table, uint32(len(d)))
+			zw.Write(d)
+			pos += len(d)
+		}
+		if err := zw.Close(); err != nil {
+			return offset, err
+		}
+		table = binary.BigEndian.AppendUint32(table, uint32(body.Len()))
+		if _, err := w.WriteAt(append(table, body.Bytes()...), offset); err != nil {
+			return offset, err
+		}
+		offset += int64(len(table) + body.Len())
+		keys = keys[n:]
+	}
+	return offset, nil
+}
+
+// checkName 文档名和版本名不能为空，也不能包含路径
+func checkName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return errors.New("invalid name: " + name)
+	}
+	return nil
+}
+
+func (st *Store) refPath(doc, version string) string {
+	return filepath.Join(st.dir, "refs", doc, version+".json")
+}
+
+// putObject 记录对象并返回键，对象已存在时不重复保存，flush之后写入对象文件
+func (st *Store) putObject(data []byte) string {
+	sum := sha256.Sum256(data)
+	key := hex.EncodeToString(sum[:])
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if _, ok := st.index[key]; ok {
+		return key
+	}
+	if _, ok := st.pending[key]; !ok {
+		st.pending[key] = data
+		st.pendingOrder = append(st.pendingOrder, key)
+	}
+	return key
+}
+
+// flush 将尚未写入的对象作为新段追加到对象文件并落盘
+func (st *Store) flush() error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.pendingOrder) == 0 {
+		return nil
+	}
+	start := st.size
+	end, err := st.writeSegments(st.pack, start, st.pendingOrder, func(key string) []byte { return st.pending[key] })
+	if err == nil {
+		err = st.pack.Sync()
+	}
+	if err != nil {
+		// 丢弃写了一半的段
+		st.pack.Truncate(start)
+		return err
+	}
+	info, err := st.pack.Stat()
+	if err != nil {
+		return err
+	}
+	for offset := start; offset < end; {
+		next, _, err := st.readSegmentIndex(offset, info.Size())
+		if err != nil {
+			return err
+		}
+		offset = next
+	}
+	st.size = end
+	st.pending = map[string][]byte{}
+	st.pendingOrder = nil
+	return nil
+}
+
+// readObject 读取对象内容，解压后的段会被缓存
+func (st *Store) readObject(key string) ([]byte, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if data, ok := st.pending[key]; ok {
+		return data, nil
+	}
+	e, ok := st.index[key]
+	if !ok {
+		return nil, errors.New("object not found: " + key)
+	}
+	seg, ok := st.segments[e.segment]
+	if !ok {
+		compressed := make([]byte, e.clen)
+		if _, err := st.pack.ReadAt(compressed, e.segment); err != nil {
+			return nil, err
+		}
+		var err error
+		if seg, err = io.ReadAll(flate.NewReader(bytes.NewReader(compressed))); err != nil {
+			return nil, err
+		}
+		if len(st.segments) >= segmentCache {
+			st.segments = map[int64][]byte{}
+		}
+		st.segments[e.segment] = seg
+	}
+	if int(e.offset)+int(e.length) > len(seg) {
+		return nil, errors.New("corrupted object: " + key)
+	}
+	return seg[e.offset : e.offset+e.length], nil
+}
+
+// spaceKey 返回命名空间的存储形式，已知命名空间记为前缀
+func spaceKey(space string) string {
+	if prefix, ok := nsPrefixes[space]; ok {
+		return prefix
+	}
+	return space
+}
+
+// spaceName 将存储形式还原为命名空间，前缀不含冒号和斜线，与URI不会混淆
+func spaceName(key string) string {
+	if space, ok := prefixSpaces[key]; ok {
+		return space
+	}
+	return key
+}
+
+// prefixSpaces 前缀到命名空间
+var prefixSpaces = func() map[string]string {
+	m := map[string]string{}
+	for space, prefix := range nsPrefixes {
+		m[prefix] = space
+	}
+	return m
+}()
+
+// PutNode 保存子树，返回根对象的键
+func (st *Store) PutNode(node *Node) (string, error) {
+	key, err := st.putNode(node)
+	if err != nil {
+		return "", err
+	}
+	return key, st.flush()
+}
+
+// putNode 记录子树的对象，不写入对象文件
+func (st *Store) putNode(node *Node) (string, error) {
+	obj, err := st.encodeNode(node)
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return st.putObject(data), nil
+}
+
+// encodeNode 转换为节点对象，块级子节点单独保存
+func (st *Store) encodeNode(node *Node) (*storedNode, error) {
+	obj := &storedNode{Space: spaceKey(node.XMLName.Space), Local: node.XMLName.Local, Content: string(node.Content)}
+	for _, a := range node.Attrs {
+		obj.Attrs = append(obj.Attrs, [3]string{spaceKey(a.Name.Space), a.Name.Local, a.Value})
+	}
+	for _, child := range node.Children {
+		if child.XMLName.Space == nsWord && blockElements[child.XMLName.Local] {
+			key, err := st.putNode(child)
+			if err != nil {
+				return nil, err
+			}
+			obj.Children = append(obj.Children, &storedNode{Ref: key})
+			continue
+		}
+		c, err := st.encodeNode(child)
+		if err != nil {
+			return nil, err
+		}
+		obj.Children = append(obj.Children, c)
+	}
+	return obj, nil
+}
+
+// GetNode 根据键重建子树，同一版本中相同的块共享节点
+func (st *Store) GetNode(key string) (*Node, error) {
+	return st.getNode(key, map[string]*Node{})
+}
+
+func (st *Store) getNode(key string, cache map[string]*Node) (*Node, error) {
+	if node, ok := cache[key]; ok {
+		return node, nil
+	}
+	obj, err := st.readNode(key)
+	if err != nil {
+		return nil, err
+	}
+	node, err := st.decodeNode(obj, cache)
+	if err != nil {
+		return nil, err
+	}
+	cache[key] = node
+	return node, nil
+}
+
+func (st *Store) decodeNode(obj *storedNode, cache map[string]*Node) (*Node, error) {
+	if obj.Ref != "" {
+		return st.getNode(obj.Ref, cache)
+	}
+	node := &Node{
+		XMLName:  xml.Name{Space: spaceName(obj.Space), Local: obj.Local},
+		Attrs:    make([]xml.Attr, len(obj.Attrs)),
+		Content:  []byte(obj.Content),
+		Children: make([]*Node, len(obj.Children)),
+	}
+	for i, a := range obj.Attrs {
+		node.Attrs[i] = xml.Attr{Name: xml.Name{Space: spaceName(a[0]), Local: a[1]}, Value: a[2]}
+	}
+	for i, child := range obj.Children {
+		var err error
+		if node.Children[i], err = st.decodeNode(child, cache); err != nil {
+			return nil, err
+		}
+	}
+	return node, nil
+}
+
+func (st *Store) readNode(key string) (*storedNode, error) {
+	data, err := st.readObject(key)
+	if err != nil {
+		return nil, err
+	}
+	var obj storedNode
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+// Put 保存文档的一个版本，同名版本已存在时覆盖
+// 正文部件按Trim精简后保存，XML部件按块保存，解析失败的部件和其他部件整体保存
+func (st *Store) Put(doc, version string, pkg *Package) error {
+	if err := checkName(doc); err != nil {
+		return err
+	}
+	if err := checkName(version); err != nil {
+		return err
+	}
+	trim := st.Trim
+	if trim.needsStyles() {
+		styles, err := pkg.Styles()
+		if err != nil {
+			return err
+		}
+		trim.Styles = styles
+	}
+	content := map[string]bool{}
+	for _, name := range pkg.ContentParts() {
+		content[name] = true
+	}
+
+	m := manifest{}
+	for _, name := range pkg.Names() {
+		data, _ := pkg.Data(name)
+		part := storedPart{Name: name}
+		var err error
+		if root, perr := parseXmlPart(name, data); perr == nil && root != nil {
+			if content[name] {
+				if err := trim.trimNode(root, nil); err != nil {
+					return err
+				}
+			}
+			part.Tree = true
+			part.Key, err = st.putNode(root)
+		} else {
+			part.Key = st.putObject(data)
+		}
+		if err != nil {
+			return err
+		}
+		m.Parts = append(m.Parts, part)
+	}
+	// 清单只引用已落盘的对象
+	if err := st.flush(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(st.refPath(doc, version), data)
+}
+
+// writeFileAtomic 先写临时文件再改名，中断时不会留下不完整的文件
+func writeFileAtomic(name string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(name), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// parseXmlPart 解析.xml和.rels部件，其他部件返回nil
+func parseXmlPart(name string, data []byte) (*Node, error) {
+	if !strings.HasSuffix(name, ".xml") && !strings.HasSuffix(name, ".rels") {
+		return nil, nil
+	}
+	var root Node
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&root); err != nil {
+		return nil, err
+	}
+	return &root, nil
+}
+
+// Get 重建文档的一个版本
+func (st *Store) Get(doc, version string) (*Package, error) {
+	m, err := st.readManifest(doc, version)
+	if err != nil {
+		return nil, err
+	}
+	pkg := &Package{parts: map[string][]byte{}}
+	cache := map[string]*Node{}
+	for _, part := range m.Parts {
+		if !part.Tree {
+			data, err := st.readObject(part.Key)
+			if err != nil {
+				return nil, err
+			}
+			pkg.SetData(part.Name, data)
+			continue
+		}
+		root, err := st.getNode(part.Key, cache)
+		if err != nil {
+			return nil, err
+		}
+		if err := pkg.SetPart(part.Name, root); err != nil {
+			return nil, err
+		}
+	}
+	return pkg, nil
+}
+
+func (st *Store) readManifest(doc, version string) (*manifest, error) {
+	if err := checkName(doc); err != nil {
+		return nil, err
+	}
+	if err := checkName(version); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(st.refPath(doc, version))
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Documents 返回版本库中的文档名
+func (st *Store) Documents() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(st.dir, "refs"))
+	if err != nil {
+		return nil, err
+	}
+	docs := []string{}
+	for _, e := range entries {
+		if e.IsDir() {
+			docs = append(docs, e.Name())
+		}
+	}
+	return docs, nil
+}
+
+// Versions 返回文档的所有版本名，按名字排序
+func (st *Store) Versions(doc string) ([]string, error) {
+	if err := checkName(doc); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(st.dir, "refs", doc))
+	if err != nil {
+		return nil, err
+	}
+	versions := []string{}
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".json"); ok && !e.IsDir() {
+			versions = append(versions, name)
+		}
+	}
+	sort.Strings(versions)
+	return versions, nil
+}
+
+// Delete 删除文档的一个版本，对象在GC时回收
+func (st *Store) Delete(doc, version string) error {
+	if err := checkName(doc); err != nil {
+		return err
+	}
+	if err := checkName(version); err != nil {
+		return err
+	}
+	if err := os.Remove(st.refPath(doc, version)); err != nil {
+		return err
+	}
+	// 文档没有版本时删除其目录，忽略目录非空的错误
+	os.Remove(filepath.Join(st.dir, "refs", doc))
+	return nil
+}
+
+// GC 将仍被版本引用的对象写入新的对象文件并替换旧文件，返回删除的对象数
+func (st *Store) GC() (int, error) {
+	live := map[string]bool{}
+	var mark func(obj *storedNode) error
+	mark = func(obj *storedNode) error {
+		if obj.Ref != "" {
+			if live[obj.Ref] {
+				return nil
+			}
+			live[obj.Ref] = true
+			child, err := st.readNode(obj.Ref)
+			if err != nil {
+				return err
+			}
+			return mark(child)
+		}
+		for _, child := range obj.Children {
+			if err := mark(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	docs, err := st.Documents()
+	if err != nil {
+		return 0, err
+	}
+	for _, doc := range docs {
+		versions, err := st.Versions(doc)
+		if err != nil {
+			return 0, err
+		}
+		for _, version := range versions {
+			m, err := st.readManifest(doc, version)
+			if err != nil {
+				return 0, err
+			}
+			for _, part := range m.Parts {
+				if !part.Tree {
+					live[part.Key] = true
+				} else if err := mark(&storedNode{Ref: part.Key}); err != nil {
+					return 0, err
+				}
+			}
+		}
+	}
+
+	removed := len(st.index) - len(live)
+	if removed == 0 {
+		return 0, nil
+	}
+	// 仍被引用的对象按原顺序重新分段写入新文件
+	keys := make([]string, 0, len(live))
+	for key := range live {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := st.index[keys[i]], st.index[keys[j]]
+		return a.segment < b.segment || a.segment == b.segment && a.offset < b.offset
+	})
+	objects := map[string][]byte{}
+	for _, key := range keys {
+		data, err := st.readObject(key)
+		if err != nil {
+			return 0, err
+		}
+		objects[key] = data
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	name := filepath.Join(st.dir, packFile)
+	tmp, err := os.CreateTemp(st.dir, ".pack-*")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := st.writeSegments(tmp, 0, keys, func(key string) []byte { return objects[key] }); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := st.pack.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return 0, err
+	}
+	if st.pack, err = os.OpenFile(name, os.O_RDWR, 0644); err != nil {
+		return 0, err
+	}
+	return removed, st.loadIndex()
+}
+
+// Count 返回版本库中的对象数
+func (st *Store) Count() (int, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return len(st.index), nil
+}
+
+// Size 返回版本库在磁盘上的字节数，包括对象文件和版本清单
+func (st *Store) Size() (int64, error) {
+	var n int64
+	err := filepath.WalkDir(st.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err == nil {
+			n += info.Size()
+		}
+		return err
+	})
+	return n, err
+}
@@ -0,0 +1,135 @@
+package DocTrim
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	st, err := OpenStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	v1, err := DocTrim{}.OpenPackage("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2 := v1.Clone()
+	if _, err := ReplacePackage(v2, "方程", "等式", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.Put("contract", "v1", v1); err != nil {
+		t.Fatal(err)
+	}
+	n1, _ := st.Count()
+	if err := st.Put("contract", "v2", v2); err != nil {
+		t.Fatal(err)
+	}
+	n2, _ := st.Count()
+	// 第二个版本只新增修改路径上的对象
+	if n2-n1 <= 0 || n2-n1 > n1/10 {
+		t.Errorf("v1 stored %d objects, v2 added %d", n1, n2-n1)
+	}
+
+	if versions, _ := st.Versions("contract"); len(versions) != 2 || versions[0] != "v1" {
+		t.Errorf("got versions %v", versions)
+	}
+	for _, c := range []struct {
+		version string
+		pkg     *Package
+	}{{"v1", v1}, {"v2", v2}} {
+		got, err := st.Get("contract", c.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Names()) != len(c.pkg.Names()) {
+			t.Errorf("%s: got %d parts", c.version, len(got.Names()))
+		}
+		// 正文按缺省的无损规则精简后保存
+		want, _ := c.pkg.Part(documentPart)
+		StripNoise(want, DefaultStripProfile)
+		wantData, _ := want.Marshal()
+		data, _ := got.Data(documentPart)
+		if !EqualXml(wantData, data) {
+			t.Errorf("%s: document.xml differs", c.version)
+		}
+		media, _ := got.Data("word/media/image1.wmf")
+		orig, _ := c.pkg.Data("word/media/image1.wmf")
+		if string(media) != string(orig) {
+			t.Errorf("%s: media part differs", c.version)
+		}
+	}
+
+	if err := st.Delete("contract", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := st.GC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != n2-n1 {
+		t.Errorf("gc removed %d objects, want %d", removed, n2-n1)
+	}
+	if _, err := st.Get("contract", "v2"); err != nil {
+		t.Errorf("v2 should survive gc: %v", err)
+	}
+
+	if err := st.Put("../x", "v1", v1); err == nil {
+		t.Error("path in document name should be rejected")
+	}
+}
+
+func TestStoreSize(t *testing.T) {
+	dir := t.TempDir()
+	st, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg, err := DocTrim{}.OpenPackage("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Put("exam", "v1", pkg); err != nil {
+		t.Fatal(err)
+	}
+	size, _ := st.Size()
+	// 一个版本占用的空间不超过docx本身
+	if size > info.Size() {
+		t.Errorf("store uses %d bytes for a %d byte docx", size, info.Size())
+	}
+
+	// 相同内容的第二个文档不新增对象
+	n, _ := st.Count()
+	if err := st.Put("copy", "v1", pkg); err != nil {
+		t.Fatal(err)
+	}
+	if m, _ := st.Count(); m != n {
+		t.Errorf("identical document added %d objects", m-n)
+	}
+
+	// 重新打开后可以读取，截断的记录被丢弃
+	st.Close()
+	f, err := os.OpenFile(filepath.Join(dir, packFile), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(make([]byte, 10))
+	f.Close()
+	if st, err = OpenStore(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+	if m, _ := st.Count(); m != n {
+		t.Errorf("reopened store has %d objects, want %d", m, n)
+	}
+	if _, err := st.Get("exam", "v1"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,207 @@
+// 清理编辑噪声
+// rsid、校对标记、空书签等不影响显示的内容在ComputeHash之前删除
+// 删除后更多子树变得相同，去重效果更好
+
+package DocTrim
+
+import (
+	"strings"
+
+	"github.com/nbio/xml"
+)
+
+// StripRule 一条清理规则
+type StripRule struct {
+	// Name 规则名称，用于统计
+	Name string
+	// Lossless 为true表示删除后文档的显示效果不变
+	Lossless bool
+
+	apply func(root *Node) int
+}
+
+// ElementRule 删除本地名为locals之一的元素
+func ElementRule(name string, lossless bool, locals ...string) StripRule {
+	set := map[string]bool{}
+	for _, local := range locals {
+		set[local] = true
+	}
+	return StripRule{Name: name, Lossless: lossless, apply: func(root *Node) int {
+		return removeElements(root, func(node *Node) bool {
+			return set[node.XMLName.Local]
+		})
+	}}
+}
+
+// AttrRule 删除本地名以prefixes之一开头的属性
+func AttrRule(name string, lossless bool, prefixes ...string) StripRule {
+	return StripRule{Name: name, Lossless: lossless, apply: func(root *Node) int {
+		return removeAttrs(root, prefixes)
+	}}
+}
+
+var (
+	// RsidRule 删除w:rsidR、w:rsidRPr等修订会话标识
+	RsidRule = AttrRule("rsid", true, "rsid")
+	// ParaIdRule 删除w14:paraId、w14:textId
+	ParaIdRule = AttrRule("paraId", true, "paraId", "textId")
+	// ProofErrRule 删除拼写和语法检查标记w:proofErr
+	ProofErrRule = ElementRule("proofErr", true, "proofErr")
+	// RenderedBreakRule 删除Word缓存的分页位置w:lastRenderedPageBreak
+	RenderedBreakRule = ElementRule("lastRenderedPageBreak", true, "lastRenderedPageBreak")
+	// NoProofRule 删除w:noProof，只影响拼写检查的波浪线
+	NoProofRule = ElementRule("noProof", true, "noProof")
+	// EmptyBookmarkRule 删除未包含内容且没有被域或超链接引用的书签，以及_GoBack书签
+	EmptyBookmarkRule = StripRule{Name: "emptyBookmark", Lossless: true, apply: removeEmptyBookmarks}
+	// LangRule 删除w:lang，东亚文字的字体选择可能随之改变，不在缺省规则中
+	LangRule = ElementRule("lang", false, "lang")
+)
+
+// DefaultStripProfile 缺省的清理规则，均不影响显示效果
+var DefaultStripProfile = []StripRule{
+	RsidRule,
+	ParaIdRule,
+	ProofErrRule,
+	RenderedBreakRule,
+	NoProofRule,
+	EmptyBookmarkRule,
+}
+
+// StripNoise 按规则清理子树，返回每条规则删除的元素或属性数
+func StripNoise(root *Node, rules []StripRule) map[string]int {
+	removed := map[string]int{}
+	for _, rule := range rules {
+		removed[rule.Name] += rule.apply(root)
+	}
+	root.clearDigests()
+	return removed
+}
+
+// removeElements 删除满足match的元素及其子树
+func removeElements(node *Node, match func(node *Node) bool) int {
+	removed := 0
+	children := make([]*Node, 0, len(node.Children))
+	for _, child := range node.Children {
+		if match(child) {
+			removed++
+			continue
+		}
+		removed += removeElements(child, match)
+		children = append(children, child)
+	}
+	node.Children = children
+	return removed
+}
+
+func removeAttrs(node *Node, prefixes []string) int {
+	removed := 0
+	attrs := make([]xml.Attr, 0, len(node.Attrs))
+	for _, a := range node.Attrs {
+		if hasAnyPrefix(a.Name.Local, prefixes) {
+			removed++
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	node.Attrs = attrs
+	for _, child := range node.Children {
+		removed += removeAttrs(child, prefixes)
+	}
+	return removed
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeEmptyBookmarks 删除紧邻的w:bookmarkStart/w:bookmarkEnd对和_GoBack书签
+// 被REF、PAGEREF等域或文档内超链接引用的书签保留
+func removeEmptyBookmarks(root *Node) int {
+	instr := fieldInstructions(root)
+	anchors := anchorNames(root)
+	ids := map[string]bool{}
+
+	var find func(node *Node)
+	find = func(node *Node) {
+		for i, child := range node.Children {
+			if child.XMLName.Local != "bookmarkStart" {
+				find(child)
+				continue
+			}
+			id, _ := child.attr("id")
+			name, _ := child.attr("name")
+			if name != "_GoBack" && (anchors[name] || strings.Contains(instr, name)) {
+				continue
+			}
+			if name == "_GoBack" || (i+1 < len(node.Children) && node.Children[i+1].XMLName.Local == "bookmarkEnd" && attrEquals(node.Children[i+1], "id", id)) {
+				ids[id] = true
+			}
+		}
+	}
+	find(root)
+	if len(ids) == 0 {
+		return 0
+	}
+
+	return removeElements(root, func(node *Node) bool {
+		if node.XMLName.Local != "bookmarkStart" && node.XMLName.Local != "bookmarkEnd" {
+			return false
+		}
+		id, _ := node.attr("id")
+		return ids[id]
+	})
+}
+
+// fieldInstructions 拼接子树中所有域代码，用于判断书签是否被引用
+func fieldInstructions(root *Node) string {
+	var b strings.Builder
+	var walk func(node *Node)
+	walk = func(node *Node) {
+		switch node.XMLName.Local {
+		case "instrText":
+			b.Write(node.Content)
+		case "fldSimple":
+			instr, _ := node.attr("instr")
+			b.WriteString(instr)
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+	return b.String()
+}
+
+// anchorNames 返回子树中超链接等指向的书签名：w:hyperlink的w:anchor和w:docLocation，
+// 以及VML、DrawingML中以#开头的href
+func anchorNames(root *Node) map[string]bool {
+	names := map[string]bool{}
+	var walk func(node *Node)
+	walk = func(node *Node) {
+		for _, a := range node.Attrs {
+			switch a.Name.Local {
+			case "anchor", "docLocation":
+				names[a.Value] = true
+			case "href":
+				if name, ok := strings.CutPrefix(a.Value, "#"); ok {
+					names[name] = true
+				}
+			}
+		}
+		for _, child := range node.Children {
+			walk(child)
+		}
+	}
+	walk(root)
+	return names
+}
+
+func attrEquals(node *Node, local, value string) bool {
+	v, ok := node.attr(local)
+	return ok && v == value
+}
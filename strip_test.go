@@ -0,0 +1,95 @@
+package DocTrim
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+func TestStripNoise(t *testing.T) {
+	src := `<w:body xmlns:w="` + nsWord + `" xmlns:w14="http://schemas.microsoft.com/office/word/2010/wordml">` +
+		`<w:p w:rsidR="00A1" w:rsidRDefault="00A1" w14:paraId="1A2B" w14:textId="77777777">` +
+		`<w:bookmarkStart w:id="0" w:name="_GoBack"/>` +
+		`<w:r w:rsidR="00A2"><w:rPr><w:noProof/></w:rPr><w:t>Hel</w:t></w:r>` +
+		`<w:proofErr w:type="spellStart"/>` +
+		`<w:r w:rsidR="00A3"><w:rPr><w:noProof/></w:rPr><w:lastRenderedPageBreak/><w:t>lo</w:t></w:r>` +
+		`<w:proofErr w:type="spellEnd"/>` +
+		`<w:bookmarkEnd w:id="0"/>` +
+		`<w:bookmarkStart w:id="1" w:name="empty"/><w:bookmarkEnd w:id="1"/>` +
+		`<w:bookmarkStart w:id="2" w:name="target"/><w:bookmarkEnd w:id="2"/>` +
+		`<w:r><w:instrText> REF target \h </w:instrText></w:r>` +
+		`</w:p></w:body>`
+	var root Node
+	if err := xml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatal(err)
+	}
+
+	removed := StripNoise(&root, DefaultStripProfile)
+	want := map[string]int{
+		"rsid":                  4,
+		"paraId":                2,
+		"proofErr":              2,
+		"lastRenderedPageBreak": 1,
+		"noProof":               2,
+		"emptyBookmark":         4,
+	}
+	for name, n := range want {
+		if removed[name] != n {
+			t.Errorf("%s: removed %d, want %d", name, removed[name], n)
+		}
+	}
+
+	p := root.Children[0]
+	if len(p.Attrs) != 0 {
+		t.Errorf("paragraph attributes left: %v", p.Attrs)
+	}
+	if start := p.child("bookmarkStart"); start == nil || !attrEquals(start, "name", "target") {
+		t.Error("referenced bookmark removed")
+	}
+
+	// 清理后两个run格式相同，可以合并
+	s := DocTrim{}
+	if merged := s.MergeRuns(&root); merged != 1 {
+		t.Errorf("merged %d runs, want 1", merged)
+	}
+}
+
+func TestStripHyperlinkBookmark(t *testing.T) {
+	src := `<w:body xmlns:w="` + nsWord + `"><w:p><w:bookmarkStart w:id="0" w:name="target"/><w:bookmarkEnd w:id="0"/>` +
+		`<w:bookmarkStart w:id="1" w:name="shape"/><w:bookmarkEnd w:id="1"/><w:r><w:t>Heading</w:t></w:r></w:p>` +
+		`<w:p><w:hyperlink w:anchor="target"><w:r><w:t>see above</w:t></w:r></w:hyperlink></w:p>` +
+		`<w:p><w:r><w:pict><v:shape xmlns:v="urn:schemas-microsoft-com:vml" href="#shape"/></w:pict></w:r></w:p></w:body>`
+	var root Node
+	if err := xml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatal(err)
+	}
+	if removed := StripNoise(&root, []StripRule{EmptyBookmarkRule}); removed["emptyBookmark"] != 0 {
+		t.Errorf("removed %d bookmarks referenced by links", removed["emptyBookmark"])
+	}
+}
+
+func TestPackStrip(t *testing.T) {
+	data, err := os.ReadFile("docs/document.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := (&DocTrim{}).Pack(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := DocTrim{StripRules: DefaultStripProfile}
+	stripped, err := s.Pack(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Printf("docs/document.xml %d -> %d (strip)", len(plain), len(stripped))
+	if len(stripped) >= len(plain) {
+		t.Errorf("strip did not shrink output: %d >= %d", len(stripped), len(plain))
+	}
+	if bytes.Contains(stripped, []byte("_GoBack")) {
+		t.Error("_GoBack bookmark left")
+	}
+}
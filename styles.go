@@ -0,0 +1,456 @@
+// 样式继承展开
+// run的实际格式由styles.xml中的docDefaults、段落样式、字符样式及其basedOn链、
+// numbering.xml中的编号级别以及直接格式w:pPr/w:rPr依次叠加得到
+// Styles计算每个段落和run的有效属性，也可以删除与继承结果相同的直接格式
+// 表格样式和条件格式暂不处理
+
+package DocTrim
+
+import (
+	"io"
+	"strconv"
+
+	"github.com/nbio/xml"
+)
+
+// Styles 解析后的样式表和编号定义
+type Styles struct {
+	docPPr *Node
+	docRPr *Node
+	styles map[string]*style
+	// 各类型的缺省样式，按w:type索引
+	defaults map[string]string
+	// numId -> ilvl -> 编号级别
+	numbering map[string]map[string]*numLevel
+
+	pPrCache map[string]*Node
+	rPrCache map[string]*Node
+}
+
+// numLevel 编号级别的定义
+type numLevel struct {
+	pPr    *Node
+	format string
+	text   string
+	start  int
+}
+
+type style struct {
+	kind    string
+	basedOn string
+	pPr     *Node
+	rPr     *Node
+}
+
+// toggleProps 开关属性，段落样式与字符样式同时设置时取异或
+var toggleProps = map[string]bool{
+	"b": true, "bCs": true, "i": true, "iCs": true, "caps": true, "smallCaps": true,
+	"strike": true, "dstrike": true, "outline": true, "shadow": true, "emboss": true,
+	"imprint": true, "vanish": true,
+}
+
+// attrMergedProps 按属性叠加的元素，其余元素整体替换
+var attrMergedProps = map[string]bool{
+	"rFonts": true, "spacing": true, "ind": true, "lang": true,
+}
+
+// skippedProps 不参与叠加的子元素
+var skippedProps = map[string]bool{
+	"pStyle": true, "rStyle": true, "rPr": true, "sectPr": true,
+	"pPrChange": true, "rPrChange": true,
+}
+
+// ParseStyles 解析styles.xml
+func ParseStyles(r io.Reader) (*Styles, error) {
+	var root Node
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return nil, err
+	}
+	return newStyles(&root), nil
+}
+
+// newStyles 从styles.xml的根节点建立样式表
+func newStyles(root *Node) *Styles {
+	st := &Styles{
+		styles:    map[string]*style{},
+		defaults:  map[string]string{},
+		numbering: map[string]map[string]*numLevel{},
+		pPrCache:  map[string]*Node{},
+		rPrCache:  map[string]*Node{},
+	}
+	if defaults := root.child("docDefaults"); defaults != nil {
+		if d := defaults.child("pPrDefault"); d != nil {
+			st.docPPr = d.child("pPr")
+		}
+		if d := defaults.child("rPrDefault"); d != nil {
+			st.docRPr = d.child("rPr")
+		}
+	}
+	for _, node := range root.Children {
+		if node.XMLName.Local != "style" {
+			continue
+		}
+		id, _ := node.attr("styleId")
+		kind, _ := node.attr("type")
+		s := &style{kind: kind, pPr: node.child("pPr"), rPr: node.child("rPr")}
+		if based := node.child("basedOn"); based != nil {
+			s.basedOn, _ = based.attr("val")
+		}
+		st.styles[id] = s
+		if def, _ := node.attr("default"); def == "1" || def == "true" {
+			st.defaults[kind] = id
+		}
+	}
+	return st
+}
+
+// LoadNumbering 解析numbering.xml，编号级别的段落属性位于段落样式和直接格式之间
+func (st *Styles) LoadNumbering(r io.Reader) error {
+	var root Node
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		return err
+	}
+	abstracts := map[string]map[string]*numLevel{}
+	for _, node := range root.Children {
+		if node.XMLName.Local != "abstractNum" {
+			continue
+		}
+		id, _ := node.attr("abstractNumId")
+		abstracts[id] = map[string]*numLevel{}
+		for _, lvl := range node.Children {
+			if lvl.XMLName.Local == "lvl" {
+				ilvl, _ := lvl.attr("ilvl")
+				abstracts[id][ilvl] = newNumLevel(lvl)
+			}
+		}
+	}
+	for _, node := range root.Children {
+		if node.XMLName.Local != "num" {
+			continue
+		}
+		id, _ := node.attr("numId")
+		levels := map[string]*numLevel{}
+		if abstract := node.child("abstractNumId"); abstract != nil {
+			ref, _ := abstract.attr("val")
+			for ilvl, level := range abstracts[ref] {
+				levels[ilvl] = level
+			}
+		}
+		for _, override := range node.Children {
+			if override.XMLName.Local != "lvlOverride" {
+				continue
+			}
+			ilvl, _ := override.attr("ilvl")
+			if lvl := override.child("lvl"); lvl != nil {
+				levels[ilvl] = newNumLevel(lvl)
+			}
+			if start := override.child("startOverride"); start != nil && levels[ilvl] != nil {
+				level := *levels[ilvl]
+				val, _ := start.attr("val")
+				level.start, _ = strconv.Atoi(val)
+				levels[ilvl] = &level
+			}
+		}
+		st.numbering[id] = levels
+	}
+	return nil
+}
+
+// newNumLevel 解析w:lvl
+func newNumLevel(lvl *Node) *numLevel {
+	level := &numLevel{pPr: lvl.child("pPr"), format: "decimal", start: 1}
+	if n := lvl.child("numFmt"); n != nil {
+		level.format, _ = n.attr("val")
+	}
+	if n := lvl.child("lvlText"); n != nil {
+		level.text, _ = n.attr("val")
+	}
+	if n := lvl.child("start"); n != nil {
+		val, _ := n.attr("val")
+		level.start, _ = strconv.Atoi(val)
+	}
+	return level
+}
+
+// mergeProps 将over叠加到base上，返回新的属性节点，不修改参数
+// 返回的节点与样式表共享子节点，调用者不应修改
+func mergeProps(base, over *Node) *Node {
+	if over == nil {
+		return base
+	}
+	out := &Node{XMLName: over.XMLName, Attrs: []xml.Attr{}}
+	if base != nil {
+		out.XMLName = base.XMLName
+		out.Children = append(out.Children, base.Children...)
+	}
+	for _, c := range over.Children {
+		if skippedProps[c.XMLName.Local] {
+			continue
+		}
+		i := childIndex(out, c.XMLName.Local)
+		switch {
+		case i < 0:
+			out.Children = append(out.Children, c)
+		case attrMergedProps[c.XMLName.Local]:
+			out.Children[i] = mergeAttrs(out.Children[i], c)
+		default:
+			out.Children[i] = c
+		}
+	}
+	return out
+}
+
+// mergeAttrs 按属性叠加，over中的属性覆盖base中的同名属性
+func mergeAttrs(base, over *Node) *Node {
+	out := &Node{XMLName: over.XMLName, Attrs: append([]xml.Attr{}, base.Attrs...), Children: over.Children}
+	for _, a := range over.Attrs {
+		replaced := false
+		for i := range out.Attrs {
+			if out.Attrs[i].Name.Local == a.Name.Local {
+				out.Attrs[i] = a
+				replaced = true
+			}
+		}
+		if !replaced {
+			out.Attrs = append(out.Attrs, a)
+		}
+	}
+	return out
+}
+
+// xorToggles 叠加字符样式，段落样式和字符样式都设置的开关属性取异或
+func xorToggles(base, over *Node) *Node {
+	out := mergeProps(base, over)
+	if base == nil || over == nil {
+		return out
+	}
+	for i, c := range out.Children {
+		local := c.XMLName.Local
+		if !toggleProps[local] {
+			continue
+		}
+		if b, o := base.child(local), over.child(local); b != nil && o != nil {
+			val := "0"
+			if propOn(b) != propOn(o) {
+				val = "1"
+			}
+			out.Children[i] = &Node{XMLName: c.XMLName, Attrs: []xml.Attr{{Name: xml.Name{Space: c.XMLName.Space, Local: "val"}, Value: val}}}
+		}
+	}
+	return out
+}
+
+// propOn 开关属性是否打开，省略w:val表示打开
+func propOn(node *Node) bool {
+	val, ok := node.attr("val")
+	if !ok {
+		return true
+	}
+	on, _ := onOffValue(val)
+	return on
+}
+
+func childIndex(node *Node, local string) int {
+	for i, c := range node.Children {
+		if c.XMLName.Local == local {
+			return i
+		}
+	}
+	return -1
+}
+
+// styleProps 沿basedOn链叠加样式的pPr或rPr，结果按样式缓存
+func (st *Styles) styleProps(id string, rPr bool) *Node {
+	cache := st.pPrCache
+	if rPr {
+		cache = st.rPrCache
+	}
+	if props, ok := cache[id]; ok {
+		return props
+	}
+	// 先占位，防止basedOn成环
+	cache[id] = nil
+
+	s, ok := st.styles[id]
+	if !ok {
+		return nil
+	}
+	own := s.pPr
+	if rPr {
+		own = s.rPr
+	}
+	var props *Node
+	if s.basedOn != "" && s.basedOn != id {
+		props = st.styleProps(s.basedOn, rPr)
+	}
+	props = mergeProps(props, own)
+	cache[id] = props
+	return props
+}
+
+// paragraphStyle 返回段落引用的样式，没有w:pStyle时使用缺省段落样式
+func (st *Styles) paragraphStyle(pPr *Node) string {
+	if pPr != nil {
+		if ps := pPr.child("pStyle"); ps != nil {
+			id, _ := ps.attr("val")
+			return id
+		}
+	}
+	return st.defaults["paragraph"]
+}
+
+// inheritedPPr 返回段落不计直接格式时的属性
+func (st *Styles) inheritedPPr(p *Node) *Node {
+	pPr := p.child("pPr")
+	props := mergeProps(st.docPPr, st.styleProps(st.paragraphStyle(pPr), false))
+	if props == nil {
+		props = &Node{XMLName: xml.Name{Space: nsWord, Local: "pPr"}}
+	}
+
+	// 编号可以来自直接格式或段落样式
+	numPr := props.child("numPr")
+	if pPr != nil && pPr.child("numPr") != nil {
+		numPr = pPr.child("numPr")
+	}
+	if numPr != nil {
+		var numId, ilvl string
+		if n := numPr.child("numId"); n != nil {
+			numId, _ = n.attr("val")
+		}
+		ilvl = "0"
+		if n := numPr.child("ilvl"); n != nil {
+			ilvl, _ = n.attr("val")
+		}
+		if level := st.numbering[numId][ilvl]; level != nil {
+			props = mergeProps(props, level.pPr)
+		}
+	}
+	return props
+}
+
+// inheritedRPr 返回run不计直接格式时的属性
+func (st *Styles) inheritedRPr(p, r *Node) *Node {
+	var para *Node
+	if p != nil {
+		para = st.styleProps(st.paragraphStyle(p.child("pPr")), true)
+	}
+	charStyle := st.defaults["character"]
+	if rPr := r.child("rPr"); rPr != nil {
+		if rs := rPr.child("rStyle"); rs != nil {
+			charStyle, _ = rs.attr("val")
+		}
+	}
+	return mergeProps(st.docRPr, xorToggles(para, st.styleProps(charStyle, true)))
+}
+
+// ParagraphProps 返回段落的有效属性
+func (st *Styles) ParagraphProps(p *Node) *Node {
+	return mergeProps(st.inheritedPPr(p), p.child("pPr"))
+}
+
+// RunProps 返回run的有效属性，p为run所在的段落
+func (st *Styles) RunProps(p, r *Node) *Node {
+	return mergeProps(st.inheritedRPr(p, r), r.child("rPr"))
+}
+
+// Resolve 计算子树中每个段落和run的有效属性
+// 返回的映射中w:p对应有效的w:pPr，w:r对应有效的w:rPr
+func (st *Styles) Resolve(root *Node) map[*Node]*Node {
+	props := map[*Node]*Node{}
+	walkRuns(root, nil, func(p, r *Node) {
+		if r == nil {
+			props[p] = st.ParagraphProps(p)
+		} else {
+			props[r] = st.RunProps(p, r)
+		}
+	})
+	return props
+}
+
+// walkRuns 按文档顺序访问段落和run，访问段落时r为nil
+func walkRuns(node, p *Node, visit func(p, r *Node)) {
+	if node.XMLName.Space == nsWord {
+		switch node.XMLName.Local {
+		case "p":
+			p = node
+			visit(p, nil)
+		case "r":
+			visit(p, node)
+		}
+	}
+	for _, child := range node.Children {
+		walkRuns(child, p, visit)
+	}
+}
+
+// DropRedundant 删除与样式继承结果相同的直接格式，返回删除的元素和属性数
+func (st *Styles) DropRedundant(root *Node) int {
+	removed := 0
+	walkRuns(root, nil, func(p, r *Node) {
+		if r == nil {
+			if pPr := p.child("pPr"); pPr != nil {
+				removed += dropInherited(pPr, st.inheritedPPr(p))
+			}
+		} else if rPr := r.child("rPr"); rPr != nil {
+			removed += dropInherited(rPr, st.inheritedRPr(p, r))
+		}
+	})
+	root.clearDigests()
+	return removed
+}
+
+// dropInherited 删除props中与inherited相同的子元素
+// 按属性叠加的元素逐个删除相同的属性
+func dropInherited(props, inherited *Node) int {
+	if inherited == nil {
+		return 0
+	}
+	removed := 0
+	children := make([]*Node, 0, len(props.Children))
+	for _, c := range props.Children {
+		local := c.XMLName.Local
+		base := inherited.child(local)
+		if skippedProps[local] || local == "numPr" || base == nil || len(c.Children) > 0 || len(base.Children) > 0 {
+			children = append(children, c)
+			continue
+		}
+		if attrMergedProps[local] {
+			attrs := make([]xml.Attr, 0, len(c.Attrs))
+			for _, a := range c.Attrs {
+				if v, ok := base.attr(a.Name.Local); ok && v == a.Value {
+					removed++
+					continue
+				}
+				attrs = append(attrs, a)
+			}
+			if len(attrs) == 0 && len(c.Attrs) > 0 {
+				continue
+			}
+			children = append(children, &Node{XMLName: c.XMLName, Attrs: attrs, Content: c.Content, Children: c.Children})
+			continue
+		}
+		if sameProp(c, base) {
+			removed++
+			continue
+		}
+		children = append(children, c)
+	}
+	props.Children = children
+	return removed
+}
+
+// sameProp 比较两个没有子元素的属性元素，开关值的不同写法视为相同
+func sameProp(l, r *Node) bool {
+	if _, ok := onOffDefaults[l.XMLName.Local]; ok && len(l.Attrs) <= 1 && len(r.Attrs) <= 1 {
+		return propOn(l) == propOn(r)
+	}
+	if len(l.Attrs) != len(r.Attrs) {
+		return false
+	}
+	for _, a := range l.Attrs {
+		if v, ok := r.attr(a.Name.Local); !ok || !sameValue(v, a.Value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package DocTrim
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+const testStyles = `<w:styles xmlns:w="` + nsWord + `">` +
+	`<w:docDefaults><w:rPrDefault><w:rPr><w:rFonts w:ascii="Times New Roman" w:eastAsia="宋体"/><w:sz w:val="21"/></w:rPr></w:rPrDefault>` +
+	`<w:pPrDefault><w:pPr><w:spacing w:after="0"/></w:pPr></w:pPrDefault></w:docDefaults>` +
+	`<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:pPr><w:jc w:val="both"/></w:pPr></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="Heading1"><w:basedOn w:val="Normal"/>` +
+	`<w:pPr><w:keepNext/><w:spacing w:before="240"/><w:numPr><w:numId w:val="1"/></w:numPr></w:pPr><w:rPr><w:b/><w:sz w:val="32"/></w:rPr></w:style>` +
+	`<w:style w:type="character" w:styleId="Strong"><w:rPr><w:b/><w:color w:val="FF0000"/></w:rPr></w:style>` +
+	`<w:style w:type="paragraph" w:styleId="Loop"><w:basedOn w:val="Loop"/></w:style>` +
+	`</w:styles>`
+
+const testNumbering = `<w:numbering xmlns:w="` + nsWord + `">` +
+	`<w:abstractNum w:abstractNumId="0"><w:lvl w:ilvl="0"><w:pPr><w:ind w:left="420" w:hanging="420"/></w:pPr></w:lvl></w:abstractNum>` +
+	`<w:num w:numId="1"><w:abstractNumId w:val="0"/></w:num>` +
+	`</w:numbering>`
+
+// propsString 将属性节点输出为便于比较的文本
+func propsString(props *Node) string {
+	parts := []string{}
+	for _, c := range props.Children {
+		s := c.XMLName.Local
+		for _, a := range c.Attrs {
+			s += " " + a.Name.Local + "=" + a.Value
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ";")
+}
+
+func TestResolveStyles(t *testing.T) {
+	st, err := ParseStyles(strings.NewReader(testStyles))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.LoadNumbering(strings.NewReader(testNumbering)); err != nil {
+		t.Fatal(err)
+	}
+
+	src := `<w:body xmlns:w="` + nsWord + `">` +
+		`<w:p><w:pPr><w:pStyle w:val="Heading1"/><w:spacing w:after="120"/></w:pPr>` +
+		`<w:r><w:t>title</w:t></w:r>` +
+		`<w:r><w:rPr><w:rStyle w:val="Strong"/></w:rPr><w:t>strong</w:t></w:r></w:p>` +
+		`<w:p><w:pPr><w:pStyle w:val="Loop"/></w:pPr><w:r><w:rPr><w:i/></w:rPr><w:t>body</w:t></w:r></w:p>` +
+		`</w:body>`
+	var root Node
+	if err := xml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatal(err)
+	}
+	props := st.Resolve(&root)
+	heading, body := root.Children[0], root.Children[1]
+
+	want := map[*Node]string{
+		heading:             "spacing after=120 before=240;jc val=both;keepNext;numPr;ind left=420 hanging=420",
+		heading.Children[1]: "rFonts ascii=Times New Roman eastAsia=宋体;sz val=32;b",
+		heading.Children[2]: "rFonts ascii=Times New Roman eastAsia=宋体;sz val=32;b val=0;color val=FF0000",
+		body:                "spacing after=0",
+		body.Children[1]:    "rFonts ascii=Times New Roman eastAsia=宋体;sz val=21;i",
+	}
+	for node, w := range want {
+		if got := propsString(props[node]); got != w {
+			t.Errorf("%s: got %q, want %q", node.XMLName.Local, got, w)
+		}
+	}
+}
+
+func TestDropRedundant(t *testing.T) {
+	st, _ := ParseStyles(strings.NewReader(testStyles))
+	src := `<w:p xmlns:w="` + nsWord + `"><w:pPr><w:pStyle w:val="Heading1"/><w:keepNext w:val="1"/><w:jc w:val="center"/>` +
+		`<w:spacing w:before="240" w:after="120"/></w:pPr>` +
+		`<w:r><w:rPr><w:rFonts w:ascii="Times New Roman" w:eastAsia="宋体"/><w:b/><w:sz w:val="28"/></w:rPr><w:t>x</w:t></w:r></w:p>`
+	var p Node
+	if err := xml.Unmarshal([]byte(src), &p); err != nil {
+		t.Fatal(err)
+	}
+	effective := st.Resolve(&p)
+
+	if removed := st.DropRedundant(&p); removed != 5 {
+		t.Errorf("removed %d, want 5", removed)
+	}
+	if got := propsString(p.child("pPr")); got != "pStyle val=Heading1;jc val=center;spacing after=120" {
+		t.Errorf("pPr: %s", got)
+	}
+	if got := propsString(p.Children[1].child("rPr")); got != "sz val=28" {
+		t.Errorf("rPr: %s", got)
+	}
+
+	// 删除后有效属性不变
+	after := st.Resolve(&p)
+	for node, props := range effective {
+		l, r := propsString(props), propsString(after[node])
+		if node.XMLName.Local == "r" && l != r {
+			t.Errorf("run props changed: %s -> %s", l, r)
+		}
+	}
+}
+
+func TestProcessFlattenStyles(t *testing.T) {
+	plain, err := DocTrim{}.Process("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flat, err := DocTrim{FlattenStyles: true}.Process("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Printf("docs/test.docx %d -> %d (flatten styles)", len(plain), len(flat))
+	if len(flat) >= len(plain) {
+		t.Errorf("flatten did not shrink output: %d >= %d", len(flat), len(plain))
+	}
+	if !bytes.Contains(flat, []byte("<w:t")) {
+		t.Error("text lost")
+	}
+}
+
+func TestPackFlattenWithoutStyles(t *testing.T) {
+	// 从XML打包时没有样式表，不能悄悄跳过
+	slim := &DocTrim{FlattenStyles: true}
+	if _, err := slim.Pack(bytes.NewReader([]byte(testXml))); err == nil {
+		t.Error("expected error without Styles")
+	}
+
+	pkg, err := DocTrim{}.OpenPackage("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slim.Styles, err = pkg.Styles(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := pkg.Data(documentPart)
+	if _, err := slim.Pack(bytes.NewReader(data)); err != nil {
+		t.Error(err)
+	}
+}
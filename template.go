@@ -0,0 +1,631 @@
+// docx模板
+// 模板中的标记：
+//
+//	{{name}}、{{student.name}}      标量，循环中可用{{.}}、{{@index}}、{{@number}}
+//	{{#each items}} ... {{/each}}   循环
+//	{{#if cond}} ... {{else}} ... {{/if}}、{{#unless cond}} ... {{/unless}}  条件
+//	{{%photo}}                      图片，值为data URI、ImageDir下的文件路径或{"src", "width", "height"}
+//
+// 循环和条件的标记单独成段时以段落为单位重复；位于表格中时以表格行为单位重复，
+// 开始和结束标记所在的行以及其间的行作为循环体，表格行中的条件不支持{{else}}
+// 标记可以被Word拆到多个run中，渲染前先用跨run替换把每个标记合并到一个w:t里
+
+package DocTrim
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nbio/xml"
+)
+
+const (
+	relImage = "http://schemas.openxmlformats.org/officeDocument/2006/relationships/image"
+	// emuPerPixel 96dpi下每像素的EMU数
+	emuPerPixel = 9525
+)
+
+var templateTagRe = regexp.MustCompile(`\{\{\s*([#/%]?)\s*([\w.@]+)(?:\s+([\w.@]+))?\s*\}\}`)
+
+// templateTag 解析后的模板标记
+type templateTag struct {
+	kind string // "#"、"/"、"%"或""
+	name string // each、if、unless、else或标量名
+	arg  string
+	text string
+}
+
+func parseTag(m []string) templateTag {
+	return templateTag{kind: m[1], name: m[2], arg: m[3], text: m[0]}
+}
+
+// isBlock 是否为循环或条件的开始、结束标记或else
+func (t templateTag) isBlock() bool {
+	return (t.kind == "#" || t.kind == "/") && (t.name == "each" || t.name == "if" || t.name == "unless") ||
+		t.kind == "" && t.name == "else"
+}
+
+// Template docx模板
+type Template struct {
+	// ImageDir 图片值中的文件路径相对该目录解析，不能读取目录之外的文件
+	// 为空时图片只能是data URI，避免数据中的路径读取任意本地文件
+	ImageDir string
+
+	pkg *Package
+}
+
+// OpenTemplate 根据URL打开或下载docx模板
+func (s DocTrim) OpenTemplate(url string) (*Template, error) {
+	pkg, err := s.OpenPackage(url)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{pkg: pkg}, nil
+}
+
+// NewTemplate 从已读取的docx包创建模板
+func NewTemplate(pkg *Package) *Template {
+	return &Template{pkg: pkg}
+}
+
+// ExecuteJson 用JSON数据填充模板，写出完整的docx
+func (t *Template) ExecuteJson(r io.Reader, w io.Writer) error {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var data any
+	if err := decoder.Decode(&data); err != nil {
+		return err
+	}
+	return t.Execute(data, w)
+}
+
+// Execute 用数据填充模板，写出完整的docx，模板本身不被修改，可以重复使用
+// data一般为json.Unmarshal得到的map[string]any
+func (t *Template) Execute(data any, w io.Writer) error {
+	pkg, err := t.Render(data)
+	if err != nil {
+		return err
+	}
+	return pkg.Write(w)
+}
+
+// Render 用数据填充模板，返回新的docx包
+func (t *Template) Render(data any) (*Package, error) {
+	pkg := t.pkg.Clone()
+	names := []string{}
+	roots := []*Node{}
+	// 绘图对象编号在整个文档内唯一，所有部件共用一个计数
+	docPr := 0
+	for _, name := range pkg.ContentParts() {
+		root, err := pkg.Part(name)
+		if err != nil {
+			return nil, err
+		}
+		if root == nil {
+			continue
+		}
+		names, roots = append(names, name), append(roots, root)
+		docPr = max(docPr, maxDocPrId(root))
+	}
+	for i, name := range names {
+		root := roots[i]
+		e := &templateExec{pkg: pkg, part: name, docPr: &docPr, imageDir: t.ImageDir}
+		mergeTags(root)
+		if err := e.renderChildren(root, &scope{value: data}, paragraphMarker); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if err := pkg.SetPart(name, root); err != nil {
+			return nil, err
+		}
+	}
+	return pkg, nil
+}
+
+// mergeTags 将被拆到多个run中的标记合并到第一个w:t中
+func mergeTags(root *Node) {
+	walkParagraphs(root, "", func(p *Node, path string) {
+		segs, text := paragraphSegments(p, path)
+		locs := templateTagRe.FindAllStringIndex(text, -1)
+		for i := len(locs) - 1; i >= 0; i-- {
+			replaceSegments(segs, locs[i][0], locs[i][1], text[locs[i][0]:locs[i][1]])
+		}
+	})
+}
+
+// maxDocPrId 返回部件中已使用的最大绘图对象编号
+func maxDocPrId(node *Node) int {
+	max := 0
+	if node.XMLName.Local == "docPr" {
+		id, _ := node.attr("id")
+		max, _ = strconv.Atoi(id)
+	}
+	for _, child := range node.Children {
+		if n := maxDocPrId(child); n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// scope 标记求值的上下文，查找名字时由内向外
+type scope struct {
+	value  any
+	index  int
+	parent *scope
+}
+
+// lookup 按点分隔的路径取值
+func (sc *scope) lookup(path string) (any, bool) {
+	switch path {
+	case ".", "this":
+		return sc.value, true
+	case "@index":
+		return sc.index, true
+	case "@number":
+		return sc.index + 1, true
+	}
+	keys := strings.Split(strings.TrimPrefix(path, "this."), ".")
+	for s := sc; s != nil; s = s.parent {
+		v, ok := field(s.value, keys[0])
+		if !ok {
+			if strings.HasPrefix(path, "this.") {
+				return nil, false
+			}
+			continue
+		}
+		for _, key := range keys[1:] {
+			if v, ok = field(v, key); !ok {
+				return nil, false
+			}
+		}
+		return v, true
+	}
+	return nil, false
+}
+
+// field 取对象的字段或数组的元素
+func field(v any, key string) (any, bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		f, ok := v[key]
+		return f, ok
+	case []any:
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(v) {
+			return nil, false
+		}
+		return v[i], true
+	}
+	return nil, false
+}
+
+// truthy 空值、false、空字符串、0和空集合为假
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case json.Number:
+		f, err := v.Float64()
+		return err != nil || f != 0
+	case float64:
+		return v != 0
+	case int:
+		return v != 0
+	case []any:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	}
+	return true
+}
+
+// scalarText 将标量转换为文本
+func scalarText(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number, bool, int:
+		return fmt.Sprint(v)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// templateExec 一个部件的渲染状态
+type templateExec struct {
+	pkg      *Package
+	part     string
+	docPr    *int // 已使用的最大绘图对象编号，各部件共享
+	imageDir string
+}
+
+// marker 判断子节点是否为块标记，返回标记
+type marker func(node *Node) []templateTag
+
+// paragraphMarker 只含一个块标记的段落
+func paragraphMarker(node *Node) []templateTag {
+	if node.XMLName.Space != nsWord || node.XMLName.Local != "p" {
+		return nil
+	}
+	_, text := paragraphSegments(node, "")
+	m := templateTagRe.FindStringSubmatch(strings.TrimSpace(text))
+	if m == nil || m[0] != strings.TrimSpace(text) {
+		return nil
+	}
+	if tag := parseTag(m); tag.isBlock() {
+		return []templateTag{tag}
+	}
+	return nil
+}
+
+// rowMarker 含有块标记的表格行
+func rowMarker(node *Node) []templateTag {
+	if node.XMLName.Local != "tr" {
+		return nil
+	}
+	tags := []templateTag{}
+	walkParagraphs(node, "", func(p *Node, path string) {
+		_, text := paragraphSegments(p, path)
+		for _, m := range templateTagRe.FindAllStringSubmatch(text, -1) {
+			if tag := parseTag(m); tag.isBlock() {
+				tags = append(tags, tag)
+			}
+		}
+	})
+	return tags
+}
+
+// renderChildren 渲染节点的子节点，展开其中的循环和条件
+func (e *templateExec) renderChildren(node *Node, sc *scope, mark marker) error {
+	children := node.Children
+	out := make([]*Node, 0, len(children))
+	for i := 0; i < len(children); i++ {
+		tags := mark(children[i])
+		if len(tags) == 0 {
+			if err := e.renderNode(children[i], sc); err != nil {
+				return err
+			}
+			out = append(out, children[i])
+			continue
+		}
+		open := tags[0]
+		if open.kind != "#" {
+			return fmt.Errorf("unexpected %s", open.text)
+		}
+
+		// 表格行的开始和结束标记所在行属于循环体，段落标记不属于
+		rows := children[i].XMLName.Local == "tr"
+		end, elseAt, err := blockEnd(children, i, open, mark, rows)
+		if err != nil {
+			return err
+		}
+		var body, alt []*Node
+		switch {
+		case rows:
+			body = children[i : end+1]
+		case elseAt >= 0:
+			body, alt = children[i+1:elseAt], children[elseAt+1:end]
+		default:
+			body = children[i+1 : end]
+		}
+
+		scopes, err := blockScopes(open, sc)
+		if err != nil {
+			return err
+		}
+		if len(scopes) == 0 && alt != nil {
+			scopes, body = []*scope{sc}, alt
+		}
+		for _, itemScope := range scopes {
+			block := &Node{Children: make([]*Node, len(body))}
+			for k, child := range body {
+				block.Children[k] = child.clone()
+			}
+			if rows {
+				removeBlockTags(block)
+			}
+			if err := e.renderChildren(block, itemScope, mark); err != nil {
+				return err
+			}
+			out = append(out, block.Children...)
+		}
+		i = end
+	}
+	node.Children = out
+	return nil
+}
+
+// blockEnd 查找与children[start]中开始标记配对的结束标记，返回结束位置和同层else的位置
+// 表格行的循环不支持嵌套和else，结束标记可以与开始标记在同一行
+func blockEnd(children []*Node, start int, open templateTag, mark marker, rows bool) (int, int, error) {
+	if rows {
+		for i := start; i < len(children); i++ {
+			tags := mark(children[i])
+			if i == start {
+				tags = tags[1:]
+			}
+			for _, tag := range tags {
+				switch {
+				case tag.kind == "/" && tag.name == open.name:
+					return i, -1, nil
+				case tag.kind == "" && tag.name == "else":
+					return 0, 0, fmt.Errorf("%s: else not supported in table rows", open.text)
+				}
+			}
+		}
+		return 0, 0, fmt.Errorf("unclosed %s", open.text)
+	}
+
+	depth, elseAt := 0, -1
+	for i := start + 1; i < len(children); i++ {
+		tags := mark(children[i])
+		if len(tags) == 0 {
+			continue
+		}
+		switch tag := tags[0]; {
+		case tag.kind == "#":
+			depth++
+		case tag.kind == "/" && depth > 0:
+			depth--
+		case tag.kind == "/":
+			if tag.name != open.name {
+				return 0, 0, fmt.Errorf("%s closed by %s", open.text, tag.text)
+			}
+			return i, elseAt, nil
+		case tag.name == "else" && depth == 0 && open.name != "each":
+			elseAt = i
+		}
+	}
+	return 0, 0, fmt.Errorf("unclosed %s", open.text)
+}
+
+// blockScopes 返回块需要渲染的次数及每次的上下文
+func blockScopes(open templateTag, sc *scope) ([]*scope, error) {
+	v, _ := sc.lookup(open.arg)
+	switch open.name {
+	case "each":
+		items, ok := v.([]any)
+		if !ok && v != nil {
+			return nil, fmt.Errorf("%s: %s is not an array", open.text, open.arg)
+		}
+		scopes := make([]*scope, len(items))
+		for i, item := range items {
+			scopes[i] = &scope{value: item, index: i, parent: sc}
+		}
+		return scopes, nil
+	case "if":
+		if truthy(v) {
+			return []*scope{sc}, nil
+		}
+	case "unless":
+		if !truthy(v) {
+			return []*scope{sc}, nil
+		}
+	}
+	return nil, nil
+}
+
+// removeBlockTags 删除表格行中的块标记文本
+func removeBlockTags(block *Node) {
+	for _, row := range block.Children {
+		walkRuns(row, nil, func(p, r *Node) {
+			if r == nil {
+				return
+			}
+			for _, t := range r.Children {
+				if t.XMLName.Local != "t" {
+					continue
+				}
+				text := templateTagRe.ReplaceAllStringFunc(string(t.Content), func(s string) string {
+					if parseTag(templateTagRe.FindStringSubmatch(s)).isBlock() {
+						return ""
+					}
+					return s
+				})
+				setText(t, text)
+			}
+		})
+	}
+}
+
+// renderNode 渲染不含块标记的节点
+func (e *templateExec) renderNode(node *Node, sc *scope) error {
+	if node.XMLName.Space == nsWord {
+		switch node.XMLName.Local {
+		case "tbl":
+			return e.renderChildren(node, sc, rowMarker)
+		case "r":
+			return e.renderRun(node, sc)
+		case "txbxContent", "tc", "sdtContent", "body":
+			return e.renderChildren(node, sc, paragraphMarker)
+		}
+	}
+	for _, child := range node.Children {
+		if err := e.renderNode(child, sc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderRun 替换run中的标量和图片标记
+func (e *templateExec) renderRun(run *Node, sc *scope) error {
+	children := make([]*Node, 0, len(run.Children))
+	for _, child := range run.Children {
+		if child.XMLName.Local != "t" || child.XMLName.Space != nsWord {
+			if err := e.renderNode(child, sc); err != nil {
+				return err
+			}
+			children = append(children, child)
+			continue
+		}
+
+		text := string(child.Content)
+		var b strings.Builder
+		last := 0
+		for _, loc := range templateTagRe.FindAllStringSubmatchIndex(text, -1) {
+			tag := parseTag(submatches(text, loc))
+			b.WriteString(text[last:loc[0]])
+			last = loc[1]
+			switch {
+			case tag.isBlock():
+				return fmt.Errorf("%s must be in its own paragraph or table row", tag.text)
+			case tag.kind == "%":
+				v, _ := sc.lookup(tag.name)
+				if v == nil {
+					continue
+				}
+				drawing, err := e.image(v)
+				if err != nil {
+					return fmt.Errorf("%s: %w", tag.text, err)
+				}
+				// 图片前的文字另起w:t放在图片之前，原w:t保留图片之后的文字
+				if b.Len() > 0 {
+					t := newWordNode("t")
+					setText(t, b.String())
+					children = append(children, t)
+					b.Reset()
+				}
+				children = append(children, drawing)
+			default:
+				v, _ := sc.lookup(tag.name)
+				b.WriteString(scalarText(v))
+			}
+		}
+		b.WriteString(text[last:])
+		if b.Len() > 0 {
+			setText(child, b.String())
+			children = append(children, child)
+		}
+	}
+	run.Children = children
+	return nil
+}
+
+// submatches 将FindAllStringSubmatchIndex的结果转换为字符串
+func submatches(text string, loc []int) []string {
+	m := make([]string, len(loc)/2)
+	for i := range m {
+		if loc[2*i] >= 0 {
+			m[i] = text[loc[2*i]:loc[2*i+1]]
+		}
+	}
+	return m
+}
+
+// image 将图片加入包中，返回内联的w:drawing
+func (e *templateExec) image(v any) (*Node, error) {
+	var src string
+	width, height := 0, 0
+	switch v := v.(type) {
+	case string:
+		src = v
+	case map[string]any:
+		src = scalarText(v["src"])
+		width, _ = strconv.Atoi(scalarText(v["width"]))
+		height, _ = strconv.Atoi(scalarText(v["height"]))
+	default:
+		return nil, errors.New("image value must be a path, data URI or object")
+	}
+
+	data, err := readImage(src, e.imageDir)
+	if err != nil {
+		return nil, err
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case width == 0 && height == 0:
+		width, height = config.Width, config.Height
+	case height == 0:
+		height = width * config.Height / config.Width
+	case width == 0:
+		width = height * config.Width / config.Height
+	}
+
+	*e.docPr++
+	id := *e.docPr
+	name := fmt.Sprintf("media/doctrim%d.%s", id, format)
+	for _, exists := e.pkg.Data("word/" + name); exists; _, exists = e.pkg.Data("word/" + name) {
+		*e.docPr++
+		id = *e.docPr
+		name = fmt.Sprintf("media/doctrim%d.%s", id, format)
+	}
+	e.pkg.SetData("word/"+name, data)
+	if err := e.pkg.AddContentType(format, "image/"+format); err != nil {
+		return nil, err
+	}
+	rid, err := e.pkg.AddRelationship(e.part, relImage, name)
+	if err != nil {
+		return nil, err
+	}
+
+	cx, cy := width*emuPerPixel, height*emuPerPixel
+	drawing := fmt.Sprintf(`<w:drawing xmlns:w="%s" xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:pic="http://schemas.openxmlformats.org/drawingml/2006/picture" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">`+
+		`<wp:inline distT="0" distB="0" distL="0" distR="0"><wp:extent cx="%d" cy="%d"/><wp:docPr id="%d" name="Picture %d"/>`+
+		`<wp:cNvGraphicFramePr><a:graphicFrameLocks noChangeAspect="1"/></wp:cNvGraphicFramePr>`+
+		`<a:graphic><a:graphicData uri="http://schemas.openxmlformats.org/drawingml/2006/picture"><pic:pic>`+
+		`<pic:nvPicPr><pic:cNvPr id="%d" name="%s"/><pic:cNvPicPr/></pic:nvPicPr>`+
+		`<pic:blipFill><a:blip r:embed="%s"/><a:stretch><a:fillRect/></a:stretch></pic:blipFill>`+
+		`<pic:spPr><a:xfrm><a:off x="0" y="0"/><a:ext cx="%d" cy="%d"/></a:xfrm><a:prstGeom prst="rect"><a:avLst/></a:prstGeom></pic:spPr>`+
+		`</pic:pic></a:graphicData></a:graphic></wp:inline></w:drawing>`,
+		nsWord, cx, cy, id, id, id, name, rid, cx, cy)
+	var node Node
+	if err := xml.Unmarshal([]byte(drawing), &node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// readImage 读取data URI或dir下的图片文件，dir为空时只接受data URI
+// 路径解析符号链接后仍须位于dir之内
+func readImage(src, dir string) ([]byte, error) {
+	if strings.HasPrefix(src, "data:") {
+		_, payload, ok := strings.Cut(src, ",")
+		if !ok {
+			return nil, errors.New("invalid data URI")
+		}
+		return base64.StdEncoding.DecodeString(payload)
+	}
+	if dir == "" {
+		return nil, errors.New("image files require Template.ImageDir, use a data URI instead")
+	}
+	if !filepath.IsLocal(src) {
+		return nil, fmt.Errorf("image path outside the image directory: %s", src)
+	}
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(root, src))
+	if err != nil {
+		return nil, err
+	}
+	if rel, err := filepath.Rel(root, path); err != nil || !filepath.IsLocal(rel) {
+		return nil, fmt.Errorf("image path outside the image directory: %s", src)
+	}
+	return os.ReadFile(path)
+}
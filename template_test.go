@@ -0,0 +1,198 @@
+package DocTrim
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testTemplate = `<w:document xmlns:w="` + nsWord + `" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><w:body>` +
+	`<w:p><w:r><w:rPr><w:b/></w:rPr><w:t>成绩单：{{stu</w:t></w:r><w:r><w:t>dent.name}}</w:t></w:r><w:r><w:t xml:space="preserve"> {{%photo}}</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>{{#each awards}}</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>{{@number}}. {{.}}（{{student.name}}）</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>{{/each}}</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>{{#if passed}}</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>合格</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>{{else}}</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>不合格</w:t></w:r></w:p>` +
+	`<w:p><w:r><w:t>{{/if}}</w:t></w:r></w:p>` +
+	`<w:tbl><w:tr><w:tc><w:p><w:r><w:t>科目</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>分数</w:t></w:r></w:p></w:tc></w:tr>` +
+	`<w:tr><w:tc><w:p><w:r><w:t>{{#each scores}}{{subject}}</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>{{score}}{{/each}}</w:t></w:r></w:p></w:tc></w:tr></w:tbl>` +
+	`<w:p><w:r><w:t>{{#unless passed}}</w:t></w:r></w:p><w:p><w:r><w:t>补考</w:t></w:r></w:p><w:p><w:r><w:t>{{/unless}}</w:t></w:r></w:p>` +
+	`<w:sectPr/></w:body></w:document>`
+
+// testPng 生成一个宽w高h的PNG图片
+func testPng(w, h int) []byte {
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)))
+	return buf.Bytes()
+}
+
+func TestTemplate(t *testing.T) {
+	pkg, err := DocTrim{}.OpenPackage("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg.SetData(documentPart, []byte(testTemplate))
+	tpl := NewTemplate(pkg)
+
+	data := `{"student": {"name": "李雷"}, "passed": true, "awards": ["三好学生", "数学竞赛一等奖"],
+		"scores": [{"subject": "语文", "score": 95}, {"subject": "数学", "score": 100.5}],
+		"photo": {"src": "data:image/png;base64,` + base64.StdEncoding.EncodeToString(testPng(40, 20)) + `", "width": 80}}`
+	var out bytes.Buffer
+	if err := tpl.ExecuteJson(strings.NewReader(data), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := ReadPackage(out.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := result.Part(documentPart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "成绩单：李雷 \n1. 三好学生（李雷）\n2. 数学竞赛一等奖（李雷）\n合格\n科目\t分数\n语文\t95\n数学\t100.5\n"
+	if text := ExtractText(doc, nil).Text; text != want {
+		t.Errorf("got %q", text)
+	}
+
+	// 标量沿用第一个run的格式
+	first := doc.child("body").Children[0].Children[0]
+	if first.child("rPr").child("b") == nil {
+		t.Error("format of first run lost")
+	}
+
+	// 图片
+	extent := doc.child("body").Children[0].Children[2].child("drawing").Children[0].child("extent")
+	if cx, _ := extent.attr("cx"); cx != "762000" {
+		t.Errorf("cx = %s", cx)
+	}
+	if cy, _ := extent.attr("cy"); cy != "381000" {
+		t.Errorf("cy = %s", cy)
+	}
+	rels, _ := result.Data(relsPart(documentPart))
+	types, _ := result.Data(contentTypes)
+	if !bytes.Contains(rels, []byte(relImage)) || !bytes.Contains(types, []byte(`Extension="png"`)) {
+		t.Error("image relationship or content type missing")
+	}
+	found := false
+	for _, name := range result.Names() {
+		if strings.HasPrefix(name, "word/media/doctrim") {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("image part missing")
+	}
+
+	// 模板可以重复使用
+	out.Reset()
+	if err := tpl.ExecuteJson(strings.NewReader(`{"passed": false}`), &out); err != nil {
+		t.Fatal(err)
+	}
+	result, _ = ReadPackage(out.Bytes())
+	doc, _ = result.Part(documentPart)
+	if text := ExtractText(doc, nil).Text; text != "成绩单： \n不合格\n科目\t分数\n补考\n" {
+		t.Errorf("got %q", text)
+	}
+}
+
+func TestTemplateImagePaths(t *testing.T) {
+	dir := t.TempDir()
+	images := filepath.Join(dir, "images")
+	os.Mkdir(images, 0755)
+	os.WriteFile(filepath.Join(images, "photo.png"), testPng(10, 10), 0644)
+	os.WriteFile(filepath.Join(dir, "secret.png"), testPng(10, 10), 0644)
+	os.Symlink(filepath.Join(dir, "secret.png"), filepath.Join(images, "link.png"))
+
+	pkg, err := DocTrim{}.OpenPackage("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg.SetData(documentPart, []byte(testTemplate))
+	render := func(imageDir, src string) error {
+		tpl := NewTemplate(pkg)
+		tpl.ImageDir = imageDir
+		_, err := tpl.Render(map[string]any{"photo": src})
+		return err
+	}
+
+	// 未设置ImageDir时只接受data URI
+	for _, src := range []string{"/etc/passwd", filepath.Join(images, "photo.png")} {
+		if err := render("", src); err == nil {
+			t.Errorf("%s read without an image directory", src)
+		}
+	}
+	for _, src := range []string{"/etc/passwd", filepath.Join(images, "photo.png"), "../secret.png", "link.png"} {
+		if err := render(images, src); err == nil {
+			t.Errorf("%s read outside the image directory", src)
+		}
+	}
+	if err := render(images, "photo.png"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTemplateDocPrIds(t *testing.T) {
+	// 脚注中已有编号2，正文插入的图片不能再使用2
+	drawing := func(id string) string {
+		return `<w:r><w:drawing><wp:inline><wp:docPr id="` + id + `" name="Picture"/></wp:inline></w:drawing></w:r>`
+	}
+	ns := `xmlns:w="` + nsWord + `" xmlns:wp="http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing"`
+	pkg, err := DocTrim{}.OpenPackage("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg.SetData(documentPart, []byte(`<w:document `+ns+`><w:body><w:p>`+drawing("1")+`<w:r><w:t>{{%photo}}</w:t></w:r></w:p></w:body></w:document>`))
+	pkg.SetData("word/footnotes.xml", []byte(`<w:footnotes `+ns+`><w:footnote w:id="1"><w:p>`+drawing("2")+`<w:r><w:t>{{%photo}}</w:t></w:r></w:p></w:footnote></w:footnotes>`))
+	photo := "data:image/png;base64," + base64.StdEncoding.EncodeToString(testPng(4, 4))
+	result, err := NewTemplate(pkg).Render(map[string]any{"photo": photo})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := map[string]int{}
+	for _, name := range result.ContentParts() {
+		root, _ := result.Part(name)
+		var walk func(node *Node)
+		walk = func(node *Node) {
+			if node.XMLName.Local == "docPr" {
+				id, _ := node.attr("id")
+				ids[id]++
+			}
+			for _, child := range node.Children {
+				walk(child)
+			}
+		}
+		if root != nil {
+			walk(root)
+		}
+	}
+	if len(ids) != 4 {
+		t.Errorf("docPr ids %v, want 4 distinct ids", ids)
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	cases := map[string]string{
+		`<w:p><w:r><w:t>{{#each items}}</w:t></w:r></w:p>`:                                     "unclosed",
+		`<w:p><w:r><w:t>{{#if x}}</w:t></w:r></w:p><w:p><w:r><w:t>{{/each}}</w:t></w:r></w:p>`: "closed by",
+		`<w:p><w:r><w:t>a {{#if x}} b</w:t></w:r></w:p>`:                                       "own paragraph",
+		`<w:tbl><w:tr><w:tc><w:p><w:r><w:t>{{#if x}}a</w:t></w:r></w:p></w:tc></w:tr>` +
+			`<w:tr><w:tc><w:p><w:r><w:t>{{else}}b{{/if}}</w:t></w:r></w:p></w:tc></w:tr></w:tbl>`: "else not supported",
+	}
+	for body, want := range cases {
+		pkg, _ := DocTrim{}.OpenPackage("docs/test.docx")
+		pkg.SetData(documentPart, []byte(`<w:document xmlns:w="`+nsWord+`"><w:body>`+body+`</w:body></w:document>`))
+		_, err := NewTemplate(pkg).Render(map[string]any{"items": []any{1}})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: got %v, want %s", body, err, want)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+// 纯文本导出
+// 段落之间换行，表格单元格之间以制表符分隔，列表编号按numbering.xml渲染
+// 同时记录每段文字来自哪个w:t节点，用于把检索命中的位置映射回原文档
+
+package DocTrim
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/nbio/xml"
+)
+
+// TextExport 纯文本及其源映射
+type TextExport struct {
+	Text  string     `json:"text"`
+	Spans []TextSpan `json:"spans"`
+}
+
+// TextSpan 纯文本中来自同一个节点的一段文字，偏移量和长度均以字符计
+// 段落换行、单元格分隔符和列表编号不对应节点，不在映射中
+type TextSpan struct {
+	Offset int    `json:"offset"`
+	Length int    `json:"length"`
+	Path   string `json:"path"`
+	Node   *Node  `json:"-"`
+}
+
+// nsPrefixes 路径中使用的命名空间前缀
+var nsPrefixes = map[string]string{
+	nsWord: "w",
+	nsMath: "m",
+	nsXML:  "xml",
+	"http://schemas.openxmlformats.org/markup-compatibility/2006":            "mc",
+	"http://schemas.openxmlformats.org/drawingml/2006/main":                  "a",
+	"http://schemas.openxmlformats.org/drawingml/2006/wordprocessingDrawing": "wp",
+	"http://schemas.openxmlformats.org/officeDocument/2006/relationships":    "r",
+	"http://schemas.microsoft.com/office/word/2010/wordprocessingShape":      "wps",
+	"http://schemas.openxmlformats.org/drawingml/2006/picture":               "pic",
+	"urn:schemas-microsoft-com:vml":                                          "v",
+	"urn:schemas-microsoft-com:office:office":                                "o",
+	"http://schemas.microsoft.com/office/word/2010/wordml":                   "w14",
+}
+
+// qualifiedName 返回节点带前缀的名字，未知命名空间只返回本地名
+func qualifiedName(node *Node) string {
+	return prefixedName(node.XMLName)
+}
+
+// prefixedName 返回带前缀的元素名或属性名
+func prefixedName(name xml.Name) string {
+	if prefix, ok := nsPrefixes[name.Space]; ok {
+		return prefix + ":" + name.Local
+	}
+	return name.Local
+}
+
+// childPaths 返回子节点的路径，同名兄弟节点按出现顺序从1编号
+func childPaths(node *Node, path string) []string {
+	counts := map[string]int{}
+	paths := make([]string, len(node.Children))
+	for i, child := range node.Children {
+		name := qualifiedName(child)
+		counts[name]++
+		paths[i] = path + "/" + name + "[" + strconv.Itoa(counts[name]) + "]"
+	}
+	return paths
+}
+
+// Locate 返回纯文本中第offset个字符所在的节点映射，以及该字符在节点文本中的偏移
+func (t *TextExport) Locate(offset int) (TextSpan, int, bool) {
+	i := sort.Search(len(t.Spans), func(i int) bool {
+		return t.Spans[i].Offset+t.Spans[i].Length > offset
+	})
+	if i == len(t.Spans) || t.Spans[i].Offset > offset {
+		return TextSpan{}, 0, false
+	}
+	return t.Spans[i], offset - t.Spans[i].Offset, true
+}
+
+// textWriter 输出纯文本并记录映射
+type textWriter struct {
+	b        strings.Builder
+	n        int
+	spans    []TextSpan
+	styles   *Styles
+	counters map[string][]int
+}
+
+// ExtractText 导出子树的纯文本，styles为nil时列表编号统一渲染为“•”
+func ExtractText(root *Node, styles *Styles) *TextExport {
+	w := &textWriter{styles: styles, counters: map[string][]int{}}
+	w.block(root, "/"+qualifiedName(root))
+	return &TextExport{Text: w.b.String(), Spans: w.spans}
+}
+
+func (w *textWriter) write(s string) {
+	w.b.WriteString(s)
+	w.n += utf8.RuneCountInString(s)
+}
+
+func (w *textWriter) writeNode(s string, node *Node, path string) {
+	length := utf8.RuneCountInString(s)
+	if length == 0 {
+		return
+	}
+	w.spans = append(w.spans, TextSpan{Offset: w.n, Length: length, Path: path, Node: node})
+	w.write(s)
+}
+
+// block 输出块级内容
+func (w *textWriter) block(node *Node, path string) {
+	paths := childPaths(node, path)
+	for i, child := range node.Children {
+		if child.XMLName.Space != nsWord {
+			w.block(child, paths[i])
+			continue
+		}
+		switch child.XMLName.Local {
+		case "p":
+			w.paragraph(child, paths[i])
+			w.write("\n")
+		case "tbl":
+			w.table(child, paths[i])
+		case "sectPr", "pPr", "tblPr":
+		default:
+			w.block(child, paths[i])
+		}
+	}
+}
+
+// table 每行一行，单元格之间以制表符分隔，单元格内的段落以空格连接
+func (w *textWriter) table(tbl *Node, path string) {
+	rows := childPaths(tbl, path)
+	for i, tr := range tbl.Children {
+		if tr.XMLName.Local != "tr" {
+			continue
+		}
+		cells := childPaths(tr, rows[i])
+		first := true
+		for j, tc := range tr.Children {
+			if tc.XMLName.Local != "tc" {
+				continue
+			}
+			if !first {
+				w.write("\t")
+			}
+			first = false
+			w.cell(tc, cells[j])
+		}
+		w.write("\n")
+	}
+}
+
+func (w *textWriter) cell(tc *Node, path string) {
+	paths := childPaths(tc, path)
+	first := true
+	for i, child := range tc.Children {
+		switch child.XMLName.Local {
+		case "p", "tbl", "sdt":
+			if !first {
+				w.write(" ")
+			}
+			first = false
+		}
+		switch child.XMLName.Local {
+		case "p":
+			w.paragraph(child, paths[i])
+		case "tbl":
+			// 嵌套表格的行以空格连接
+			inner := &textWriter{styles: w.styles, counters: w.counters, n: w.n}
+			inner.table(child, paths[i])
+			text := strings.ReplaceAll(strings.TrimRight(inner.b.String(), "\n"), "\n", " ")
+			w.spans = append(w.spans, inner.spans...)
+			w.b.WriteString(text)
+			w.n += utf8.RuneCountInString(text)
+		case "sdt":
+			if content := child.child("sdtContent"); content != nil {
+				w.cell(content, childPaths(child, paths[i])[childIndex(child, "sdtContent")])
+			}
+		}
+	}
+}
+
+// paragraph 输出列表编号和段落内容
+func (w *textWriter) paragraph(p *Node, path string) {
+	if marker := w.marker(p); marker != "" {
+		w.write(marker + " ")
+	}
+	w.inline(p, path)
+}
+
+// inline 输出段落内的文字
+func (w *textWriter) inline(node *Node, path string) {
+	paths := childPaths(node, path)
+	for i, child := range node.Children {
+		switch child.XMLName.Space {
+		case nsMath:
+			if child.XMLName.Local == "oMath" || child.XMLName.Local == "oMathPara" {
+				if tex, err := OMMLToLatex(child); err == nil {
+					w.write("$" + tex + "$")
+				}
+				continue
+			}
+		case nsWord:
+			switch child.XMLName.Local {
+			case "t":
+				w.writeNode(string(child.Content), child, paths[i])
+				continue
+			case "tab", "br", "cr", "noBreakHyphen":
+				if node.XMLName.Local == "r" {
+					w.writeNode(map[string]string{"tab": "\t", "br": "\n", "cr": "\n", "noBreakHyphen": "-"}[child.XMLName.Local], child, paths[i])
+				}
+				continue
+			case "pPr", "rPr", "delText", "instrText":
+				continue
+			case "txbxContent":
+				w.write("\n")
+				w.block(child, paths[i])
+				continue
+			}
+		}
+		if child.XMLName.Local == "Fallback" {
+			continue
+		}
+		w.inline(child, paths[i])
+	}
+}
+
+// marker 渲染段落的列表编号
+func (w *textWriter) marker(p *Node) string {
+	var numPr *Node
+	if w.styles != nil {
+		numPr = w.styles.ParagraphProps(p).child("numPr")
+	} else if pPr := p.child("pPr"); pPr != nil {
+		numPr = pPr.child("numPr")
+	}
+	if numPr == nil {
+		return ""
+	}
+	numId, ilvl := "", 0
+	if n := numPr.child("numId"); n != nil {
+		numId, _ = n.attr("val")
+	}
+	if n := numPr.child("ilvl"); n != nil {
+		val, _ := n.attr("val")
+		ilvl, _ = strconv.Atoi(val)
+	}
+	if numId == "" || numId == "0" || ilvl < 0 || ilvl > 8 {
+		return ""
+	}
+	if w.styles == nil || w.styles.numbering[numId] == nil {
+		return "•"
+	}
+
+	levels := w.styles.numbering[numId]
+	counters, ok := w.counters[numId]
+	if !ok {
+		counters = make([]int, 9)
+		w.counters[numId] = counters
+	}
+	start := func(l int) int {
+		if level := levels[strconv.Itoa(l)]; level != nil {
+			return level.start
+		}
+		return 1
+	}
+	if counters[ilvl] == 0 {
+		counters[ilvl] = start(ilvl)
+	} else {
+		counters[ilvl]++
+	}
+	for l := ilvl + 1; l < len(counters); l++ {
+		counters[l] = 0
+	}
+
+	level := levels[strconv.Itoa(ilvl)]
+	if level == nil {
+		return "•"
+	}
+	if level.format == "bullet" {
+		if r, _ := utf8.DecodeRuneInString(level.text); r == utf8.RuneError || r >= 0xE000 && r <= 0xF8FF {
+			// Symbol、Wingdings字体的私用区字符
+			return "•"
+		}
+		return level.text
+	}
+	text := level.text
+	for l := 0; l <= ilvl; l++ {
+		count := counters[l]
+		if count == 0 {
+			count = start(l)
+		}
+		format := level.format
+		if lv := levels[strconv.Itoa(l)]; lv != nil {
+			format = lv.format
+		}
+		text = strings.ReplaceAll(text, "%"+strconv.Itoa(l+1), formatNumber(count, format))
+	}
+	return text
+}
+
+// formatNumber 按编号格式输出序号，不支持的格式按阿拉伯数字输出
+func formatNumber(n int, format string) string {
+	switch format {
+	case "none":
+		return ""
+	case "upperLetter", "lowerLetter":
+		s := strings.Repeat(string(rune('A'+(n-1)%26)), (n-1)/26+1)
+		if format == "lowerLetter" {
+			s = strings.ToLower(s)
+		}
+		return s
+	case "upperRoman", "lowerRoman":
+		s := romanNumber(n)
+		if format == "lowerRoman" {
+			s = strings.ToLower(s)
+		}
+		return s
+	case "chineseCounting", "chineseCountingThousand", "chineseLegalSimplified", "ideographTraditional":
+		if format == "ideographTraditional" && n >= 1 && n <= 10 {
+			return string([]rune("甲乙丙丁戊己庚辛壬癸")[n-1])
+		}
+		return chineseNumber(n, format == "chineseLegalSimplified")
+	case "decimalEnclosedCircle", "decimalEnclosedCircleChinese":
+		if n >= 1 && n <= 20 {
+			return string(rune(0x2460 + n - 1))
+		}
+	case "decimalZero":
+		if n < 10 {
+			return "0" + strconv.Itoa(n)
+		}
+	}
+	return strconv.Itoa(n)
+}
+
+func romanNumber(n int) string {
+	if n <= 0 || n >= 4000 {
+		return strconv.Itoa(n)
+	}
+	values := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+	symbols := []string{"M", "CM", "D", "CD", "C", "XC", "L", "XL", "X", "IX", "V", "IV", "I"}
+	var b strings.Builder
+	for i, v := range values {
+		for n >= v {
+			b.WriteString(symbols[i])
+			n -= v
+		}
+	}
+	return b.String()
+}
+
+// chineseNumber 输出一万以内的中文数字，如“十二”“一百零五”
+func chineseNumber(n int, legal bool) string {
+	digits := []rune("零一二三四五六七八九")
+	units := []string{"", "十", "百", "千"}
+	if legal {
+		digits = []rune("零壹贰叁肆伍陆柒捌玖")
+		units = []string{"", "拾", "佰", "仟"}
+	}
+	if n <= 0 || n >= 10000 {
+		return strconv.Itoa(n)
+	}
+	var b strings.Builder
+	zero := false
+	for i := 3; i >= 0; i-- {
+		pow := []int{1, 10, 100, 1000}[i]
+		d := n / pow % 10
+		if d == 0 {
+			zero = b.Len() > 0
+			continue
+		}
+		if zero {
+			b.WriteRune(digits[0])
+			zero = false
+		}
+		// 十到十九读作“十X”
+		if !(i == 1 && d == 1 && n < 20 && !legal) {
+			b.WriteRune(digits[d])
+		}
+		b.WriteString(units[i])
+	}
+	return b.String()
+}
+
+// ProcessText 打开docx并导出主文档的纯文本和源映射，列表编号按文档的编号定义渲染
+// Revisions为RevisionsMark时插入和删除以{++ ++}、{-- --}标记在文本中
+func (s DocTrim) ProcessText(url string) (*TextExport, error) {
+	pkg, err := s.OpenPackage(url)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := pkg.Part(documentPart)
+	if err != nil {
+		return nil, err
+	}
+	styles, err := pkg.Styles()
+	if err != nil {
+		return nil, err
+	}
+	ApplyRevisions(doc, s.Revisions, s.RevisionFilter)
+	if s.Sanitize.Enabled() {
+		sanitizeNode(doc, s.Sanitize, styles)
+	}
+	if len(s.Redact) > 0 {
+		if s.Vault == nil {
+			return nil, errRedactVault
+		}
+		if _, err := Redact(doc, s.Redact, s.Vault); err != nil {
+			return nil, err
+		}
+	}
+	return ExtractText(doc, styles), nil
+}
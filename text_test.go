@@ -0,0 +1,110 @@
+package DocTrim
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbio/xml"
+)
+
+func TestExtractText(t *testing.T) {
+	numbering := `<w:numbering xmlns:w="` + nsWord + `">` +
+		`<w:abstractNum w:abstractNumId="0">` +
+		`<w:lvl w:ilvl="0"><w:start w:val="1"/><w:numFmt w:val="chineseCounting"/><w:lvlText w:val="%1、"/></w:lvl>` +
+		`<w:lvl w:ilvl="1"><w:start w:val="1"/><w:numFmt w:val="decimal"/><w:lvlText w:val="%1.%2"/></w:lvl>` +
+		`</w:abstractNum>` +
+		`<w:num w:numId="1"><w:abstractNumId w:val="0"/></w:num>` +
+		`</w:numbering>`
+	st, _ := ParseStyles(strings.NewReader(testStyles))
+	if err := st.LoadNumbering(strings.NewReader(numbering)); err != nil {
+		t.Fatal(err)
+	}
+
+	item := func(ilvl, text string) string {
+		return `<w:p><w:pPr><w:numPr><w:ilvl w:val="` + ilvl + `"/><w:numId w:val="1"/></w:numPr></w:pPr><w:r><w:t>` + text + `</w:t></w:r></w:p>`
+	}
+	src := `<w:document xmlns:w="` + nsWord + `"><w:body>` +
+		`<w:p><w:r w:rsidR="1"><w:t>{{cust</w:t></w:r><w:r w:rsidR="2"><w:t>omer}}</w:t><w:tab/><w:t>中文</w:t></w:r></w:p>` +
+		item("0", "选择题") + item("1", "第一小题") + item("1", "第二小题") + item("0", "填空题") +
+		`<w:tbl><w:tblPr/><w:tr><w:tc><w:p><w:r><w:t>A</w:t></w:r></w:p><w:p><w:r><w:t>a</w:t></w:r></w:p></w:tc>` +
+		`<w:tc><w:p><w:r><w:t>B</w:t></w:r></w:p></w:tc></w:tr></w:tbl>` +
+		`<w:sectPr/></w:body></w:document>`
+	var root Node
+	if err := xml.Unmarshal([]byte(src), &root); err != nil {
+		t.Fatal(err)
+	}
+
+	text := ExtractText(&root, st)
+	want := "{{customer}}\t中文\n一、 选择题\n一.1 第一小题\n一.2 第二小题\n二、 填空题\nA a\tB\n"
+	if text.Text != want {
+		t.Errorf("got %q", text.Text)
+	}
+
+	span, offset, ok := text.Locate(8)
+	if !ok || span.Path != "/w:document/w:body[1]/w:p[1]/w:r[2]/w:t[1]" || offset != 2 {
+		t.Errorf("offset 8 -> %s +%d", span.Path, offset)
+	}
+	if span.Node == nil || string(span.Node.Content) != "omer}}" {
+		t.Error("span node mismatch")
+	}
+	if span, offset, _ := text.Locate(14); span.Path != "/w:document/w:body[1]/w:p[1]/w:r[2]/w:t[2]" || offset != 1 {
+		t.Errorf("offset 14 -> %s +%d", span.Path, offset)
+	}
+	if _, _, ok := text.Locate(len([]rune("{{customer}}\t中文\n"))); ok {
+		t.Error("list marker should not be mapped")
+	}
+
+	// 没有编号定义时使用统一的项目符号
+	if plain := ExtractText(&root, nil); !strings.Contains(plain.Text, "• 选择题") {
+		t.Errorf("got %q", plain.Text)
+	}
+}
+
+func TestProcessText(t *testing.T) {
+	text, err := DocTrim{}.ProcessText("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text.Text == "" || len(text.Spans) == 0 {
+		t.Fatal("no text extracted")
+	}
+	runes := []rune(text.Text)
+	for _, span := range text.Spans {
+		got := string(runes[span.Offset : span.Offset+span.Length])
+		if span.Node.XMLName.Local == "t" && got != string(span.Node.Content) {
+			t.Errorf("%s: %q != %q", span.Path, got, span.Node.Content)
+		}
+	}
+
+	plain, err := DocTrim{PlainText: true}.Process("docs/test.docx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plain) != text.Text {
+		t.Error("Process did not return plain text")
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	cases := map[string]string{
+		"chineseCounting:10":       "十",
+		"chineseCounting:15":       "十五",
+		"chineseCounting:21":       "二十一",
+		"chineseCounting:105":      "一百零五",
+		"chineseLegalSimplified:3": "叁",
+		"upperLetter:28":           "BB",
+		"lowerRoman:14":            "xiv",
+		"decimalEnclosedCircle:3":  "③",
+		"decimal:7":                "7",
+	}
+	for in, want := range cases {
+		format, n, _ := strings.Cut(in, ":")
+		var num int
+		for _, c := range n {
+			num = num*10 + int(c-'0')
+		}
+		if got := formatNumber(num, format); got != want {
+			t.Errorf("%s: got %s, want %s", in, got, want)
+		}
+	}
+}
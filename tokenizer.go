@@ -0,0 +1,328 @@
+// 按token计量
+// 上下文窗口和费用按模型的token计算，字节数只能粗略反映打包的效果
+// Tokenizer是计量接口，内置的BPETokenizer是离线的近似实现：
+// 字节级BPE，合并表由gen_bpe.go在docs中的样例文档上训练，随代码一起发布
+// 不同模型的分词结果不同，近似值适合比较和预算，不能代替模型自己的计数
+
+package DocTrim
+
+//go:generate go run gen_bpe.go
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nbio/xml"
+)
+
+// Tokenizer 计量数据的token数
+type Tokenizer interface {
+	Count(data []byte) int
+}
+
+// ByteCounter 按字节计量的Tokenizer
+type ByteCounter struct{}
+
+// Count 返回字节数
+func (ByteCounter) Count(data []byte) int {
+	return len(data)
+}
+
+// pretokenRe 预分词规则：连续的字母、最多三位数字、连续的符号各为一段，前面可以带一个空格
+var pretokenRe = regexp.MustCompile(` ?\p{L}+| ?\p{N}{1,3}| ?[^\s\p{L}\p{N}]+|\s+`)
+
+// bpePair 相邻的两个符号
+type bpePair [2]string
+
+// BPETokenizer 字节级BPE分词器，初始词表为256个单字节，按合并表的顺序合并相邻符号
+type BPETokenizer struct {
+	merges []bpePair
+	ranks  map[bpePair]int
+
+	mu    sync.Mutex
+	cache map[string]int
+}
+
+//go:embed bpe_merges.txt
+var bundledMerges []byte
+
+var (
+	defaultTokenizer     *BPETokenizer
+	defaultTokenizerOnce sync.Once
+)
+
+// DefaultTokenizer 返回使用内置合并表的分词器
+func DefaultTokenizer() *BPETokenizer {
+	defaultTokenizerOnce.Do(func() {
+		t, err := ReadBPE(bytes.NewReader(bundledMerges))
+		if err != nil {
+			panic("DocTrim: bad bundled BPE merges: " + err.Error())
+		}
+		defaultTokenizer = t
+	})
+	return defaultTokenizer
+}
+
+// newBPETokenizer 用合并表创建分词器
+func newBPETokenizer(merges []bpePair) *BPETokenizer {
+	t := &BPETokenizer{merges: merges, ranks: make(map[bpePair]int, len(merges)), cache: map[string]int{}}
+	for i, m := range merges {
+		t.ranks[m] = i
+	}
+	return t
+}
+
+// ReadBPE 读取合并表，每行是十六进制表示的两个符号，以空格分隔，按优先级从高到低排列
+func ReadBPE(r io.Reader) (*BPETokenizer, error) {
+	merges := []bpePair{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: want two symbols", line)
+		}
+		var m bpePair
+		for i, f := range fields {
+			b, err := hex.DecodeString(f)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			m[i] = string(b)
+		}
+		merges = append(merges, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return newBPETokenizer(merges), nil
+}
+
+// WriteTo 写出合并表，格式与ReadBPE相同
+func (t *BPETokenizer) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+	var n int64
+	for _, m := range t.merges {
+		c, err := fmt.Fprintf(bw, "%x %x\n", m[0], m[1])
+		n += int64(c)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, bw.Flush()
+}
+
+// Len 返回合并规则的条数，词表大小为256加上该值
+func (t *BPETokenizer) Len() int {
+	return len(t.merges)
+}
+
+// Count 返回数据的token数，各预分词段的结果会被缓存，可以并发调用
+func (t *BPETokenizer) Count(data []byte) int {
+	n, covered := 0, 0
+	for _, loc := range pretokenRe.FindAllIndex(data, -1) {
+		n += t.countPretoken(string(data[loc[0]:loc[1]]))
+		covered += loc[1] - loc[0]
+	}
+	// 预分词规则覆盖所有合法的UTF-8文本，剩下的无效字节各算一个token
+	return n + len(data) - covered
+}
+
+// countPretoken 返回一段预分词的token数
+func (t *BPETokenizer) countPretoken(word string) int {
+	t.mu.Lock()
+	n, ok := t.cache[word]
+	t.mu.Unlock()
+	if ok {
+		return n
+	}
+	n = len(t.encode(word))
+	t.mu.Lock()
+	t.cache[word] = n
+	t.mu.Unlock()
+	return n
+}
+
+// encode 反复合并优先级最高的相邻符号，直到没有可以合并的符号
+func (t *BPETokenizer) encode(word string) []string {
+	symbols := make([]string, len(word))
+	for i := 0; i < len(word); i++ {
+		symbols[i] = word[i : i+1]
+	}
+	for len(symbols) > 1 {
+		best, at := -1, -1
+		for i := 0; i+1 < len(symbols); i++ {
+			if r, ok := t.ranks[bpePair{symbols[i], symbols[i+1]}]; ok && (best < 0 || r < best) {
+				best, at = r, i
+			}
+		}
+		if at < 0 {
+			break
+		}
+		m := t.merges[best]
+		merged := symbols[:0]
+		for i := 0; i < len(symbols); i++ {
+			if i+1 < len(symbols) && symbols[i] == m[0] && symbols[i+1] == m[1] {
+				merged = append(merged, m[0]+m[1])
+				i++
+				continue
+			}
+			merged = append(merged, symbols[i])
+		}
+		symbols = merged
+	}
+	return symbols
+}
+
+// TrainBPE 在语料上训练count条合并规则，每轮合并出现次数最多的相邻符号，次数相同时按字节序取最小的
+func TrainBPE(corpus [][]byte, count int) *BPETokenizer {
+	freq := map[string]int{}
+	for _, data := range corpus {
+		for _, loc := range pretokenRe.FindAllIndex(data, -1) {
+			freq[string(data[loc[0]:loc[1]])]++
+		}
+	}
+	type bpeWord struct {
+		symbols []string
+		freq    int
+	}
+	words := make([]bpeWord, 0, len(freq))
+	for w, f := range freq {
+		symbols := make([]string, len(w))
+		for i := 0; i < len(w); i++ {
+			symbols[i] = w[i : i+1]
+		}
+		words = append(words, bpeWord{symbols, f})
+	}
+
+	merges := []bpePair{}
+	for len(merges) < count {
+		pairs := map[bpePair]int{}
+		for _, w := range words {
+			for i := 0; i+1 < len(w.symbols); i++ {
+				pairs[bpePair{w.symbols[i], w.symbols[i+1]}] += w.freq
+			}
+		}
+		var best bpePair
+		bestFreq := 0
+		for p, f := range pairs {
+			if f > bestFreq || (f == bestFreq && p[0]+"\x00"+p[1] < best[0]+"\x00"+best[1]) {
+				best, bestFreq = p, f
+			}
+		}
+		// 只出现一次的组合合并后没有意义
+		if bestFreq < 2 {
+			break
+		}
+		merges = append(merges, best)
+		for i, w := range words {
+			merged := w.symbols[:0]
+			for j := 0; j < len(w.symbols); j++ {
+				if j+1 < len(w.symbols) && w.symbols[j] == best[0] && w.symbols[j+1] == best[1] {
+					merged = append(merged, best[0]+best[1])
+					j++
+					continue
+				}
+				merged = append(merged, w.symbols[j])
+			}
+			words[i].symbols = merged
+		}
+	}
+	return newBPETokenizer(merges)
+}
+
+// ElementCost 一种元素占用的长度
+type ElementCost struct {
+	// Name 元素名，与数据中的写法相同，如w:rPr或缩写后的_3
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	// Size 开始标签、结束标签和直接包含的文本的长度之和
+	Size int `json:"size"`
+}
+
+// ElementCosts 按元素名统计XML数据的长度，measure为nil时按字节计，结果按长度从大到小排列
+// 直接在字节上统计，原始文档和Pack的输出都适用；声明、注释等不属于任何元素的内容记在空名字下
+func ElementCosts(data []byte, measure func(data []byte) int) ([]ElementCost, error) {
+	if measure == nil {
+		measure = ByteCounter{}.Count
+	}
+	costs := map[string]*ElementCost{}
+	add := func(name string, span []byte, start bool) {
+		c, ok := costs[name]
+		if !ok {
+			c = &ElementCost{Name: name}
+			costs[name] = c
+		}
+		if start {
+			c.Count++
+		}
+		c.Size += measure(span)
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	stack := []string{}
+	offset := int64(0)
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		next := d.InputOffset()
+		span := data[offset:next]
+		offset = next
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := rawName(t.Name)
+			add(name, span, true)
+			stack = append(stack, name)
+		case xml.EndElement:
+			// 自闭合标签的结束标记不占字节
+			if len(stack) > 0 {
+				add(stack[len(stack)-1], span, false)
+				stack = stack[:len(stack)-1]
+			}
+		default:
+			name := ""
+			if len(stack) > 0 {
+				name = stack[len(stack)-1]
+			}
+			add(name, span, false)
+		}
+	}
+
+	result := make([]ElementCost, 0, len(costs))
+	for _, c := range costs {
+		result = append(result, *c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Size != result[j].Size {
+			return result[i].Size > result[j].Size
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// rawName 返回RawToken中元素名的写法，Space是前缀而不是命名空间
+func rawName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
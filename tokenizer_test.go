@@ -0,0 +1,98 @@
+package DocTrim
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestTokenizer(t *testing.T) {
+	data, _ := os.ReadFile("docs/test.xml")
+	tok := DefaultTokenizer()
+	if tok.Len() == 0 {
+		t.Fatal("bundled merges are empty")
+	}
+	if n := tok.Count(nil); n != 0 {
+		t.Errorf("empty input: %d tokens", n)
+	}
+	n := tok.Count(data)
+	// 标记和中文文本的字节数与token数之比通常在2到6之间
+	if ratio := float64(len(data)) / float64(n); ratio < 2 || ratio > 6 {
+		t.Errorf("%d bytes, %d tokens", len(data), n)
+	}
+	if n := tok.Count([]byte("w:eastAsia")); n >= len("w:eastAsia") {
+		t.Errorf("common attribute name: %d tokens", n)
+	}
+
+	// 合并表写出后读回，计量结果不变
+	var buf bytes.Buffer
+	if _, err := tok.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadBPE(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.Count(data) != n {
+		t.Errorf("round trip: got %d tokens, want %d", read.Count(data), n)
+	}
+	if _, err := ReadBPE(strings.NewReader("3c77 zz\n")); err == nil {
+		t.Error("bad hex should be rejected")
+	}
+}
+
+func TestTrainBPE(t *testing.T) {
+	corpus := [][]byte{[]byte(strings.Repeat("<w:r><w:t>paragraph</w:t></w:r>", 20))}
+	if tok := TrainBPE(corpus, 3); tok.Len() != 3 {
+		t.Errorf("got %d merges, want 3", tok.Len())
+	}
+	// 出现不到两次的组合不再合并
+	tok := TrainBPE(corpus, 1000)
+	if tok.Len() == 1000 {
+		t.Error("training should stop when no pair repeats")
+	}
+	// 重复的语料完全合并后每个预分词段是一个token
+	if n := tok.Count(corpus[0]); n != len(pretokenRe.FindAllIndex(corpus[0], -1)) {
+		t.Errorf("trained tokenizer: %d tokens for %d bytes", n, len(corpus[0]))
+	}
+	if n := (ByteCounter{}).Count(corpus[0]); n != len(corpus[0]) {
+		t.Errorf("byte counter: %d", n)
+	}
+}
+
+func TestElementCosts(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?><w:p><w:r><w:rPr><w:b/></w:rPr><w:t>text</w:t></w:r></w:p>`)
+	costs, err := ElementCosts(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := map[string]int{}
+	total := 0
+	for _, c := range costs {
+		sizes[c.Name] = c.Size
+		total += c.Size
+	}
+	if total != len(data) {
+		t.Errorf("costs sum to %d, want %d", total, len(data))
+	}
+	if sizes["w:t"] != len("<w:t>text</w:t>") || sizes["w:b"] != len("<w:b/>") || sizes[""] != len(`<?xml version="1.0"?>`) {
+		t.Errorf("got %v", costs)
+	}
+	if costs[0].Name != "" || costs[len(costs)-1].Name != "w:b" {
+		t.Errorf("costs should be sorted by size, got %v", costs)
+	}
+
+	slim := DocTrim{}
+	packed, err := slim.Pack(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := ElementCosts(packed, DefaultTokenizer().Count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) == 0 {
+		t.Error("no costs for packed data")
+	}
+}